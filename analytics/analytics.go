@@ -1,3 +1,6 @@
+// Package analytics contains the read queries run against the visits table.
+// Queries are written with ? placeholders and rebound for the driver of the
+// database they are run against, so they work with every supported backend.
 package analytics
 
 import (
@@ -7,28 +10,24 @@ import (
 )
 
 const (
-	// Count the number of distinct IP addresses which have visited the host & path.
-	QueryVisitorsPerHostPath = `SELECT COUNT(distinct ip) FROM visits WHERE host = ? AND path = ?;`
-	// Count the number of entries with the given host & path.
-	QueryVisitsPerHostPath = `SELECT COUNT(id) FROM visits WHERE host = ? AND path = ?;`
-
-	// List all the distinct paths in the database.
-	QueryAllPaths = `SELECT DISTINCT path FROM visits;`
-	// List all the distinct hosts in the database.
-	QueryAllHosts = `SELECT DISTINCT host FROM visits;`
+	// List all the distinct paths in the database, including rolled up ones.
+	QueryAllPaths = `SELECT DISTINCT path FROM visits
+		UNION ALL SELECT DISTINCT path FROM visit_rollups WHERE path NOT IN (SELECT path FROM visits);`
+	// List all the distinct hosts in the database, including rolled up ones.
+	QueryAllHosts = `SELECT DISTINCT host FROM visits
+		UNION ALL SELECT DISTINCT host FROM visit_rollups WHERE host NOT IN (SELECT host FROM visits);`
 )
 
 // Fetch a count of all the visitors for the given path. This is done by
-// counting the distinct IP addresses which have visited the path.
+// counting the distinct visitor IDs which have visited the path, estimated
+// once any of its visits have been rolled up.
 func VisitorsForHostPath(db *sqlx.DB, host string, path string) (count int, err error) {
-	err = db.Get(&count, QueryVisitorsPerHostPath, host, path)
-	return count, err
+	return Visitors(db, Filter{Host: host, Path: path})
 }
 
 // Fetch a count of all the views of the path.
 func ViewsForHostPath(db *sqlx.DB, host string, path string) (count int, err error) {
-	err = db.Get(&count, QueryVisitsPerHostPath, host, path)
-	return count, err
+	return Views(db, Filter{Host: host, Path: path})
 }
 
 // Fetch all the paths in the database.
@@ -47,9 +46,9 @@ func AllHosts(db *sqlx.DB) (hosts []string, err error) {
 func ListDistinctColumn(db *sqlx.DB, col string) (entries []string, err error) {
 	switch col {
 	case "host":
-		err = db.Select(&entries, "SELECT DISTINCT host FROM visits;")
+		err = db.Select(&entries, QueryAllHosts)
 	case "path":
-		err = db.Select(&entries, "SELECT DISTINCT path FROM visits;")
+		err = db.Select(&entries, QueryAllPaths)
 	default:
 		return []string{}, fmt.Errorf("unable to query distinct column %s", col)
 	}
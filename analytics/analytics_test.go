@@ -13,9 +13,9 @@ func initDB() (*sqlx.DB, error) {
 		return db, err
 	}
 	_, err = db.Exec(`
-		INSERT INTO visits (ip, host, path, user_agent, created_at) VALUES
-		('127.0.0.1', 'example.org', '/root', 'go test client', datetime('now')),
-		('127.0.0.1', 'example.org', '/foo', 'go test client', datetime('now'));`)
+		INSERT INTO visits (ip, visitor_id, host, path, user_agent, created_at) VALUES
+		('127.0.0.1', '127.0.0.1', 'example.org', '/root', 'go test client', datetime('now')),
+		('127.0.0.1', '127.0.0.1', 'example.org', '/foo', 'go test client', datetime('now'));`)
 	return db, err
 }
 
@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Dimension is a property of the visitors, like their browser or country,
+// which visits can be broken down by.
+type Dimension string
+
+const (
+	DimensionBrowser        Dimension = "browser"
+	DimensionBrowserVersion Dimension = "browser_version"
+	DimensionOS             Dimension = "os"
+	DimensionDevice         Dimension = "device"
+	DimensionCountry        Dimension = "country"
+)
+
+// ParseDimension validates a dimension name from user input.
+func ParseDimension(name string) (Dimension, error) {
+	switch dimension := Dimension(name); dimension {
+	case DimensionBrowser, DimensionBrowserVersion, DimensionOS, DimensionDevice, DimensionCountry:
+		return dimension, nil
+	default:
+		return "", fmt.Errorf("unknown dimension %q, expected browser, browser_version, os, device or country", name)
+	}
+}
+
+// column returns the column the dimension is stored in. Visits with an empty
+// value weren't, or couldn't be, classified.
+func (d Dimension) column() string {
+	if d == DimensionBrowserVersion {
+		return "browser"
+	}
+	return string(d)
+}
+
+// expression returns the SQL expression for the value of the dimension.
+// Browser versions are prefixed with the browser, like "Chrome 120".
+func (d Dimension) expression() string {
+	if d == DimensionBrowserVersion {
+		return "browser || ' ' || browser_version"
+	}
+	return d.column()
+}
+
+// BreakdownEntry is the traffic from a single value of a dimension, like the
+// Firefox browser, mobile devices or a country code.
+type BreakdownEntry struct {
+	Value    string `db:"value" json:"value"`
+	Views    int    `db:"views" json:"views"`
+	Visitors int    `db:"visitors" json:"visitors"`
+}
+
+// Fetch the views and visitors of the visits matching the filter, grouped by
+// the value of dimension. Visits without a value, like those recorded before
+// user agents were parsed or from an unknown country, are left out.
+func Breakdown(db *sqlx.DB, filter Filter, dimension Dimension, page Page) ([]BreakdownEntry, error) {
+	if _, err := ParseDimension(string(dimension)); err != nil {
+		return nil, err
+	}
+	orderBy, err := page.orderBy("value")
+	if err != nil {
+		return nil, err
+	}
+	value := dimension.expression()
+	where, args := filter.where(dimension.column() + " != ''")
+	query := "SELECT " + value + " AS value, COUNT(id) AS views, COUNT(DISTINCT visitor_id) AS visitors FROM visits" +
+		where + " GROUP BY " + value + orderBy
+
+	entries := []BreakdownEntry{}
+	err = db.Select(&entries, db.Rebind(query), args...)
+	return entries, err
+}
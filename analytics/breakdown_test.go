@@ -0,0 +1,94 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/parkr/ping/database"
+)
+
+func initBreakdownDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := database.InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`
+		INSERT INTO visits (ip, visitor_id, host, path, user_agent, browser, browser_version, os, device, country, created_at) VALUES
+		('127.0.0.1', '127.0.0.1', 'example.org', '/root', 'chrome', 'Chrome', '120', 'Windows', 'desktop', 'GB', '2024-01-01 09:00:00'),
+		('127.0.0.1', '127.0.0.1', 'example.org', '/root', 'chrome', 'Chrome', '120', 'Windows', 'desktop', 'GB', '2024-01-01 10:00:00'),
+		('127.0.0.2', '127.0.0.2', 'example.org', '/root', 'chrome', 'Chrome', '119', 'Android', 'mobile', 'SE', '2024-01-01 09:00:00'),
+		('127.0.0.3', '127.0.0.3', 'example.org', '/root', 'safari', 'Safari', '17', 'iOS', 'mobile', 'GB', '2024-01-01 09:00:00'),
+		('127.0.0.4', '127.0.0.4', 'example.org', '/root', 'safari', 'Safari', '17', 'iOS', 'tablet', '', '2024-02-01 09:00:00'),
+		('127.0.0.5', '127.0.0.5', 'example.org', '/root', 'unparsed', '', '', '', '', '', '2024-01-01 09:00:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestBreakdown(t *testing.T) {
+	db := initBreakdownDB(t)
+
+	for dimension, expected := range map[Dimension][]BreakdownEntry{
+		DimensionBrowser: {
+			{Value: "Chrome", Views: 3, Visitors: 2},
+			{Value: "Safari", Views: 2, Visitors: 2},
+		},
+		DimensionBrowserVersion: {
+			{Value: "Chrome 120", Views: 2, Visitors: 1},
+			{Value: "Safari 17", Views: 2, Visitors: 2},
+			{Value: "Chrome 119", Views: 1, Visitors: 1},
+		},
+		DimensionOS: {
+			{Value: "Windows", Views: 2, Visitors: 1},
+			{Value: "iOS", Views: 2, Visitors: 2},
+			{Value: "Android", Views: 1, Visitors: 1},
+		},
+		DimensionCountry: {
+			{Value: "GB", Views: 3, Visitors: 2},
+			{Value: "SE", Views: 1, Visitors: 1},
+		},
+		DimensionDevice: {
+			{Value: "desktop", Views: 2, Visitors: 1},
+			{Value: "mobile", Views: 2, Visitors: 2},
+			{Value: "tablet", Views: 1, Visitors: 1},
+		},
+	} {
+		entries, err := Breakdown(db, Filter{Host: "example.org"}, dimension, Page{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(entries, expected) {
+			t.Errorf("%s: expected %+v, got %+v", dimension, expected, entries)
+		}
+	}
+}
+
+func TestBreakdown_TimeRangeByVisitors(t *testing.T) {
+	db := initBreakdownDB(t)
+
+	filter := Filter{Host: "example.org", From: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)}
+	entries, err := Breakdown(db, filter, DimensionDevice, Page{SortBy: "visitors"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []BreakdownEntry{
+		{Value: "mobile", Views: 2, Visitors: 2},
+		{Value: "desktop", Views: 2, Visitors: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestBreakdown_InvalidDimension(t *testing.T) {
+	db := initBreakdownDB(t)
+
+	if _, err := Breakdown(db, Filter{}, Dimension("user_agent"), Page{}); err == nil {
+		t.Error("expected an error for an unknown dimension")
+	}
+}
@@ -0,0 +1,30 @@
+package analytics
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// CampaignEntry is the traffic from a single campaign, source & medium.
+type CampaignEntry struct {
+	Campaign string `db:"utm_campaign" json:"campaign"`
+	Source   string `db:"utm_source" json:"source"`
+	Medium   string `db:"utm_medium" json:"medium"`
+	Views    int    `db:"views" json:"views"`
+	Visitors int    `db:"visitors" json:"visitors"`
+}
+
+// Fetch the views and visitors of the visits matching the filter which came
+// from a link with UTM params, grouped by campaign, source & medium.
+func Campaigns(db *sqlx.DB, filter Filter, page Page) ([]CampaignEntry, error) {
+	orderBy, err := page.orderBy("utm_campaign, utm_source, utm_medium")
+	if err != nil {
+		return nil, err
+	}
+	where, args := filter.where("(utm_campaign != '' OR utm_source != '' OR utm_medium != '')")
+	query := "SELECT utm_campaign, utm_source, utm_medium, COUNT(id) AS views, COUNT(DISTINCT visitor_id) AS visitors FROM visits" +
+		where + " GROUP BY utm_campaign, utm_source, utm_medium" + orderBy
+
+	entries := []CampaignEntry{}
+	err = db.Select(&entries, db.Rebind(query), args...)
+	return entries, err
+}
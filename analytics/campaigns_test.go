@@ -0,0 +1,53 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/parkr/ping/database"
+)
+
+func TestCampaigns(t *testing.T) {
+	db, err := database.InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+		INSERT INTO visits (ip, visitor_id, host, path, user_agent, utm_campaign, utm_source, utm_medium, utm_content, created_at) VALUES
+		('127.0.0.1', '127.0.0.1', 'example.org', '/launch', 'go test client', 'launch', 'newsletter', 'email', 'header', '2024-01-01 09:00:00'),
+		('127.0.0.2', '127.0.0.2', 'example.org', '/launch', 'go test client', 'launch', 'newsletter', 'email', 'footer', '2024-01-01 09:00:00'),
+		('127.0.0.2', '127.0.0.2', 'example.org', '/pricing', 'go test client', 'launch', 'newsletter', 'email', '', '2024-01-01 10:00:00'),
+		('127.0.0.3', '127.0.0.3', 'example.org', '/launch', 'go test client', 'launch', 'twitter', 'social', '', '2024-01-01 09:00:00'),
+		('127.0.0.4', '127.0.0.4', 'example.org', '/launch', 'go test client', '', '', '', '', '2024-01-01 09:00:00'),
+		('127.0.0.5', '127.0.0.5', 'example.com', '/', 'go test client', 'other-site', 'newsletter', 'email', '', '2024-01-01 09:00:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Campaigns(db, Filter{Host: "example.org"}, Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []CampaignEntry{
+		{Campaign: "launch", Source: "newsletter", Medium: "email", Views: 3, Visitors: 2},
+		{Campaign: "launch", Source: "twitter", Medium: "social", Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+
+	entries, err = Campaigns(db, Filter{}, Page{SortBy: "visitors", Limit: 1, Offset: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = []CampaignEntry{
+		{Campaign: "other-site", Source: "newsletter", Medium: "email", Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
@@ -0,0 +1,46 @@
+package analytics
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// EngagementEntry is the time spent on a path.
+type EngagementEntry struct {
+	Host string `db:"host" json:"host"`
+	Path string `db:"path" json:"path"`
+	// Views and Visitors only count the visits whose engaged time was
+	// reported.
+	Views    int `db:"views" json:"views"`
+	Visitors int `db:"visitors" json:"visitors"`
+	// AverageSeconds and MedianSeconds summarize how long the page was
+	// visible for.
+	AverageSeconds float64 `db:"average_seconds" json:"average_seconds"`
+	MedianSeconds  float64 `db:"median_seconds" json:"median_seconds"`
+}
+
+// Fetch the average and median time spent on each path matching the filter,
+// ranked by views or visitors. Visits whose engaged time was never reported,
+// like those from the ?v=1 pixel, are left out.
+//
+// The median is the middle engaged time of each path, or the mean of the
+// two middle ones, found by numbering the visits of each path in order of
+// their engaged time.
+func Engagement(db *sqlx.DB, filter Filter, page Page) ([]EngagementEntry, error) {
+	orderBy, err := page.orderBy("host, path")
+	if err != nil {
+		return nil, err
+	}
+	where, args := filter.where("engaged_seconds > 0")
+	query := `SELECT host, path, COUNT(*) AS views, COUNT(DISTINCT visitor_id) AS visitors,
+		AVG(engaged_seconds) AS average_seconds,
+		AVG(CASE WHEN position IN ((total + 1) / 2, (total + 2) / 2) THEN engaged_seconds END) AS median_seconds
+		FROM (SELECT host, path, visitor_id, engaged_seconds,
+			ROW_NUMBER() OVER (PARTITION BY host, path ORDER BY engaged_seconds) AS position,
+			COUNT(*) OVER (PARTITION BY host, path) AS total
+			FROM visits` + where + `) AS engaged
+		GROUP BY host, path` + orderBy
+
+	entries := []EngagementEntry{}
+	err = db.Select(&entries, db.Rebind(query), args...)
+	return entries, err
+}
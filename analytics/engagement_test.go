@@ -0,0 +1,55 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/parkr/ping/database"
+)
+
+func TestEngagement(t *testing.T) {
+	db, err := database.InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+		INSERT INTO visits (ip, visitor_id, host, path, user_agent, engaged_seconds, created_at) VALUES
+		('127.0.0.1', '127.0.0.1', 'example.org', '/long-read', 'go test client', 10, '2024-01-01 09:00:00'),
+		('127.0.0.2', '127.0.0.2', 'example.org', '/long-read', 'go test client', 20, '2024-01-01 09:00:00'),
+		('127.0.0.3', '127.0.0.3', 'example.org', '/long-read', 'go test client', 300, '2024-01-01 09:00:00'),
+		('127.0.0.3', '127.0.0.3', 'example.org', '/long-read', 'go test client', 30, '2024-01-01 10:00:00'),
+		('127.0.0.4', '127.0.0.4', 'example.org', '/long-read', 'go test client', 0, '2024-01-01 09:00:00'),
+		('127.0.0.1', '127.0.0.1', 'example.org', '/skim', 'go test client', 5, '2024-01-01 09:00:00'),
+		('127.0.0.2', '127.0.0.2', 'example.org', '/skim', 'go test client', 3, '2024-01-01 09:00:00'),
+		('127.0.0.3', '127.0.0.3', 'example.org', '/skim', 'go test client', 4, '2024-02-01 09:00:00'),
+		('127.0.0.1', '127.0.0.1', 'example.com', '/elsewhere', 'go test client', 60, '2024-01-01 09:00:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Engagement(db, Filter{Host: "example.org"}, Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []EngagementEntry{
+		{Host: "example.org", Path: "/long-read", Views: 4, Visitors: 3, AverageSeconds: 90, MedianSeconds: 25},
+		{Host: "example.org", Path: "/skim", Views: 3, Visitors: 3, AverageSeconds: 4, MedianSeconds: 4},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected entries %+v, got: %+v", expected, entries)
+	}
+
+	entries, err = Engagement(db, Filter{Host: "example.org", Path: "/skim", To: time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)}, Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []EngagementEntry{
+		{Host: "example.org", Path: "/skim", Views: 2, Visitors: 2, AverageSeconds: 4, MedianSeconds: 4},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected entries %+v, got: %+v", expected, entries)
+	}
+}
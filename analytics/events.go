@@ -0,0 +1,49 @@
+package analytics
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// EventEntry is the number of times an event was triggered, optionally
+// broken down by the value of one of its properties.
+type EventEntry struct {
+	Name     string `db:"name" json:"name"`
+	Value    string `db:"value" json:"value,omitempty"`
+	Count    int    `db:"count" json:"count"`
+	Visitors int    `db:"visitors" json:"visitors"`
+}
+
+// Fetch the number of times each event matching the filter was triggered,
+// most frequent first. If name is given, only that event is counted. If
+// property is given, events are counted for each value of that property, and
+// events without it are skipped.
+func Events(db *sqlx.DB, filter Filter, name, property string, page Page) ([]EventEntry, error) {
+	conditions := []string{}
+	conditionArgs := []interface{}{}
+	if name != "" {
+		conditions = append(conditions, "events.name = ?")
+		conditionArgs = append(conditionArgs, name)
+	}
+	where, args := filter.where(conditions...)
+	args = append(conditionArgs, args...)
+
+	limit, offset := page.bounds()
+	var query string
+	if property == "" {
+		query = "SELECT events.name, COUNT(events.id) AS count, COUNT(DISTINCT events.visitor_id) AS visitors FROM events" +
+			where + " GROUP BY events.name" +
+			fmt.Sprintf(" ORDER BY count DESC, events.name LIMIT %d OFFSET %d", limit, offset)
+	} else {
+		query = "SELECT events.name, event_properties.value, COUNT(events.id) AS count, COUNT(DISTINCT events.visitor_id) AS visitors FROM events" +
+			" JOIN event_properties ON event_properties.event_id = events.id AND event_properties.key = ?" +
+			where + " GROUP BY events.name, event_properties.value" +
+			fmt.Sprintf(" ORDER BY count DESC, events.name, event_properties.value LIMIT %d OFFSET %d", limit, offset)
+		args = append([]interface{}{property}, args...)
+	}
+
+	entries := []EventEntry{}
+	err := db.Select(&entries, db.Rebind(query), args...)
+	return entries, err
+}
@@ -0,0 +1,90 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/parkr/ping/database"
+)
+
+func initEventsDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := database.InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, event := range []*database.Event{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/pricing", Name: "signup", CreatedAt: "2024-01-01 09:00:00",
+			Properties: map[string]string{"plan": "pro"}},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/pricing", Name: "signup", CreatedAt: "2024-01-01 10:00:00",
+			Properties: map[string]string{"plan": "free"}},
+		{IP: "127.0.0.3", Host: "example.org", Path: "/", Name: "signup", CreatedAt: "2024-01-02 10:00:00",
+			Properties: map[string]string{"plan": "pro", "button": "hero"}},
+		{IP: "127.0.0.1", Host: "example.org", Path: "/download", Name: "download", CreatedAt: "2024-01-01 09:30:00"},
+		{IP: "127.0.0.1", Host: "example.org", Path: "/download", Name: "download", CreatedAt: "2024-01-01 09:31:00"},
+		{IP: "127.0.0.1", Host: "example.org", Path: "/download", Name: "download", CreatedAt: "2024-01-01 09:32:00"},
+		{IP: "127.0.0.1", Host: "example.com", Path: "/", Name: "signup", CreatedAt: "2024-01-01 09:00:00"},
+	} {
+		if err := event.Save(db); err != nil {
+			t.Fatalf("unable to save event %s: %v", event, err)
+		}
+	}
+	return db
+}
+
+func TestEvents_ByName(t *testing.T) {
+	db := initEventsDB(t)
+
+	entries, err := Events(db, Filter{Host: "example.org"}, "", "", Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []EventEntry{
+		{Name: "download", Count: 3, Visitors: 1},
+		{Name: "signup", Count: 3, Visitors: 3},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestEvents_ByProperty(t *testing.T) {
+	db := initEventsDB(t)
+
+	entries, err := Events(db, Filter{Host: "example.org"}, "signup", "plan", Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []EventEntry{
+		{Name: "signup", Value: "pro", Count: 2, Visitors: 2},
+		{Name: "signup", Value: "free", Count: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestEvents_TimeRange(t *testing.T) {
+	db := initEventsDB(t)
+
+	filter := Filter{
+		Host: "example.org",
+		From: time.Date(2024, time.January, 1, 9, 30, 0, 0, time.UTC),
+		To:   time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC),
+	}
+	entries, err := Events(db, filter, "", "", Page{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []EventEntry{{Name: "download", Count: 3, Visitors: 1}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
@@ -0,0 +1,90 @@
+package analytics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/parkr/ping/database"
+)
+
+// Filter narrows a query down to a subset of the visits table. The zero value
+// of each field leaves the query unrestricted by it, except for Bots.
+type Filter struct {
+	Host string
+	Path string
+
+	// From is the inclusive start of the time range.
+	From time.Time
+	// To is the exclusive end of the time range.
+	To time.Time
+
+	// Bots selects visits by whether a bot made them. Bots are left out by
+	// default.
+	Bots Bots
+}
+
+// Bots selects visits by whether a bot made them.
+type Bots string
+
+const (
+	BotsExcluded Bots = ""
+	BotsIncluded Bots = "include"
+	BotsOnly     Bots = "only"
+)
+
+// ParseBots validates the bots option from user input. Both an empty string
+// and "exclude" leave bots out.
+func ParseBots(name string) (Bots, error) {
+	switch bots := Bots(name); bots {
+	case BotsExcluded, "exclude":
+		return BotsExcluded, nil
+	case BotsIncluded, BotsOnly:
+		return bots, nil
+	default:
+		return "", fmt.Errorf("unknown bots option %q, expected exclude, include or only", name)
+	}
+}
+
+// where builds the WHERE clause for the filter and any extra conditions,
+// including the WHERE keyword unless there are no conditions at all, along
+// with the filter's arguments. The extra conditions come first, so any
+// arguments they need must be placed before the returned ones.
+func (f Filter) where(extra ...string) (string, []interface{}) {
+	return f.whereColumns("path", "created_at", extra...)
+}
+
+// whereColumns is where for a table whose path and time columns have other
+// names, like sessions.
+func (f Filter) whereColumns(pathColumn, timeColumn string, extra ...string) (string, []interface{}) {
+	clauses := append([]string{}, extra...)
+	args := []interface{}{}
+	if f.Host != "" {
+		clauses = append(clauses, "host = ?")
+		args = append(args, f.Host)
+	}
+	if f.Path != "" {
+		clauses = append(clauses, pathColumn+" = ?")
+		args = append(args, f.Path)
+	}
+	if !f.From.IsZero() {
+		clauses = append(clauses, timeColumn+" >= ?")
+		args = append(args, f.From.UTC().Format(database.SQLDateTimeFormat))
+	}
+	if !f.To.IsZero() {
+		clauses = append(clauses, timeColumn+" < ?")
+		args = append(args, f.To.UTC().Format(database.SQLDateTimeFormat))
+	}
+	switch f.Bots {
+	case BotsExcluded:
+		clauses = append(clauses, "is_bot = ?")
+		args = append(args, false)
+	case BotsOnly:
+		clauses = append(clauses, "is_bot = ?")
+		args = append(args, true)
+	}
+	if len(clauses) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
@@ -0,0 +1,195 @@
+package analytics
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Referrer categories.
+const (
+	// CategoryDirect is traffic without an external referrer.
+	CategoryDirect = "direct"
+	// CategorySearch is traffic from search engines.
+	CategorySearch = "search"
+	// CategorySocial is traffic from social networks and link aggregators.
+	CategorySocial = "social"
+	// CategoryWebsite is traffic from any other website.
+	CategoryWebsite = "website"
+)
+
+// knownSource is a well-known traffic source spanning one or more domains.
+type knownSource struct {
+	name     string
+	category string
+	// domains match the domain itself and all of its subdomains.
+	domains []string
+	// label matches any domain with this label, for sources with a domain
+	// per country like google.com and google.co.uk.
+	label string
+}
+
+var knownSources = []knownSource{
+	{name: "Google", category: CategorySearch, label: "google"},
+	{name: "Bing", category: CategorySearch, domains: []string{"bing.com"}},
+	{name: "DuckDuckGo", category: CategorySearch, domains: []string{"duckduckgo.com"}},
+	{name: "Yahoo", category: CategorySearch, label: "yahoo"},
+	{name: "Yandex", category: CategorySearch, label: "yandex"},
+	{name: "Baidu", category: CategorySearch, domains: []string{"baidu.com"}},
+	{name: "Ecosia", category: CategorySearch, domains: []string{"ecosia.org"}},
+	{name: "Kagi", category: CategorySearch, domains: []string{"kagi.com"}},
+	{name: "Qwant", category: CategorySearch, domains: []string{"qwant.com"}},
+	{name: "Startpage", category: CategorySearch, domains: []string{"startpage.com"}},
+	{name: "Brave Search", category: CategorySearch, domains: []string{"search.brave.com"}},
+
+	{name: "Facebook", category: CategorySocial, domains: []string{"facebook.com", "fb.me"}},
+	{name: "Instagram", category: CategorySocial, domains: []string{"instagram.com"}},
+	{name: "Twitter", category: CategorySocial, domains: []string{"twitter.com", "t.co", "x.com"}},
+	{name: "LinkedIn", category: CategorySocial, domains: []string{"linkedin.com", "lnkd.in"}},
+	{name: "Reddit", category: CategorySocial, domains: []string{"reddit.com"}},
+	{name: "Hacker News", category: CategorySocial, domains: []string{"news.ycombinator.com"}},
+	{name: "Lobsters", category: CategorySocial, domains: []string{"lobste.rs"}},
+	{name: "Mastodon", category: CategorySocial, domains: []string{"mastodon.social"}},
+	{name: "Bluesky", category: CategorySocial, domains: []string{"bsky.app"}},
+	{name: "Threads", category: CategorySocial, domains: []string{"threads.net"}},
+	{name: "Pinterest", category: CategorySocial, domains: []string{"pinterest.com"}},
+	{name: "YouTube", category: CategorySocial, domains: []string{"youtube.com", "youtu.be"}},
+}
+
+// ClassifyReferrer returns the traffic source and category of a referrer URL.
+// Well-known search engines and social sites are named, e.g. "Google" for
+// both www.google.com and google.co.uk. Other websites are identified by
+// their domain, without any "www." prefix.
+func ClassifyReferrer(referrer string) (source, category string) {
+	if referrer == "" {
+		return "", CategoryDirect
+	}
+	parsed, err := url.Parse(referrer)
+	if err != nil || parsed.Hostname() == "" {
+		return referrer, CategoryWebsite
+	}
+
+	domain := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	labels := strings.Split(domain, ".")
+	for _, known := range knownSources {
+		for _, knownDomain := range known.domains {
+			if domain == knownDomain || strings.HasSuffix(domain, "."+knownDomain) {
+				return known.name, known.category
+			}
+		}
+		if known.label == "" {
+			continue
+		}
+		for i, label := range labels {
+			if label == known.label && isPublicSuffix(labels[i+1:]) {
+				return known.name, known.category
+			}
+		}
+	}
+	return domain, CategoryWebsite
+}
+
+// isPublicSuffix approximates whether labels form a top-level domain like
+// "com", "de" or "co.uk", so that google.co.uk matches the "google" label but
+// google.example.com does not.
+func isPublicSuffix(labels []string) bool {
+	if len(labels) == 0 || len(labels) > 2 {
+		return false
+	}
+	for _, label := range labels {
+		if len(label) > 3 {
+			return false
+		}
+	}
+	return true
+}
+
+// ReferrerEntry is the traffic from a single source.
+type ReferrerEntry struct {
+	// Source is the name of a well-known site, a referring domain, or empty
+	// for direct traffic. When grouping by category, it is empty.
+	Source   string `json:"source"`
+	Category string `json:"category"`
+	Views    int    `json:"views"`
+	Visitors int    `json:"visitors"`
+}
+
+type referrerVisitor struct {
+	Referrer string `db:"referrer"`
+	Visitor  string `db:"visitor"`
+	Views    int    `db:"views"`
+}
+
+// Fetch the traffic sources of the visits matching the filter, ranked by
+// views or visitors. With byCategory, sources are further grouped into
+// their categories, e.g. all search engines together.
+func Referrers(db *sqlx.DB, filter Filter, page Page, byCategory bool) ([]ReferrerEntry, error) {
+	sortBy, err := page.sortColumn()
+	if err != nil {
+		return nil, err
+	}
+
+	where, args := filter.where()
+	query := "SELECT referrer, visitor_id AS visitor, COUNT(id) AS views FROM visits" + where + " GROUP BY referrer, visitor_id"
+	rows := []referrerVisitor{}
+	if err := db.Select(&rows, db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	// Referrers are grouped in Go, rather than SQL, because a source spans
+	// many URLs. Visitors are tracked per source so those arriving from
+	// several of its URLs are only counted once.
+	type sourceKey struct{ source, category string }
+	entries := map[sourceKey]*ReferrerEntry{}
+	visitors := map[sourceKey]map[string]bool{}
+	for _, row := range rows {
+		source, category := ClassifyReferrer(row.Referrer)
+		if byCategory {
+			source = ""
+		}
+		key := sourceKey{source, category}
+		entry, ok := entries[key]
+		if !ok {
+			entry = &ReferrerEntry{Source: source, Category: category}
+			entries[key] = entry
+			visitors[key] = map[string]bool{}
+		}
+		entry.Views += row.Views
+		visitors[key][row.Visitor] = true
+	}
+
+	ranked := make([]ReferrerEntry, 0, len(entries))
+	for key, entry := range entries {
+		entry.Visitors = len(visitors[key])
+		ranked = append(ranked, *entry)
+	}
+	sortByVisitors := sortBy == "visitors"
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if sortByVisitors && a.Visitors != b.Visitors {
+			return a.Visitors > b.Visitors
+		}
+		if a.Views != b.Views {
+			return a.Views > b.Views
+		}
+		if a.Visitors != b.Visitors {
+			return a.Visitors > b.Visitors
+		}
+		if a.Category != b.Category {
+			return a.Category < b.Category
+		}
+		return a.Source < b.Source
+	})
+
+	limit, offset := page.bounds()
+	if offset >= len(ranked) {
+		return []ReferrerEntry{}, nil
+	}
+	end := offset + limit
+	if end > len(ranked) {
+		end = len(ranked)
+	}
+	return ranked[offset:end], nil
+}
@@ -0,0 +1,118 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/parkr/ping/database"
+)
+
+func initReferrersDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := database.InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`
+		INSERT INTO visits (ip, visitor_id, host, path, user_agent, referrer, created_at) VALUES
+		('127.0.0.1', '127.0.0.1', 'example.org', '/root', 'go test client', 'https://www.google.com/', '2024-01-01 09:00:00'),
+		('127.0.0.2', '127.0.0.2', 'example.org', '/root', 'go test client', 'https://www.google.co.uk/', '2024-01-01 09:00:00'),
+		('127.0.0.2', '127.0.0.2', 'example.org', '/root', 'go test client', 'https://www.google.com/', '2024-01-01 10:00:00'),
+		('127.0.0.1', '127.0.0.1', 'example.org', '/root', 'go test client', 'https://duckduckgo.com/', '2024-01-01 09:00:00'),
+		('127.0.0.3', '127.0.0.3', 'example.org', '/root', 'go test client', 'https://t.co/abc123', '2024-01-01 09:00:00'),
+		('127.0.0.4', '127.0.0.4', 'example.org', '/root', 'go test client', 'https://blog.example.net/links', '2024-01-01 09:00:00'),
+		('127.0.0.5', '127.0.0.5', 'example.org', '/root', 'go test client', '', '2024-01-01 09:00:00'),
+		('127.0.0.5', '127.0.0.5', 'example.org', '/foo', 'go test client', 'https://news.ycombinator.com/item', '2024-01-01 09:00:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestClassifyReferrer(t *testing.T) {
+	for _, testCase := range []struct {
+		referrer string
+		source   string
+		category string
+	}{
+		{"", "", CategoryDirect},
+		{"https://www.google.com/", "Google", CategorySearch},
+		{"https://google.co.uk/", "Google", CategorySearch},
+		{"https://google.example.com/", "google.example.com", CategoryWebsite},
+		{"https://search.yahoo.co.jp/search", "Yahoo", CategorySearch},
+		{"https://duckduckgo.com/", "DuckDuckGo", CategorySearch},
+		{"https://l.facebook.com/l.php", "Facebook", CategorySocial},
+		{"https://t.co/abc123", "Twitter", CategorySocial},
+		{"https://old.reddit.com/r/golang/", "Reddit", CategorySocial},
+		{"https://news.ycombinator.com/item", "Hacker News", CategorySocial},
+		{"https://www.example.net/blog", "example.net", CategoryWebsite},
+		{"https://WWW.Example.NET:8443/blog", "example.net", CategoryWebsite},
+	} {
+		source, category := ClassifyReferrer(testCase.referrer)
+		if source != testCase.source || category != testCase.category {
+			t.Errorf("ClassifyReferrer(%q) = (%q, %q), want (%q, %q)",
+				testCase.referrer, source, category, testCase.source, testCase.category)
+		}
+	}
+}
+
+func TestReferrers(t *testing.T) {
+	db := initReferrersDB(t)
+
+	entries, err := Referrers(db, Filter{Host: "example.org", Path: "/root"}, Page{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ReferrerEntry{
+		{Source: "Google", Category: CategorySearch, Views: 3, Visitors: 2},
+		{Source: "", Category: CategoryDirect, Views: 1, Visitors: 1},
+		{Source: "DuckDuckGo", Category: CategorySearch, Views: 1, Visitors: 1},
+		{Source: "Twitter", Category: CategorySocial, Views: 1, Visitors: 1},
+		{Source: "blog.example.net", Category: CategoryWebsite, Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestReferrers_ByCategory(t *testing.T) {
+	db := initReferrersDB(t)
+
+	entries, err := Referrers(db, Filter{Host: "example.org"}, Page{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ReferrerEntry{
+		{Category: CategorySearch, Views: 4, Visitors: 2},
+		{Category: CategorySocial, Views: 2, Visitors: 2},
+		{Category: CategoryDirect, Views: 1, Visitors: 1},
+		{Category: CategoryWebsite, Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestReferrers_Paginated(t *testing.T) {
+	db := initReferrersDB(t)
+
+	entries, err := Referrers(db, Filter{Host: "example.org", Path: "/root"}, Page{Limit: 2, Offset: 1}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Category != CategoryDirect || entries[1].Source != "DuckDuckGo" {
+		t.Errorf("expected the second page of two entries, got %+v", entries)
+	}
+
+	entries, err = Referrers(db, Filter{Host: "example.org", Path: "/root"}, Page{Offset: 100}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no entries past the end, got %+v", entries)
+	}
+}
@@ -0,0 +1,150 @@
+package analytics
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/parkr/ping/database"
+	"github.com/parkr/ping/hll"
+)
+
+// splitAtRollupHorizon narrows the filter down to the raw visits which have
+// not been rolled up yet, and reports whether any of the rolled up visits in
+// the visit_rollups table may also match the filter.
+//
+// Rollups hold the views of each host & path per day, and a sketch of their
+// visitors, so visitors counted across rolled up days are an estimate. Rollups
+// made before the sketches were stored only know each day's unique visitors,
+// which are added up.
+func splitAtRollupHorizon(db *sqlx.DB, filter Filter) (raw Filter, rolledUp bool, err error) {
+	horizon, err := database.RollupHorizon(db)
+	if err != nil || horizon.IsZero() {
+		return filter, false, err
+	}
+
+	raw = filter
+	if filter.From.Before(horizon) {
+		raw.From = horizon
+	}
+	return raw, filter.From.Before(horizon), nil
+}
+
+// sumRollups adds up a column of the rollups matching the filter.
+func sumRollups(db *sqlx.DB, column string, filter Filter) (sum int, err error) {
+	where, args := filter.where()
+	err = db.Get(&sum, db.Rebind("SELECT COALESCE(SUM("+column+"), 0) FROM visit_rollups"+where), args...)
+	return sum, err
+}
+
+// rollupVisitors holds the visitors of some rollups: a sketch of them, plus
+// the unique visitors of the rollups without one.
+type rollupVisitors struct {
+	sketch hll.Sketch
+	legacy int
+}
+
+func (v *rollupVisitors) count() int {
+	return v.sketch.Count() + v.legacy
+}
+
+// rollupPeriods adds up the views and visitors of the rollups matching the
+// filter by the period the SQL expression period puts them in, and returns
+// the periods in order.
+func rollupPeriods(db *sqlx.DB, filter Filter, period string) (periods []string, views map[string]int, visitors map[string]*rollupVisitors, err error) {
+	where, args := filter.where()
+	rows, err := db.Queryx(db.Rebind("SELECT "+period+" AS period, views, visitors, visitor_sketch FROM visit_rollups"+where+" ORDER BY period"), args...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
+
+	views, visitors = map[string]int{}, map[string]*rollupVisitors{}
+	for rows.Next() {
+		var row struct {
+			Period   string `db:"period"`
+			Views    int    `db:"views"`
+			Visitors int    `db:"visitors"`
+			Sketch   []byte `db:"visitor_sketch"`
+		}
+		if err := rows.StructScan(&row); err != nil {
+			return nil, nil, nil, err
+		}
+		if visitors[row.Period] == nil {
+			periods = append(periods, row.Period)
+			visitors[row.Period] = &rollupVisitors{}
+		}
+		views[row.Period] += row.Views
+		if row.Sketch == nil {
+			visitors[row.Period].legacy += row.Visitors
+			continue
+		}
+		var sketch hll.Sketch
+		if err := sketch.UnmarshalBinary(row.Sketch); err != nil {
+			return nil, nil, nil, err
+		}
+		visitors[row.Period].sketch.Merge(&sketch)
+	}
+	return periods, views, visitors, rows.Err()
+}
+
+// addRawVisitors adds the visitor IDs of the visits matching the filter to
+// the sketch.
+func addRawVisitors(db *sqlx.DB, filter Filter, sketch *hll.Sketch) error {
+	where, args := filter.where()
+	var visitorIDs []string
+	if err := db.Select(&visitorIDs, db.Rebind("SELECT DISTINCT visitor_id FROM visits"+where), args...); err != nil {
+		return err
+	}
+	for _, visitorID := range visitorIDs {
+		sketch.Add(visitorID)
+	}
+	return nil
+}
+
+// rollupSeries buckets the rollups matching the filter by interval. A bucket
+// which starts before raw.From and ends after it also holds raw visits, whose
+// visitors are counted in the rolled up bucket, so they are only counted once
+// however many times they came back; straddles reports its period, if any.
+func rollupSeries(db *sqlx.DB, filter, raw Filter, interval Interval) (series []Bucket, straddles string, err error) {
+	periods, views, visitors, err := rollupPeriods(db, filter, interval.bucketExpression(db.DriverName()))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if start := interval.Truncate(raw.From); start.Before(raw.From) {
+		period := start.Format(database.SQLDateTimeFormat)
+		if v, ok := visitors[period]; ok {
+			straddled := raw
+			straddled.To = interval.next(start)
+			if !raw.To.IsZero() && raw.To.Before(straddled.To) {
+				straddled.To = raw.To
+			}
+			if err := addRawVisitors(db, straddled, &v.sketch); err != nil {
+				return nil, "", err
+			}
+			straddles = period
+		}
+	}
+
+	series = make([]Bucket, 0, len(periods))
+	for _, period := range periods {
+		series = append(series, Bucket{Period: period, Views: views[period], Visitors: visitors[period].count()})
+	}
+	return series, straddles, nil
+}
+
+// mergeSeries adds up the buckets of two series ordered by period.
+func mergeSeries(a, b []Bucket) []Bucket {
+	merged := make([]Bucket, 0, len(a)+len(b))
+	for len(a) > 0 && len(b) > 0 {
+		switch {
+		case a[0].Period < b[0].Period:
+			merged, a = append(merged, a[0]), a[1:]
+		case b[0].Period < a[0].Period:
+			merged, b = append(merged, b[0]), b[1:]
+		default:
+			merged = append(merged, Bucket{Period: a[0].Period, Views: a[0].Views + b[0].Views, Visitors: a[0].Visitors + b[0].Visitors})
+			a, b = a[1:], b[1:]
+		}
+	}
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
@@ -0,0 +1,110 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/parkr/ping/database"
+)
+
+func TestRollups_CountsSurvivePruning(t *testing.T) {
+	db := initSeriesDB(t)
+	// 127.0.0.1 also comes back the week it first visited, after the days
+	// which are rolled up.
+	_, err := db.Exec(`INSERT INTO visits (ip, visitor_id, host, path, user_agent, created_at) VALUES
+		('127.0.0.1', '127.0.0.1', 'example.org', '/root', 'go test client', '2024-01-04 10:00:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter := Filter{Host: "example.org", Path: "/root"}
+	rangeFilter := Filter{Host: "example.org", Path: "/root", From: date(2024, time.January, 1), To: date(2024, time.January, 15)}
+
+	type counts struct {
+		views, rangeViews, hostPathViews          int
+		visitors, rangeVisitors, hostPathVisitors int
+		daySeries, weekSeries                     []Bucket
+	}
+	count := func() counts {
+		t.Helper()
+		var c counts
+		var err error
+		if c.views, err = Views(db, filter); err != nil {
+			t.Fatal(err)
+		}
+		if c.rangeViews, err = Views(db, rangeFilter); err != nil {
+			t.Fatal(err)
+		}
+		if c.hostPathViews, err = ViewsForHostPath(db, "example.org", "/root"); err != nil {
+			t.Fatal(err)
+		}
+		if c.visitors, err = Visitors(db, filter); err != nil {
+			t.Fatal(err)
+		}
+		if c.rangeVisitors, err = Visitors(db, rangeFilter); err != nil {
+			t.Fatal(err)
+		}
+		if c.hostPathVisitors, err = VisitorsForHostPath(db, "example.org", "/root"); err != nil {
+			t.Fatal(err)
+		}
+		if c.daySeries, err = Series(db, rangeFilter, IntervalDay); err != nil {
+			t.Fatal(err)
+		}
+		if c.weekSeries, err = Series(db, rangeFilter, IntervalWeek); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	before := count()
+	if before.visitors != 3 || before.weekSeries[0].Visitors != 3 {
+		t.Fatalf("expected 3 visitors in all and in the first week, got %+v", before)
+	}
+
+	// Prune everything before 2024-01-03 a batch at a time, checking the
+	// counts are unchanged after every batch. The handful of visitors here
+	// are counted exactly, even once rolled up.
+	for {
+		deleted, err := database.PruneVisits(db, date(2024, time.January, 3), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted == 0 {
+			break
+		}
+		if after := count(); !reflect.DeepEqual(before, after) {
+			t.Fatalf("expected counts %+v to survive pruning, got %+v", before, after)
+		}
+	}
+
+	paths, err := AllPaths(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(paths, []string{"/root", "/foo"}) {
+		t.Errorf("expected rolled up paths to be listed, got %v", paths)
+	}
+}
+
+func TestRollups_WithoutSketches(t *testing.T) {
+	db := initSeriesDB(t)
+	if _, err := database.PruneVisits(db, date(2024, time.January, 3), 100); err != nil {
+		t.Fatal(err)
+	}
+	// Rollups made before visitor sketches were stored only have the unique
+	// visitors of their day.
+	if _, err := db.Exec("UPDATE visit_rollups SET visitor_sketch = NULL"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 127.0.0.1 and 127.0.0.2 on the rolled up 2024-01-01, and 127.0.0.1 again
+	// among the raw visits.
+	visitors, err := Visitors(db, Filter{Host: "example.org", Path: "/root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visitors != 4 {
+		t.Errorf("expected the rolled up visitors to be added to the 2 raw ones, got %d", visitors)
+	}
+}
@@ -0,0 +1,202 @@
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/parkr/ping/database"
+)
+
+// Interval is the width of the buckets in a time series.
+type Interval string
+
+const (
+	IntervalHour  Interval = "hour"
+	IntervalDay   Interval = "day"
+	IntervalWeek  Interval = "week"
+	IntervalMonth Interval = "month"
+)
+
+// MaxBuckets is the largest number of buckets a single series may span.
+const MaxBuckets = 5000
+
+// ErrInvalidRange is returned for a series over a time range which is empty or
+// would span more than MaxBuckets buckets.
+var ErrInvalidRange = errors.New("invalid range")
+
+// ParseInterval validates an interval name from user input.
+func ParseInterval(name string) (Interval, error) {
+	switch interval := Interval(name); interval {
+	case IntervalHour, IntervalDay, IntervalWeek, IntervalMonth:
+		return interval, nil
+	default:
+		return "", fmt.Errorf("unknown interval %q, expected hour, day, week or month", name)
+	}
+}
+
+// Truncate rounds t down to the start of the bucket containing it. Weeks
+// start on Monday.
+func (i Interval) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch i {
+	case IntervalHour:
+		return t.Truncate(time.Hour)
+	case IntervalWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// next returns the start of the bucket following the one starting at t.
+func (i Interval) next(t time.Time) time.Time {
+	switch i {
+	case IntervalHour:
+		return t.Add(time.Hour)
+	case IntervalWeek:
+		return t.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// bucketExpression returns the SQL expression which formats created_at as the
+// start of its bucket, in database.SQLDateTimeFormat.
+func (i Interval) bucketExpression(driverName string) string {
+	if driverName == database.DriverPostgres {
+		return fmt.Sprintf("to_char(date_trunc('%s', created_at), 'YYYY-MM-DD HH24:MI:SS')", i)
+	}
+	switch i {
+	case IntervalHour:
+		return "strftime('%Y-%m-%d %H:00:00', created_at)"
+	case IntervalWeek:
+		return "strftime('%Y-%m-%d 00:00:00', created_at, 'weekday 0', '-6 days')"
+	case IntervalMonth:
+		return "strftime('%Y-%m-01 00:00:00', created_at)"
+	default:
+		return "strftime('%Y-%m-%d 00:00:00', created_at)"
+	}
+}
+
+// Bucket holds the views and visitors for a single period of a time series.
+type Bucket struct {
+	// Period is the start of the bucket, in database.SQLDateTimeFormat.
+	Period   string `db:"period" json:"period"`
+	Views    int    `db:"views" json:"views"`
+	Visitors int    `db:"visitors" json:"visitors"`
+}
+
+// Fetch the number of views matching the filter, including those which have
+// been rolled up.
+func Views(db *sqlx.DB, filter Filter) (count int, err error) {
+	raw, rolledUp, err := splitAtRollupHorizon(db, filter)
+	if err != nil {
+		return 0, err
+	}
+	where, args := raw.where()
+	if err = db.Get(&count, db.Rebind("SELECT COUNT(id) FROM visits"+where), args...); err != nil || !rolledUp {
+		return count, err
+	}
+	rolledUpCount, err := sumRollups(db, "views", filter)
+	return count + rolledUpCount, err
+}
+
+// Fetch the number of unique visitors matching the filter, including those
+// which have been rolled up. Once rolled up visits match, the count is an
+// estimate.
+func Visitors(db *sqlx.DB, filter Filter) (count int, err error) {
+	raw, rolledUp, err := splitAtRollupHorizon(db, filter)
+	if err != nil {
+		return 0, err
+	}
+	if rolledUp {
+		_, _, visitors, err := rollupPeriods(db, filter, "''")
+		if err != nil {
+			return 0, err
+		}
+		if v, ok := visitors[""]; ok {
+			err = addRawVisitors(db, raw, &v.sketch)
+			return v.count(), err
+		}
+	}
+	where, args := raw.where()
+	err = db.Get(&count, db.Rebind("SELECT COUNT(DISTINCT visitor_id) FROM visits"+where), args...)
+	return count, err
+}
+
+// Fetch the views and visitors matching the filter, bucketed by interval. If
+// the filter has both a From and a To, every bucket between them is present
+// in the series, even those without any visits. Rolled up visits are counted
+// at the start of their day, and their visitors are estimated.
+func Series(db *sqlx.DB, filter Filter, interval Interval) ([]Bucket, error) {
+	if !filter.From.IsZero() && !filter.To.IsZero() {
+		if !filter.From.Before(filter.To) {
+			return nil, fmt.Errorf("%w: from (%s) must be before to (%s)", ErrInvalidRange, filter.From, filter.To)
+		}
+		buckets := 0
+		for t := interval.Truncate(filter.From); t.Before(filter.To); t = interval.next(t) {
+			if buckets++; buckets > MaxBuckets {
+				return nil, fmt.Errorf("%w: series would have more than %d buckets, use a shorter range or a longer interval", ErrInvalidRange, MaxBuckets)
+			}
+		}
+	}
+
+	raw, rolledUp, err := splitAtRollupHorizon(db, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	where, args := raw.where()
+	bucket := interval.bucketExpression(db.DriverName())
+	query := "SELECT " + bucket + " AS period, COUNT(id) AS views, COUNT(DISTINCT visitor_id) AS visitors FROM visits" +
+		where + " GROUP BY period ORDER BY period"
+
+	series := []Bucket{}
+	if err := db.Select(&series, db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+	if rolledUp {
+		rollups, straddles, err := rollupSeries(db, filter, raw, interval)
+		if err != nil {
+			return nil, err
+		}
+		for i := range series {
+			if series[i].Period == straddles {
+				series[i].Visitors = 0
+			}
+		}
+		series = mergeSeries(rollups, series)
+	}
+
+	if filter.From.IsZero() || filter.To.IsZero() {
+		return series, nil
+	}
+	return fillSeries(series, filter, interval), nil
+}
+
+// fillSeries adds empty buckets for the periods in the filter's time range
+// which had no visits.
+func fillSeries(series []Bucket, filter Filter, interval Interval) []Bucket {
+	byPeriod := make(map[string]Bucket, len(series))
+	for _, bucket := range series {
+		byPeriod[bucket.Period] = bucket
+	}
+
+	filled := []Bucket{}
+	for t := interval.Truncate(filter.From); t.Before(filter.To); t = interval.next(t) {
+		period := t.Format(database.SQLDateTimeFormat)
+		if bucket, ok := byPeriod[period]; ok {
+			filled = append(filled, bucket)
+		} else {
+			filled = append(filled, Bucket{Period: period})
+		}
+	}
+	return filled
+}
@@ -0,0 +1,212 @@
+package analytics
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/parkr/ping/database"
+)
+
+func initSeriesDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := database.InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`
+		INSERT INTO visits (ip, visitor_id, host, path, user_agent, created_at) VALUES
+		('127.0.0.1', '127.0.0.1', 'example.org', '/root', 'go test client', '2024-01-01 09:15:00'),
+		('127.0.0.1', '127.0.0.1', 'example.org', '/root', 'go test client', '2024-01-01 09:45:00'),
+		('127.0.0.2', '127.0.0.2', 'example.org', '/root', 'go test client', '2024-01-01 17:00:00'),
+		('127.0.0.3', '127.0.0.3', 'example.org', '/root', 'go test client', '2024-01-03 12:00:00'),
+		('127.0.0.1', '127.0.0.1', 'example.org', '/root', 'go test client', '2024-01-08 00:00:00'),
+		('127.0.0.1', '127.0.0.1', 'example.org', '/root', 'go test client', '2024-02-14 08:00:00'),
+		('127.0.0.1', '127.0.0.1', 'example.org', '/foo', 'go test client', '2024-01-01 09:00:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParseInterval(t *testing.T) {
+	for _, name := range []string{"hour", "day", "week", "month"} {
+		if interval, err := ParseInterval(name); err != nil || string(interval) != name {
+			t.Errorf("ParseInterval(%q) = (%q, %v)", name, interval, err)
+		}
+	}
+	if _, err := ParseInterval("fortnight"); err == nil {
+		t.Error("expected an error parsing an unknown interval")
+	}
+}
+
+func TestIntervalTruncate(t *testing.T) {
+	moment := time.Date(2024, time.January, 3, 12, 34, 56, 0, time.UTC) // A Wednesday.
+	for interval, expected := range map[Interval]time.Time{
+		IntervalHour:  time.Date(2024, time.January, 3, 12, 0, 0, 0, time.UTC),
+		IntervalDay:   date(2024, time.January, 3),
+		IntervalWeek:  date(2024, time.January, 1),
+		IntervalMonth: date(2024, time.January, 1),
+	} {
+		if actual := interval.Truncate(moment); !actual.Equal(expected) {
+			t.Errorf("%s: expected %s, got %s", interval, expected, actual)
+		}
+	}
+
+	sunday := date(2024, time.January, 7)
+	if actual := IntervalWeek.Truncate(sunday); !actual.Equal(date(2024, time.January, 1)) {
+		t.Errorf("expected Sunday to be in the week starting Monday, got %s", actual)
+	}
+}
+
+func TestViewsAndVisitors_TimeRange(t *testing.T) {
+	db := initSeriesDB(t)
+
+	filter := Filter{Host: "example.org", Path: "/root", From: date(2024, time.January, 1), To: date(2024, time.January, 2)}
+
+	views, err := Views(db, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if views != 3 {
+		t.Errorf("expected 3 views, got %d", views)
+	}
+
+	visitors, err := Visitors(db, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visitors != 2 {
+		t.Errorf("expected 2 visitors, got %d", visitors)
+	}
+}
+
+func TestSeries_Day(t *testing.T) {
+	db := initSeriesDB(t)
+
+	series, err := Series(db, Filter{Host: "example.org", Path: "/root", From: date(2024, time.January, 1), To: date(2024, time.January, 4)}, IntervalDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Bucket{
+		{Period: "2024-01-01 00:00:00", Views: 3, Visitors: 2},
+		{Period: "2024-01-02 00:00:00", Views: 0, Visitors: 0},
+		{Period: "2024-01-03 00:00:00", Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(series, expected) {
+		t.Errorf("expected %+v, got %+v", expected, series)
+	}
+}
+
+func TestSeries_Hour(t *testing.T) {
+	db := initSeriesDB(t)
+
+	series, err := Series(db, Filter{Host: "example.org", Path: "/root", To: date(2024, time.January, 2)}, IntervalHour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Bucket{
+		{Period: "2024-01-01 09:00:00", Views: 2, Visitors: 1},
+		{Period: "2024-01-01 17:00:00", Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(series, expected) {
+		t.Errorf("expected %+v, got %+v", expected, series)
+	}
+}
+
+func TestSeries_Week(t *testing.T) {
+	db := initSeriesDB(t)
+
+	series, err := Series(db, Filter{Host: "example.org", Path: "/root", To: date(2024, time.February, 1)}, IntervalWeek)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Bucket{
+		{Period: "2024-01-01 00:00:00", Views: 4, Visitors: 3},
+		{Period: "2024-01-08 00:00:00", Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(series, expected) {
+		t.Errorf("expected %+v, got %+v", expected, series)
+	}
+}
+
+func TestSeries_Month(t *testing.T) {
+	db := initSeriesDB(t)
+
+	series, err := Series(db, Filter{Host: "example.org", Path: "/root"}, IntervalMonth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Bucket{
+		{Period: "2024-01-01 00:00:00", Views: 5, Visitors: 3},
+		{Period: "2024-02-01 00:00:00", Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(series, expected) {
+		t.Errorf("expected %+v, got %+v", expected, series)
+	}
+}
+
+func TestSeries_InvalidRange(t *testing.T) {
+	db := initSeriesDB(t)
+
+	if _, err := Series(db, Filter{From: date(2024, time.January, 2), To: date(2024, time.January, 1)}, IntervalDay); !errors.Is(err, ErrInvalidRange) {
+		t.Error("expected an error when from is after to")
+	}
+
+	if _, err := Series(db, Filter{From: date(2000, time.January, 1), To: date(2024, time.January, 1)}, IntervalHour); !errors.Is(err, ErrInvalidRange) {
+		t.Error("expected an error when the series has too many buckets")
+	}
+}
+
+func TestViewsAndVisitors_Bots(t *testing.T) {
+	db := initSeriesDB(t)
+	_, err := db.Exec(`
+		INSERT INTO visits (ip, visitor_id, host, path, user_agent, is_bot, created_at) VALUES
+		('127.0.0.4', '127.0.0.4', 'example.org', '/root', 'Googlebot/2.1', 1, '2024-01-01 09:00:00'),
+		('127.0.0.4', '127.0.0.4', 'example.org', '/root', 'Googlebot/2.1', 1, '2024-01-02 09:00:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for bots, expected := range map[Bots][2]int{
+		BotsExcluded: {6, 3},
+		BotsIncluded: {8, 4},
+		BotsOnly:     {2, 1},
+	} {
+		filter := Filter{Host: "example.org", Path: "/root", Bots: bots}
+		views, err := Views(db, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		visitors, err := Visitors(db, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if views != expected[0] || visitors != expected[1] {
+			t.Errorf("bots %q: expected %d views and %d visitors, got %d and %d", bots, expected[0], expected[1], views, visitors)
+		}
+	}
+}
+
+func TestParseBots(t *testing.T) {
+	for name, expected := range map[string]Bots{"": BotsExcluded, "exclude": BotsExcluded, "include": BotsIncluded, "only": BotsOnly} {
+		bots, err := ParseBots(name)
+		if err != nil || bots != expected {
+			t.Errorf("expected %q to parse as %q, got %q (%v)", name, expected, bots, err)
+		}
+	}
+	if _, err := ParseBots("sometimes"); err == nil {
+		t.Error("expected an error for an unknown bots option")
+	}
+}
@@ -0,0 +1,75 @@
+package analytics
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+// SessionStats summarizes the sessions matching a filter.
+type SessionStats struct {
+	Sessions int `json:"sessions"`
+	// BounceRate is the fraction of sessions which viewed a single page.
+	BounceRate float64 `json:"bounce_rate"`
+	// AverageDuration is the mean number of seconds between the first and
+	// last page views of a session. Bounces last 0 seconds.
+	AverageDuration float64 `json:"average_duration"`
+	// PageviewsPerSession is the mean number of pages viewed in a session.
+	PageviewsPerSession float64 `json:"pageviews_per_session"`
+}
+
+// Summarize the sessions which started within the filter. The path of the
+// filter matches the entry page of the session.
+func Sessions(db *sqlx.DB, filter Filter) (SessionStats, error) {
+	where, args := filter.whereColumns("entry_path", "started_at")
+	query := `SELECT COUNT(id) AS sessions,
+		COALESCE(SUM(CASE WHEN pageviews = 1 THEN 1 ELSE 0 END), 0) AS bounces,
+		COALESCE(SUM(duration), 0) AS duration,
+		COALESCE(SUM(pageviews), 0) AS pageviews
+		FROM sessions` + where
+
+	var totals struct {
+		Sessions  int `db:"sessions"`
+		Bounces   int `db:"bounces"`
+		Duration  int `db:"duration"`
+		Pageviews int `db:"pageviews"`
+	}
+	if err := db.Get(&totals, db.Rebind(query), args...); err != nil {
+		return SessionStats{}, err
+	}
+
+	stats := SessionStats{Sessions: totals.Sessions}
+	if totals.Sessions > 0 {
+		sessions := float64(totals.Sessions)
+		stats.BounceRate = float64(totals.Bounces) / sessions
+		stats.AverageDuration = float64(totals.Duration) / sessions
+		stats.PageviewsPerSession = float64(totals.Pageviews) / sessions
+	}
+	return stats, nil
+}
+
+// Fetch the paths which sessions matching the filter most often started on,
+// with the number of sessions as their views and the unique visitors who
+// started them. The path of the filter matches the entry page.
+func TopEntryPages(db *sqlx.DB, filter Filter, page Page) ([]Entry, error) {
+	return topSessionPages(db, "entry_path", filter, page)
+}
+
+// Fetch the paths which sessions matching the filter most often ended on,
+// with the number of sessions as their views and the unique visitors who
+// ended them. The path of the filter matches the exit page.
+func TopExitPages(db *sqlx.DB, filter Filter, page Page) ([]Entry, error) {
+	return topSessionPages(db, "exit_path", filter, page)
+}
+
+func topSessionPages(db *sqlx.DB, pathColumn string, filter Filter, page Page) ([]Entry, error) {
+	orderBy, err := page.orderBy("host, path")
+	if err != nil {
+		return nil, err
+	}
+	where, args := filter.whereColumns(pathColumn, "started_at")
+	query := "SELECT host, " + pathColumn + " AS path, COUNT(id) AS views, COUNT(DISTINCT visitor_id) AS visitors FROM sessions" +
+		where + " GROUP BY host, " + pathColumn + orderBy
+
+	entries := []Entry{}
+	err = db.Select(&entries, db.Rebind(query), args...)
+	return entries, err
+}
@@ -0,0 +1,91 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/parkr/ping/database"
+)
+
+func initSessionsDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := database.InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`
+		INSERT INTO sessions (visitor_id, host, entry_path, exit_path, pageviews, duration, is_bot, started_at, last_seen_at) VALUES
+		('a', 'example.org', '/root', '/foo', 3, 120, 0, '2024-01-01 09:00:00', '2024-01-01 09:02:00'),
+		('a', 'example.org', '/root', '/root', 1, 0, 0, '2024-01-02 09:00:00', '2024-01-02 09:00:00'),
+		('b', 'example.org', '/foo', '/foo', 1, 0, 0, '2024-01-01 09:00:00', '2024-01-01 09:00:00'),
+		('c', 'example.org', '/root', '/bar', 2, 60, 0, '2024-02-01 09:00:00', '2024-02-01 09:01:00'),
+		('d', 'example.com', '/', '/', 1, 0, 0, '2024-01-01 09:00:00', '2024-01-01 09:00:00'),
+		('e', 'example.org', '/root', '/root', 1, 0, 1, '2024-01-01 09:00:00', '2024-01-01 09:00:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSessions(t *testing.T) {
+	db := initSessionsDB(t)
+
+	for _, testCase := range []struct {
+		filter   Filter
+		expected SessionStats
+	}{
+		{Filter{Host: "example.org"}, SessionStats{Sessions: 4, BounceRate: 0.5, AverageDuration: 45, PageviewsPerSession: 1.75}},
+		{Filter{Host: "example.org", Path: "/root"}, SessionStats{Sessions: 3, BounceRate: 1.0 / 3, AverageDuration: 60, PageviewsPerSession: 2}},
+		{
+			Filter{Host: "example.org", From: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)},
+			SessionStats{Sessions: 2, BounceRate: 0.5, AverageDuration: 60, PageviewsPerSession: 2},
+		},
+		{Filter{Host: "example.org", Bots: BotsOnly}, SessionStats{Sessions: 1, BounceRate: 1, PageviewsPerSession: 1}},
+		{Filter{Host: "example.net"}, SessionStats{}},
+	} {
+		actual, err := Sessions(db, testCase.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != testCase.expected {
+			t.Errorf("expected sessions %+v for %+v, got: %+v", testCase.expected, testCase.filter, actual)
+		}
+	}
+}
+
+func TestTopEntryAndExitPages(t *testing.T) {
+	db := initSessionsDB(t)
+	filter := Filter{Host: "example.org"}
+
+	entries, err := TopEntryPages(db, filter, Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entry{
+		{Host: "example.org", Path: "/root", Views: 3, Visitors: 2},
+		{Host: "example.org", Path: "/foo", Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected entry pages %+v, got: %+v", expected, entries)
+	}
+
+	entries, err = TopExitPages(db, filter, Page{SortBy: "visitors"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []Entry{
+		{Host: "example.org", Path: "/foo", Views: 2, Visitors: 2},
+		{Host: "example.org", Path: "/bar", Views: 1, Visitors: 1},
+		{Host: "example.org", Path: "/root", Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected exit pages %+v, got: %+v", expected, entries)
+	}
+
+	if _, err := TopExitPages(db, filter, Page{SortBy: "sessions"}); err == nil {
+		t.Error("expected an error sorting by an unknown column")
+	}
+}
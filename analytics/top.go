@@ -0,0 +1,109 @@
+package analytics
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// DefaultLimit is the number of entries in a page of results when no
+	// limit is given.
+	DefaultLimit = 10
+	// MaxLimit is the largest number of entries in a single page of results.
+	MaxLimit = 100
+)
+
+// ErrInvalidPage is returned for a page which cannot be sorted as requested.
+var ErrInvalidPage = errors.New("invalid page")
+
+// Page selects an ordered page of ranked results.
+type Page struct {
+	// SortBy is "views" (the default) or "visitors". Results are always in
+	// descending order.
+	SortBy string
+	Limit  int
+	Offset int
+}
+
+// sortColumn validates the column the page is sorted by.
+func (p Page) sortColumn() (string, error) {
+	switch p.SortBy {
+	case "":
+		return "views", nil
+	case "views", "visitors":
+		return p.SortBy, nil
+	default:
+		return "", fmt.Errorf("%w: unable to sort by %q, expected views or visitors", ErrInvalidPage, p.SortBy)
+	}
+}
+
+// orderBy returns the ORDER BY, LIMIT and OFFSET clauses for the page, with
+// ties broken by the given columns.
+func (p Page) orderBy(tiebreakers string) (string, error) {
+	sortBy, err := p.sortColumn()
+	if err != nil {
+		return "", err
+	}
+	limit, offset := p.bounds()
+	return fmt.Sprintf(" ORDER BY %s DESC, %s LIMIT %d OFFSET %d", sortBy, tiebreakers, limit, offset), nil
+}
+
+// bounds returns the limit and offset of the page, clamped to sensible
+// values.
+func (p Page) bounds() (limit, offset int) {
+	limit = p.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	offset = p.Offset
+	if offset < 0 {
+		offset = 0
+	}
+	return limit, offset
+}
+
+// Entry is a single ranked row of a leaderboard.
+type Entry struct {
+	Host     string `db:"host" json:"host"`
+	Path     string `db:"path" json:"path,omitempty"`
+	Views    int    `db:"views" json:"views"`
+	Visitors int    `db:"visitors" json:"visitors"`
+}
+
+// Fetch the most viewed paths matching the filter, with their views and
+// unique visitors. Without a host in the filter, paths are ranked across all
+// hosts.
+func TopPaths(db *sqlx.DB, filter Filter, page Page) ([]Entry, error) {
+	orderBy, err := page.orderBy("host, path")
+	if err != nil {
+		return nil, err
+	}
+	where, args := filter.where()
+	query := "SELECT host, path, COUNT(id) AS views, COUNT(DISTINCT visitor_id) AS visitors FROM visits" +
+		where + " GROUP BY host, path" + orderBy
+
+	entries := []Entry{}
+	err = db.Select(&entries, db.Rebind(query), args...)
+	return entries, err
+}
+
+// Fetch the most viewed hosts matching the filter, with their views and
+// unique visitors.
+func TopHosts(db *sqlx.DB, filter Filter, page Page) ([]Entry, error) {
+	orderBy, err := page.orderBy("host")
+	if err != nil {
+		return nil, err
+	}
+	where, args := filter.where()
+	query := "SELECT host, COUNT(id) AS views, COUNT(DISTINCT visitor_id) AS visitors FROM visits" +
+		where + " GROUP BY host" + orderBy
+
+	entries := []Entry{}
+	err = db.Select(&entries, db.Rebind(query), args...)
+	return entries, err
+}
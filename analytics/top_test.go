@@ -0,0 +1,112 @@
+package analytics
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/parkr/ping/database"
+)
+
+func initTopDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := database.InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	_, err = db.Exec(`
+		INSERT INTO visits (ip, visitor_id, host, path, user_agent, created_at) VALUES
+		('127.0.0.1', '127.0.0.1', 'example.org', '/popular', 'go test client', '2024-01-01 09:00:00'),
+		('127.0.0.1', '127.0.0.1', 'example.org', '/popular', 'go test client', '2024-01-01 10:00:00'),
+		('127.0.0.1', '127.0.0.1', 'example.org', '/popular', 'go test client', '2024-01-01 11:00:00'),
+		('127.0.0.1', '127.0.0.1', 'example.org', '/shared', 'go test client', '2024-01-01 09:00:00'),
+		('127.0.0.2', '127.0.0.2', 'example.org', '/shared', 'go test client', '2024-01-01 09:00:00'),
+		('127.0.0.1', '127.0.0.1', 'example.org', '/old', 'go test client', '2023-06-01 09:00:00'),
+		('127.0.0.1', '127.0.0.1', 'example.com', '/', 'go test client', '2024-01-02 09:00:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestTopPaths(t *testing.T) {
+	db := initTopDB(t)
+
+	entries, err := TopPaths(db, Filter{Host: "example.org"}, Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Entry{
+		{Host: "example.org", Path: "/popular", Views: 3, Visitors: 1},
+		{Host: "example.org", Path: "/shared", Views: 2, Visitors: 2},
+		{Host: "example.org", Path: "/old", Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestTopPaths_SortByVisitorsWithinTimeRange(t *testing.T) {
+	db := initTopDB(t)
+
+	filter := Filter{From: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)}
+	entries, err := TopPaths(db, filter, Page{SortBy: "visitors"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Entry{
+		{Host: "example.org", Path: "/shared", Views: 2, Visitors: 2},
+		{Host: "example.com", Path: "/", Views: 1, Visitors: 1},
+		{Host: "example.org", Path: "/popular", Views: 3, Visitors: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestTopPaths_Paginated(t *testing.T) {
+	db := initTopDB(t)
+
+	entries, err := TopPaths(db, Filter{}, Page{Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Entry{
+		{Host: "example.org", Path: "/shared", Views: 2, Visitors: 2},
+		{Host: "example.com", Path: "/", Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestTopPaths_InvalidSort(t *testing.T) {
+	db := initTopDB(t)
+
+	if _, err := TopPaths(db, Filter{}, Page{SortBy: "id; DROP TABLE visits"}); !errors.Is(err, ErrInvalidPage) {
+		t.Error("expected an error sorting by an unknown column")
+	}
+}
+
+func TestTopHosts(t *testing.T) {
+	db := initTopDB(t)
+
+	entries, err := TopHosts(db, Filter{}, Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Entry{
+		{Host: "example.org", Views: 6, Visitors: 2},
+		{Host: "example.com", Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
@@ -0,0 +1,93 @@
+package ping
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/parkr/ping/database"
+	"github.com/parkr/ping/sites"
+)
+
+// These are the reasons a request with an API token is refused.
+var (
+	errMissingToken     = errors.New("missing bearer token")
+	errInvalidToken     = errors.New("invalid token")
+	errTokenScope       = errors.New("token does not allow this")
+	errTokenHostMissing = errors.New("token is only valid with a host param")
+	errTokenHost        = errors.New("token is not valid for this host")
+	errTokenAllSites    = errors.New("token is only valid for a single site")
+)
+
+// bearerToken returns the token in the Authorization header of r, if it has
+// one.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// authorizeToken checks that token grants scope for host. A token for a
+// single site needs host to be one of the site's hosts.
+func authorizeToken(token, scope, host string) error {
+	record, err := db.GetAPIToken(token)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return errInvalidToken
+	}
+	if !record.Allows(scope) {
+		return errTokenScope
+	}
+	if record.Host != "" {
+		if host == "" {
+			return errTokenHostMissing
+		}
+		if !sites.Match(record.Host, host) {
+			return errTokenHost
+		}
+	}
+	return nil
+}
+
+// tokenAuthMiddleware requires a bearer token which can read the reports of
+// the host param. Reports on every site, which ignore the host param, need a
+// token for all sites.
+type tokenAuthMiddleware struct {
+	next     http.Handler
+	allSites bool
+}
+
+func (m tokenAuthMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := bearerToken(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ping"`)
+		jsonError(w, http.StatusUnauthorized, errMissingToken.Error())
+		return
+	}
+	host := r.FormValue("host")
+	if m.allSites {
+		host = ""
+	}
+	err := authorizeToken(token, database.ScopeRead, host)
+	if err == errTokenHostMissing && m.allSites {
+		err = errTokenAllSites
+	}
+	switch err {
+	case nil:
+		m.next.ServeHTTP(w, r)
+	case errInvalidToken:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ping", error="invalid_token"`)
+		jsonError(w, http.StatusUnauthorized, err.Error())
+	case errTokenScope, errTokenHostMissing, errTokenHost, errTokenAllSites:
+		jsonError(w, http.StatusForbidden, err.Error())
+	default:
+		log.Println("Error looking up API token:", err)
+		jsonError(w, http.StatusInternalServerError, "unable to look up token")
+	}
+}
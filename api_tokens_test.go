@@ -0,0 +1,107 @@
+package ping
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/parkr/ping/database"
+)
+
+func createTestToken(t *testing.T, host, scope string) string {
+	t.Helper()
+	token, _, err := database.CreateAPIToken(db.DB(), "test", host, scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestAPITokens_Reports(t *testing.T) {
+	handler := newTestHandler(t, []string{"example.org"}, []*database.Visit{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/post", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00"},
+		{IP: "127.0.0.1", Host: "example.com", Path: "/other-site", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00"},
+	}, WithAPITokens("/counts"))
+	allSites := createTestToken(t, "", database.ScopeRead)
+	oneSite := createTestToken(t, "example.org", database.ScopeRead)
+
+	testCases := []struct {
+		name         string
+		target       string
+		token        string
+		expectedCode int
+	}{
+		{"public report", "/counts?host=example.org&path=/post", "", http.StatusOK},
+		{"no token", "/top?host=example.org", "", http.StatusUnauthorized},
+		{"invalid token", "/top?host=example.org", "ping_nope", http.StatusUnauthorized},
+		{"all sites", "/top", allSites, http.StatusOK},
+		{"all sites listing hosts", "/all?type=host", allSites, http.StatusOK},
+		{"one site", "/top?host=example.org", oneSite, http.StatusOK},
+		{"one site without host", "/top", oneSite, http.StatusForbidden},
+		{"one site listing hosts", "/all?type=host", oneSite, http.StatusForbidden},
+		{"one site listing paths", "/all?host=example.org&type=path", oneSite, http.StatusForbidden},
+		{"another site", "/top?host=example.com", oneSite, http.StatusForbidden},
+	}
+	for _, testCase := range testCases {
+		request, err := http.NewRequest("GET", testCase.target, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if testCase.token != "" {
+			request.Header.Set("Authorization", "Bearer "+testCase.token)
+		}
+		recorder := serve(handler, request)
+
+		if recorder.Code != testCase.expectedCode {
+			t.Errorf("%s: expected status code %d, got: %d %s", testCase.name, testCase.expectedCode, recorder.Code, recorder.Body)
+		}
+		if testCase.token == oneSite && strings.Contains(recorder.Body.String(), "/other-site") {
+			t.Errorf("%s: expected no paths from another site, got: %s", testCase.name, recorder.Body)
+		}
+		if recorder.Code == http.StatusUnauthorized && recorder.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate header", testCase.name)
+		}
+	}
+}
+
+func TestAPITokens_Submit(t *testing.T) {
+	handler := newTestHandler(t, []string{"example.org"}, nil)
+	write := createTestToken(t, "example.org", database.ScopeWrite)
+	read := createTestToken(t, "example.org", database.ScopeRead)
+
+	testCases := []struct {
+		name         string
+		token        string
+		expectedCode int
+		expectedBody string
+	}{
+		{"write token", write, http.StatusCreated, "(function(){})();"},
+		{"read token", read, http.StatusUnauthorized, `(function(){console.error("token does not allow this")})();`},
+	}
+	for _, testCase := range testCases {
+		params := url.Values{"host": {"example.org"}, "path": {"/server-rendered"}, ipParam: {"203.0.113.7"}}
+		request, err := http.NewRequest("POST", "/submit?"+params.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Authorization", "Bearer "+testCase.token)
+		request.Header.Set("User-Agent", "go test client")
+		recorder := serve(handler, request)
+
+		if recorder.Code != testCase.expectedCode {
+			t.Errorf("%s: expected status code %d, got: %d %s", testCase.name, testCase.expectedCode, recorder.Code, recorder.Body)
+		}
+		if recorder.Body.String() != testCase.expectedBody {
+			t.Errorf("%s: expected body %s, got: %s", testCase.name, testCase.expectedBody, recorder.Body)
+		}
+	}
+
+	var ip string
+	if err := db.DB().Get(&ip, "SELECT ip FROM visits"); err != nil {
+		t.Fatal(err)
+	}
+	if ip != "203.0.113.7" {
+		t.Errorf("expected the visitor's IP from the ip param, got: %q", ip)
+	}
+}
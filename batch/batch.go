@@ -0,0 +1,267 @@
+// Package batch saves visits in the background, in batches, so recording a
+// visit never waits on the database.
+package batch
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/parkr/ping/database"
+)
+
+const (
+	DefaultQueueSize     = 10000
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+)
+
+var (
+	// ErrQueueFull is returned when a visit couldn't be queued before its
+	// context was done.
+	ErrQueueFull = errors.New("visit queue is full")
+	// ErrClosed is returned when a visit is queued after the Writer was
+	// closed.
+	ErrClosed = errors.New("visit writer is closed")
+)
+
+// Saver saves a batch of visits in a single transaction, like
+// store.Store.SaveVisits.
+type Saver interface {
+	SaveVisits(visits []*database.Visit) error
+}
+
+// SaverFunc adapts a function to a Saver.
+type SaverFunc func(visits []*database.Visit) error
+
+func (f SaverFunc) SaveVisits(visits []*database.Visit) error {
+	return f(visits)
+}
+
+// Config tunes a Writer. The zero value of each field uses its default.
+type Config struct {
+	// QueueSize is the most visits waiting to be saved at once.
+	QueueSize int
+	// BatchSize is the most visits saved in a single transaction. A batch is
+	// saved as soon as it is full.
+	BatchSize int
+	// FlushInterval is the longest a visit waits before its batch is saved.
+	FlushInterval time.Duration
+}
+
+// Stats describe the work a Writer has done so far.
+type Stats struct {
+	QueueDepth    int `json:"queue_depth"`
+	QueueCapacity int `json:"queue_capacity"`
+	// Queued counts the visits accepted, and Rejected those turned away
+	// because the queue was full or closed.
+	Queued   int64 `json:"queued"`
+	Rejected int64 `json:"rejected"`
+	// Saved counts the visits saved, and Failed those lost because they
+	// couldn't be saved, even on their own once their batch failed.
+	Saved   int64 `json:"saved"`
+	Failed  int64 `json:"failed"`
+	Flushes int64 `json:"flushes"`
+	// The latency of saving a batch, in seconds.
+	LastFlushSeconds  float64 `json:"last_flush_seconds"`
+	MaxFlushSeconds   float64 `json:"max_flush_seconds"`
+	TotalFlushSeconds float64 `json:"total_flush_seconds"`
+}
+
+// Writer queues visits and saves them in batches from a single goroutine.
+type Writer struct {
+	saver  Saver
+	config Config
+	queue  chan *database.Visit
+
+	// closing guards closed and sending on queue, so queue is never sent on
+	// once it has been closed.
+	closing sync.RWMutex
+	closed  bool
+	stopped chan struct{}
+	// flushes asks the goroutine to save every queued visit, and to close
+	// the channel sent once they're saved.
+	flushes chan chan struct{}
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// NewWriter starts a Writer which saves visits with saver.
+func NewWriter(saver Saver, config Config) *Writer {
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = DefaultFlushInterval
+	}
+	w := &Writer{
+		saver:   saver,
+		config:  config,
+		queue:   make(chan *database.Visit, config.QueueSize),
+		stopped: make(chan struct{}),
+		flushes: make(chan chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Enqueue queues the visit to be saved. When the queue is full, it waits for
+// room until ctx is done and then gives up with ErrQueueFull, so callers are
+// slowed down by a backlog but never stuck behind it.
+func (w *Writer) Enqueue(ctx context.Context, visit *database.Visit) error {
+	w.closing.RLock()
+	defer w.closing.RUnlock()
+	if w.closed {
+		w.count(func(stats *Stats) { stats.Rejected++ })
+		return ErrClosed
+	}
+
+	select {
+	case w.queue <- visit:
+		w.count(func(stats *Stats) { stats.Queued++ })
+		return nil
+	case <-ctx.Done():
+		w.count(func(stats *Stats) { stats.Rejected++ })
+		return ErrQueueFull
+	}
+}
+
+// Close stops accepting visits and returns once every queued visit has been
+// saved, or ctx is done.
+func (w *Writer) Close(ctx context.Context) error {
+	w.closing.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.closing.Unlock()
+
+	select {
+	case <-w.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush returns once every visit queued before it was called has been saved,
+// or ctx is done.
+func (w *Writer) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case w.flushes <- done:
+	case <-w.stopped:
+		// The queue was drained on closing.
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of the Writer's stats.
+func (w *Writer) Stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stats := w.stats
+	stats.QueueDepth = len(w.queue)
+	stats.QueueCapacity = cap(w.queue)
+	return stats
+}
+
+func (w *Writer) count(update func(stats *Stats)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	update(&w.stats)
+}
+
+func (w *Writer) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*database.Visit, 0, w.config.BatchSize)
+	for {
+		select {
+		case visit, ok := <-w.queue:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, visit)
+			if len(batch) >= w.config.BatchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			w.flush(batch)
+			batch = batch[:0]
+		case done := <-w.flushes:
+			for len(w.queue) > 0 {
+				batch = append(batch, <-w.queue)
+				if len(batch) >= w.config.BatchSize {
+					w.flush(batch)
+					batch = batch[:0]
+				}
+			}
+			w.flush(batch)
+			batch = batch[:0]
+			close(done)
+		}
+	}
+}
+
+func (w *Writer) flush(batch []*database.Visit) {
+	if len(batch) == 0 {
+		return
+	}
+
+	start := time.Now()
+	saved, failed := len(batch), 0
+	if err := w.saver.SaveVisits(batch); err != nil {
+		log.Printf("error saving batch of %d visits: %v", len(batch), err)
+		saved, failed = w.saveEach(batch)
+	}
+	elapsed := time.Since(start).Seconds()
+
+	w.count(func(stats *Stats) {
+		stats.Flushes++
+		stats.Saved += int64(saved)
+		stats.Failed += int64(failed)
+		stats.LastFlushSeconds = elapsed
+		stats.TotalFlushSeconds += elapsed
+		if elapsed > stats.MaxFlushSeconds {
+			stats.MaxFlushSeconds = elapsed
+		}
+	})
+}
+
+// saveEach saves the visits of a batch which failed one at a time, so a
+// single visit the database refuses doesn't lose the rest, and returns how
+// many were saved and how many failed.
+func (w *Writer) saveEach(batch []*database.Visit) (saved, failed int) {
+	if len(batch) == 1 {
+		return 0, 1
+	}
+	for _, visit := range batch {
+		if err := w.saver.SaveVisits([]*database.Visit{visit}); err != nil {
+			log.Printf("error saving visit: %v", err)
+			failed++
+		} else {
+			saved++
+		}
+	}
+	return saved, failed
+}
@@ -0,0 +1,207 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/parkr/ping/database"
+)
+
+// recordingSaver records the size of every batch it saves.
+type recordingSaver struct {
+	mu      sync.Mutex
+	batches []int
+	saved   chan int
+	err     error
+}
+
+func newRecordingSaver() *recordingSaver {
+	return &recordingSaver{saved: make(chan int, 100)}
+}
+
+func (s *recordingSaver) SaveVisits(visits []*database.Visit) error {
+	s.mu.Lock()
+	s.batches = append(s.batches, len(visits))
+	s.mu.Unlock()
+	s.saved <- len(visits)
+	return s.err
+}
+
+func waitForBatch(t *testing.T, saver *recordingSaver) int {
+	t.Helper()
+	select {
+	case size := <-saver.saved:
+		return size
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a batch to be saved")
+		return 0
+	}
+}
+
+func TestWriter_FlushesFullBatches(t *testing.T) {
+	saver := newRecordingSaver()
+	writer := NewWriter(saver, Config{BatchSize: 2, FlushInterval: time.Hour})
+	defer writer.Close(context.Background())
+
+	for i := 0; i < 4; i++ {
+		if err := writer.Enqueue(context.Background(), &database.Visit{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if size := waitForBatch(t, saver); size != 2 {
+			t.Errorf("expected a batch of 2 visits, got %d", size)
+		}
+	}
+}
+
+func TestWriter_FlushesOnInterval(t *testing.T) {
+	saver := newRecordingSaver()
+	writer := NewWriter(saver, Config{BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+	defer writer.Close(context.Background())
+
+	if err := writer.Enqueue(context.Background(), &database.Visit{}); err != nil {
+		t.Fatal(err)
+	}
+	if size := waitForBatch(t, saver); size != 1 {
+		t.Errorf("expected a batch of 1 visit, got %d", size)
+	}
+
+	stats := writer.Stats()
+	if stats.Queued != 1 || stats.Flushes != 1 || stats.QueueCapacity != DefaultQueueSize {
+		t.Errorf("expected 1 visit queued and flushed, got: %+v", stats)
+	}
+}
+
+func TestWriter_RejectsWhenFull(t *testing.T) {
+	blocked := make(chan struct{})
+	writer := NewWriter(SaverFunc(func(visits []*database.Visit) error {
+		<-blocked
+		return nil
+	}), Config{QueueSize: 1, BatchSize: 1})
+
+	// The first visit is taken off the queue and held up saving, and the
+	// second fills the queue.
+	for i := 0; i < 2; i++ {
+		if err := writer.Enqueue(context.Background(), &database.Visit{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for writer.Stats().QueueDepth != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := writer.Enqueue(ctx, &database.Visit{}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got: %v", err)
+	}
+	if stats := writer.Stats(); stats.Rejected != 1 {
+		t.Errorf("expected 1 visit to be rejected, got: %+v", stats)
+	}
+
+	close(blocked)
+	if err := writer.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriter_CloseDrainsQueue(t *testing.T) {
+	saver := newRecordingSaver()
+	writer := NewWriter(saver, Config{BatchSize: 3, FlushInterval: time.Hour})
+
+	for i := 0; i < 7; i++ {
+		if err := writer.Enqueue(context.Background(), &database.Visit{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := writer.Stats(); stats.Saved != 7 || stats.QueueDepth != 0 {
+		t.Errorf("expected all 7 visits to be saved, got: %+v", stats)
+	}
+	if err := writer.Enqueue(context.Background(), &database.Visit{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after closing, got: %v", err)
+	}
+	if err := writer.Close(context.Background()); err != nil {
+		t.Errorf("expected closing twice to succeed, got: %v", err)
+	}
+}
+
+func TestWriter_CountsFailures(t *testing.T) {
+	saver := newRecordingSaver()
+	saver.err = errors.New("database is locked")
+	writer := NewWriter(saver, Config{BatchSize: 2})
+
+	for i := 0; i < 2; i++ {
+		if err := writer.Enqueue(context.Background(), &database.Visit{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := writer.Stats(); stats.Failed != 2 || stats.Saved != 0 {
+		t.Errorf("expected 2 visits to fail, got: %+v", stats)
+	}
+}
+
+func TestWriter_SavesFailedBatchesOneAtATime(t *testing.T) {
+	var saved []string
+	saver := SaverFunc(func(visits []*database.Visit) error {
+		for _, visit := range visits {
+			if visit.Path == "/bad" {
+				return errors.New("value too long")
+			}
+		}
+		for _, visit := range visits {
+			saved = append(saved, visit.Path)
+		}
+		return nil
+	})
+	writer := NewWriter(saver, Config{BatchSize: 3, FlushInterval: time.Hour})
+
+	for _, path := range []string{"/first", "/bad", "/last"} {
+		if err := writer.Enqueue(context.Background(), &database.Visit{Path: path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saved) != 2 || saved[0] != "/first" || saved[1] != "/last" {
+		t.Errorf("expected the visits around the bad one to be saved, got: %v", saved)
+	}
+	if stats := writer.Stats(); stats.Saved != 2 || stats.Failed != 1 {
+		t.Errorf("expected 2 visits to be saved and 1 to fail, got: %+v", stats)
+	}
+}
+
+func TestWriter_Flush(t *testing.T) {
+	saver := newRecordingSaver()
+	writer := NewWriter(saver, Config{BatchSize: 2, FlushInterval: time.Hour})
+	defer writer.Close(context.Background())
+
+	for i := 0; i < 3; i++ {
+		if err := writer.Enqueue(context.Background(), &database.Visit{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := writer.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := writer.Stats(); stats.Saved != 3 || stats.QueueDepth != 0 {
+		t.Errorf("expected every queued visit to be saved, got: %+v", stats)
+	}
+}
@@ -0,0 +1,70 @@
+// Package bots recognizes visits made by bots, crawlers, uptime monitors,
+// link previewers and headless browsers from their User-Agent header.
+package bots
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+)
+
+// patternsFile lists the User-Agent substrings of known bots. Keep it up to
+// date as new ones show up.
+//
+//go:embed patterns.txt
+var patternsFile string
+
+var patterns = parsePatterns(patternsFile)
+
+// parsePatterns reads one lowercase pattern per line, skipping blank lines
+// and comments.
+func parsePatterns(file string) []string {
+	parsed := []string{}
+	for _, line := range strings.Split(file, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parsed = append(parsed, strings.ToLower(line))
+	}
+	return parsed
+}
+
+// IsBot reports whether the User-Agent belongs to a bot. Besides the known
+// patterns, a missing User-Agent or one containing a URL, which crawlers use
+// to link to their documentation, is a bot.
+func IsBot(userAgent string) bool {
+	userAgent = strings.ToLower(strings.TrimSpace(userAgent))
+	if userAgent == "" || strings.Contains(userAgent, "http://") || strings.Contains(userAgent, "https://") {
+		return true
+	}
+	for _, pattern := range patterns {
+		if strings.Contains(userAgent, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestIsFromBot reports whether the request was made by a bot.
+func RequestIsFromBot(r *http.Request) bool {
+	return IsBot(r.Header.Get("User-Agent"))
+}
+
+// NewMiddleware drops requests made by bots, responding with 204 No Content
+// without calling nextHandler.
+func NewMiddleware(nextHandler http.Handler) http.Handler {
+	return botsMiddleware{nextHandler: nextHandler}
+}
+
+type botsMiddleware struct {
+	nextHandler http.Handler
+}
+
+func (b botsMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if RequestIsFromBot(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	b.nextHandler.ServeHTTP(w, r)
+}
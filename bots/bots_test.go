@@ -0,0 +1,58 @@
+package bots
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsBot(t *testing.T) {
+	for userAgent, expected := range map[string]bool{
+		"": true,
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)":                                      true,
+		"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)":                                       true,
+		"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)":                                     true,
+		"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)":                                                    true,
+		"Mozilla/5.0 (compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)":                                        true,
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36": true,
+		"curl/8.4.0":             true,
+		"python-requests/2.31.0": true,
+		"Go-http-client/1.1":     true,
+		"Some Crawler (contact@example.com; https://example.com/crawler)":                                                                         true,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15":                   false,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36":                         false,
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1": false,
+		"Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0":                                                                  false,
+	} {
+		if actual := IsBot(userAgent); actual != expected {
+			t.Errorf("expected IsBot(%q) to be %v, got %v", userAgent, expected, actual)
+		}
+	}
+}
+
+func TestParsePatterns(t *testing.T) {
+	parsed := parsePatterns("# comment\n\nFooBot\n  spider  \n")
+	if len(parsed) != 2 || parsed[0] != "foobot" || parsed[1] != "spider" {
+		t.Errorf("expected [foobot spider], got %v", parsed)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := NewMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	for userAgent, expected := range map[string]int{
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)": http.StatusNoContent,
+		"Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0":   http.StatusCreated,
+	} {
+		request := httptest.NewRequest("GET", "/ping", nil)
+		request.Header.Set("User-Agent", userAgent)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != expected {
+			t.Errorf("expected status %d for %q, got %d", expected, userAgent, recorder.Code)
+		}
+	}
+}
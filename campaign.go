@@ -0,0 +1,43 @@
+package ping
+
+import (
+	"net/url"
+
+	"github.com/parkr/ping/database"
+)
+
+// utmParams are the only query params kept from the URL of a visited page.
+// The rest of the query string is stripped for privacy.
+var utmParams = []string{"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content"}
+
+// maxUTMLength is the longest UTM value stored; longer values are truncated.
+const maxUTMLength = 255
+
+// utmQuery returns only the UTM params of query.
+func utmQuery(query url.Values) url.Values {
+	utm := url.Values{}
+	for _, param := range utmParams {
+		if value := query.Get(param); value != "" {
+			utm.Set(param, value)
+		}
+	}
+	return utm
+}
+
+// campaignFromQuery extracts the UTM params of a page's query string.
+func campaignFromQuery(query url.Values) database.Campaign {
+	utm := func(param string) string {
+		value := sanitizeUserInput(query.Get(param))
+		if len(value) > maxUTMLength {
+			value = value[:maxUTMLength]
+		}
+		return value
+	}
+	return database.Campaign{
+		Source:  utm("utm_source"),
+		Medium:  utm("utm_medium"),
+		Name:    utm("utm_campaign"),
+		Term:    utm("utm_term"),
+		Content: utm("utm_content"),
+	}
+}
@@ -0,0 +1,164 @@
+// Package clientip finds the IP of the client which made a request, reading
+// the Forwarded, X-Forwarded-For and X-Real-IP headers only when they were
+// set by a trusted proxy.
+package clientip
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const (
+	ForwardedHeaderName     = "Forwarded"
+	XForwardedForHeaderName = "X-Forwarded-For"
+	XRealIPHeaderName       = "X-Real-IP"
+)
+
+// PrivateNetworks are the loopback, private and link-local networks, where a
+// reverse proxy on the same host or network usually lives.
+var PrivateNetworks = []netip.Prefix{
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+}
+
+// ParseNetworks parses a comma-separated list of CIDRs, like
+// "10.0.0.0/8,2001:db8::/32". A bare IP is a network of just that IP.
+func ParseNetworks(list string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			network, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+			}
+			networks = append(networks, network.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+		}
+		networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return networks, nil
+}
+
+// Resolver finds client IPs behind the proxies in its trusted networks.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// NewResolver returns a Resolver which trusts the proxies in the given
+// networks to report the address they received a request from.
+func NewResolver(trusted []netip.Prefix) *Resolver {
+	return &Resolver{trusted: trusted}
+}
+
+// ClientIP returns the IP of the client which made r, or an empty string if
+// it can't be determined.
+//
+// If the request came straight from a client, rather than a trusted proxy,
+// the forwarding headers are ignored, since anyone can set them. Otherwise,
+// the hops in the Forwarded header, or X-Forwarded-For if there is none, are
+// read right to left, skipping trusted proxies, and the first untrusted hop
+// is the client. If neither header is set, X-Real-IP is used. A nil Resolver
+// trusts no proxies.
+func (r *Resolver) ClientIP(req *http.Request) string {
+	peer, ok := parseAddr(req.RemoteAddr)
+	if !ok {
+		return ""
+	}
+	if !r.trusts(peer) {
+		return peer.String()
+	}
+
+	hops := forwardedHops(req.Header)
+	if len(hops) == 0 {
+		if realIP, ok := parseAddr(req.Header.Get(XRealIPHeaderName)); ok {
+			return realIP.String()
+		}
+		return peer.String()
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseAddr(hops[i])
+		if !ok {
+			// The trusted proxy which added this hop couldn't say where the
+			// request came from, and nothing further left is trustworthy.
+			break
+		}
+		client = hop
+		if !r.trusts(hop) {
+			break
+		}
+	}
+	return client.String()
+}
+
+func (r *Resolver) trusts(addr netip.Addr) bool {
+	if r == nil {
+		return false
+	}
+	for _, network := range r.trusted {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedHops returns the addresses a request was forwarded for, from the
+// client to the last proxy, as listed in the Forwarded header (RFC 7239) or
+// else X-Forwarded-For. A Forwarded element without a for parameter is an
+// empty hop.
+func forwardedHops(header http.Header) []string {
+	var hops []string
+	for _, value := range header.Values(ForwardedHeaderName) {
+		for _, element := range strings.Split(value, ",") {
+			hop := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, value, _ := strings.Cut(pair, "=")
+				if strings.EqualFold(strings.TrimSpace(key), "for") {
+					hop = strings.Trim(strings.TrimSpace(value), `"`)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	if len(hops) > 0 {
+		return hops
+	}
+
+	for _, value := range header.Values(XForwardedForHeaderName) {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	return hops
+}
+
+// parseAddr parses an IP, optionally with a port, or in brackets if it is an
+// IPv6 address. IPv4-mapped IPv6 addresses are returned as IPv4.
+func parseAddr(value string) (netip.Addr, bool) {
+	value = strings.TrimSpace(value)
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap().WithZone(""), true
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
@@ -0,0 +1,116 @@
+package clientip
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+)
+
+func TestParseNetworks(t *testing.T) {
+	networks, err := ParseNetworks(" 10.0.0.1/8, 192.0.2.1 ,2001:db8::/32,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	if len(networks) != len(expected) {
+		t.Fatalf("expected %v, got: %v", expected, networks)
+	}
+	for i := range expected {
+		if networks[i] != expected[i] {
+			t.Errorf("expected network %d to be %v, got: %v", i, expected[i], networks[i])
+		}
+	}
+
+	for _, list := range []string{"10.0.0.0/33", "proxy.local", "10.0.0.0/8,nope"} {
+		if _, err := ParseNetworks(list); err == nil {
+			t.Errorf("expected an error parsing %q", list)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	resolver := NewResolver([]netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	})
+
+	for _, testCase := range []struct {
+		name       string
+		remoteAddr string
+		headers    map[string][]string
+		expected   string
+	}{
+		{"direct", "1.2.3.4:5678", nil, "1.2.3.4"},
+		{"direct without port", "1.2.3.4", nil, "1.2.3.4"},
+		{"direct ipv6", "[2001:db9::1]:443", nil, "2001:db9::1"},
+		{"ipv4-mapped", "[::ffff:1.2.3.4]:443", nil, "1.2.3.4"},
+		{"invalid remote addr", "pipe", nil, ""},
+		{"spoofed by client", "1.2.3.4:5678", map[string][]string{
+			XForwardedForHeaderName: {"5.6.7.8"},
+			ForwardedHeaderName:     {"for=5.6.7.8"},
+			XRealIPHeaderName:       {"5.6.7.8"},
+		}, "1.2.3.4"},
+		{"x-forwarded-for", "10.0.0.1:5678", map[string][]string{
+			XForwardedForHeaderName: {"1.2.3.4"},
+		}, "1.2.3.4"},
+		{"x-forwarded-for skips trusted hops", "10.0.0.1:5678", map[string][]string{
+			XForwardedForHeaderName: {"5.6.7.8, 1.2.3.4, 10.0.0.2"},
+		}, "1.2.3.4"},
+		{"x-forwarded-for across headers", "10.0.0.1:5678", map[string][]string{
+			XForwardedForHeaderName: {"5.6.7.8, 1.2.3.4", "10.0.0.2"},
+		}, "1.2.3.4"},
+		{"x-forwarded-for only trusted hops", "10.0.0.1:5678", map[string][]string{
+			XForwardedForHeaderName: {"10.0.0.3, 10.0.0.2"},
+		}, "10.0.0.3"},
+		{"x-forwarded-for invalid hop", "10.0.0.1:5678", map[string][]string{
+			XForwardedForHeaderName: {"1.2.3.4, garbage, 10.0.0.2"},
+		}, "10.0.0.2"},
+		{"forwarded", "10.0.0.1:5678", map[string][]string{
+			ForwardedHeaderName: {`for=1.2.3.4;proto=https, For="[2001:db8::17]:4711";by=10.0.0.1`},
+		}, "1.2.3.4"},
+		{"forwarded ipv6", "10.0.0.1:5678", map[string][]string{
+			ForwardedHeaderName: {`for="[2001:db9::17]:4711"`},
+		}, "2001:db9::17"},
+		{"forwarded over x-forwarded-for", "10.0.0.1:5678", map[string][]string{
+			ForwardedHeaderName:     {"for=1.2.3.4"},
+			XForwardedForHeaderName: {"5.6.7.8"},
+		}, "1.2.3.4"},
+		{"forwarded unknown", "10.0.0.1:5678", map[string][]string{
+			ForwardedHeaderName: {"for=1.2.3.4, for=unknown"},
+		}, "10.0.0.1"},
+		{"forwarded without for", "10.0.0.1:5678", map[string][]string{
+			ForwardedHeaderName: {"proto=https"},
+		}, "10.0.0.1"},
+		{"x-real-ip", "10.0.0.1:5678", map[string][]string{
+			XRealIPHeaderName: {"1.2.3.4"},
+		}, "1.2.3.4"},
+		{"invalid x-real-ip", "10.0.0.1:5678", map[string][]string{
+			XRealIPHeaderName: {"1.2.3.4, 5.6.7.8"},
+		}, "10.0.0.1"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := &http.Request{RemoteAddr: testCase.remoteAddr, Header: http.Header{}}
+			for name, values := range testCase.headers {
+				for _, value := range values {
+					req.Header.Add(name, value)
+				}
+			}
+			if actual := resolver.ClientIP(req); actual != testCase.expected {
+				t.Errorf("expected client ip %q, got: %q", testCase.expected, actual)
+			}
+		})
+	}
+}
+
+func TestClientIP_NilResolver(t *testing.T) {
+	var resolver *Resolver
+	req := &http.Request{RemoteAddr: "127.0.0.1:5678", Header: http.Header{}}
+	req.Header.Set(XForwardedForHeaderName, "1.2.3.4")
+	if actual := resolver.ClientIP(req); actual != "127.0.0.1" {
+		t.Errorf("expected a nil resolver to ignore X-Forwarded-For, got: %q", actual)
+	}
+}
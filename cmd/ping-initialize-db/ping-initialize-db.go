@@ -1,8 +1,12 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/parkr/ping/database"
 )
@@ -12,8 +16,45 @@ func VerifySchema(connection string) error {
 	return err
 }
 
+// PrintPendingMigrations writes the SQL of every migration which has yet to
+// be applied to the database to w, without applying anything.
+func PrintPendingMigrations(w io.Writer, connection string) error {
+	db, err := database.Open(connection)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	pending, err := database.PendingMigrations(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		version, err := database.SchemaVersion(db)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "-- database schema is up to date at version %d\n", version)
+		return nil
+	}
+	for _, migration := range pending {
+		fmt.Fprintf(w, "-- %s\n%s\n", migration.Name, strings.TrimSpace(migration.SQL))
+	}
+	return nil
+}
+
 func main() {
+	var dryRun bool
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the SQL of pending migrations instead of applying them.")
+	flag.Parse()
+
 	connection := os.Getenv("PING_DB")
+	if dryRun {
+		if err := PrintPendingMigrations(os.Stdout, connection); err != nil {
+			log.Fatalf("error listing pending migrations: %+v", err)
+		}
+		return
+	}
 	if err := VerifySchema(connection); err != nil {
 		log.Fatalf("error setting up database: %+v", err)
 	}
@@ -0,0 +1,118 @@
+// Command ping-sites manages the sites table of the ping database named by
+// PING_DB:
+//
+//	ping-sites list
+//	ping-sites add [-secret] <host>
+//	ping-sites remove <host>
+//
+// A running ping server picks up the changes within 30 seconds, or straight
+// away on SIGHUP.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/parkr/ping/database"
+	"github.com/parkr/ping/sites"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: ping-sites list | add [-secret] <host> | remove <host>")
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+	}
+
+	db, err := database.Initialize(os.Getenv("PING_DB"))
+	if err != nil {
+		log.Fatalf("error opening database: %v", err)
+	}
+	defer db.Close()
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+	switch command {
+	case "list":
+		err = list(os.Stdout, db)
+	case "add":
+		err = add(os.Stdout, db, args)
+	case "remove":
+		err = remove(os.Stdout, db, args)
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+}
+
+func list(w io.Writer, db *sqlx.DB) error {
+	all, err := database.GetSites(db)
+	if err != nil {
+		return err
+	}
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "HOST\tSITE ID\tSECRET")
+	for _, site := range all {
+		secret := "no"
+		if site.Secret != "" {
+			secret = "yes"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", site.Host, site.SiteID, secret)
+	}
+	return table.Flush()
+}
+
+// add adds a site and prints its keys. The secret is only ever printed
+// here.
+func add(w io.Writer, db *sqlx.DB, args []string) error {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	withSecret := fs.Bool("secret", false, "Create a secret for signing server-side submissions.")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	host, err := sites.Normalize(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	site, err := database.AddSite(db, host, *withSecret)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "host:    %s\nsite id: %s\n", site.Host, site.SiteID)
+	if site.Secret != "" {
+		fmt.Fprintf(w, "secret:  %s\n", site.Secret)
+	}
+	return nil
+}
+
+func remove(w io.Writer, db *sqlx.DB, args []string) error {
+	if len(args) != 1 {
+		usage()
+	}
+	host, err := sites.Normalize(args[0])
+	if err != nil {
+		return err
+	}
+	removed, err := database.RemoveSite(db, host)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return fmt.Errorf("no site %s", host)
+	}
+	fmt.Fprintf(w, "removed %s\n", host)
+	return nil
+}
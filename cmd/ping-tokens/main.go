@@ -0,0 +1,121 @@
+// Command ping-tokens manages the API tokens of the ping database named by
+// PING_DB:
+//
+//	ping-tokens list
+//	ping-tokens create -name <name> [-host <host>] [-scope read|write]
+//	ping-tokens revoke <id>
+//
+// Read tokens can read the reports of their host, or of every site if they
+// have none. Write tokens can also submit visits to /submit.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/parkr/ping/database"
+	"github.com/parkr/ping/sites"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: ping-tokens list | create -name <name> [-host <host>] [-scope read|write] | revoke <id>")
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+	}
+
+	db, err := database.Initialize(os.Getenv("PING_DB"))
+	if err != nil {
+		log.Fatalf("error opening database: %v", err)
+	}
+	defer db.Close()
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+	switch command {
+	case "list":
+		err = list(os.Stdout, db)
+	case "create":
+		err = create(os.Stdout, db, args)
+	case "revoke":
+		err = revoke(os.Stdout, db, args)
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+}
+
+func list(w io.Writer, db *sqlx.DB) error {
+	tokens, err := database.ListAPITokens(db)
+	if err != nil {
+		return err
+	}
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tNAME\tHOST\tSCOPE\tCREATED")
+	for _, token := range tokens {
+		host := token.Host
+		if host == "" {
+			host = "(all sites)"
+		}
+		fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%s\n", token.ID, token.Name, host, token.Scope, token.CreatedAt)
+	}
+	return table.Flush()
+}
+
+// create creates a token and prints it. Only its hash is stored, so this is
+// the only time it's shown.
+func create(w io.Writer, db *sqlx.DB, args []string) error {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	name := fs.String("name", "", "What the token is for, like \"dashboard\". Required.")
+	host := fs.String("host", "", "The site the token is for. Leave empty for every site.")
+	scope := fs.String("scope", database.ScopeRead, "\"read\" to read reports, or \"write\" to also submit visits.")
+	fs.Parse(args)
+	if *name == "" || fs.NArg() != 0 {
+		usage()
+	}
+
+	if *host != "" {
+		normalized, err := sites.Normalize(*host)
+		if err != nil {
+			return err
+		}
+		*host = normalized
+	}
+	token, record, err := database.CreateAPIToken(db, *name, *host, *scope)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "created token %d, which won't be shown again:\n%s\n", record.ID, token)
+	return nil
+}
+
+func revoke(w io.Writer, db *sqlx.DB, args []string) error {
+	if len(args) != 1 {
+		usage()
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid token id %q", args[0])
+	}
+	deleted, err := database.DeleteAPIToken(db, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("no token %d", id)
+	}
+	fmt.Fprintf(w, "revoked token %d\n", id)
+	return nil
+}
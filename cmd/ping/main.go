@@ -1,38 +1,167 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/parkr/ping"
+	"github.com/parkr/ping/batch"
+	"github.com/parkr/ping/clientip"
+	"github.com/parkr/ping/config"
+	"github.com/parkr/ping/geoip"
+	"github.com/parkr/ping/sites"
+)
+
+const (
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 10 * time.Second
+	writeTimeout      = 30 * time.Second
+	idleTimeout       = 2 * time.Minute
+	// shutdownTimeout bounds the time spent finishing in-flight requests
+	// and saving queued visits on shutdown.
+	shutdownTimeout = 30 * time.Second
 )
 
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8000"
+	var configPath string
+	flag.StringVar(&configPath, "config", "", "Path to a YAML config file. Environment variables and flags override its settings.")
+	var printConfig bool
+	flag.BoolVar(&printConfig, "print-config", false, "Print the effective configuration, after applying the config file, environment and flags, and exit.")
+	overrides := config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := config.Resolve(configPath, os.Getenv, overrides)
+	if printConfig {
+		out, marshalErr := cfg.YAML()
+		if marshalErr != nil {
+			log.Fatalf("unable to print config: %v", marshalErr)
+		}
+		os.Stdout.Write(out)
+	}
+	if err != nil {
+		log.Fatalf("invalid configuration:\n%v", err)
+	}
+	if printConfig {
+		return
 	}
 
-	var binding string
-	flag.StringVar(&binding, "http", ":"+port, "The IP/port to bind to.")
-	var hostAllowlist string
-	flag.StringVar(&hostAllowlist, "hosts", "", "The hosts allowed to use this service. Comma-separated.")
-	var pingBaseURL string
-	flag.StringVar(&pingBaseURL, "baseurl", "http://localhost:"+port, "Base URL used for XHR request in stats.js")
-	flag.Parse()
+	if cfg.Database == "" {
+		log.Println("no database given, so visits are kept in a temporary database until ping stops")
+	}
+	if err := ping.Initialize(cfg.Database); err != nil {
+		log.Fatalf("refusing to start: %v", err)
+	}
 
-	ping.Initialize(os.Getenv("PING_DB"))
+	stopPruning := func() {}
+	if cfg.RetentionDays > 0 {
+		retention := time.Duration(cfg.RetentionDays) * 24 * time.Hour
+		log.Printf("pruning visits older than %d days", cfg.RetentionDays)
+		stopPruning = ping.StartPruning(retention, time.Hour)
+	}
 
-	allowedHosts := strings.Split(hostAllowlist, ",")
-	log.Printf("allowing the following hosts: %v", allowedHosts)
+	registry := sites.NewRegistry(cfg.Hosts)
+	if err := ping.ReloadSites(registry, cfg.Hosts); err != nil {
+		log.Fatalf("unable to read the sites table: %v", err)
+	}
+	log.Printf("allowing the following hosts: %v", registry.Hosts())
+	if len(registry.Hosts()) == 0 {
+		log.Println("no hosts are allowed yet: configure hosts, or add sites with ping-sites")
+	}
+	stopReloading := reloadSites(registry, configPath, overrides, cfg.Hosts)
 
-	log.Printf("base url: %q", pingBaseURL)
+	log.Printf("base url: %q", cfg.BaseURL)
 
-	http.Handle("/", ping.NewHandler(allowedHosts, pingBaseURL))
+	options := []ping.Option{ping.WithSites(registry), ping.WithAPITokens(cfg.PublicReports...)}
+	log.Printf("reports readable without an API token: %v", cfg.PublicReports)
+	var countries *geoip.DB
+	var writer *batch.Writer
+	if cfg.HashVisitors {
+		log.Println("storing hashed visitor ids instead of ips")
+		options = append(options, ping.WithHashedVisitors())
+	}
+	if cfg.GeoIPDB != "" {
+		countries, err = geoip.Open(cfg.GeoIPDB)
+		if err != nil {
+			log.Fatalf("unable to open geoip database: %v", err)
+		}
+		log.Printf("looking up countries in %q", cfg.GeoIPDB)
+		options = append(options, ping.WithGeoIP(countries))
+	}
+	// Validated by config.Resolve.
+	proxies, _ := clientip.ParseNetworks(strings.Join(cfg.TrustedProxies, ","))
+	if len(proxies) > 0 {
+		log.Printf("trusting proxies in %v", proxies)
+		options = append(options, ping.WithTrustedProxies(proxies))
+	}
+	if cfg.BatchWrites {
+		log.Printf("saving visits in batches, queueing up to %d", cfg.WriteQueueSize)
+		writer = ping.NewBatchWriter(batch.Config{QueueSize: cfg.WriteQueueSize})
+		options = append(options, ping.WithBatchedWrites(writer))
+	}
+	if cfg.DropBots {
+		log.Println("dropping visits from bots")
+		options = append(options, ping.WithDroppedBots())
+	}
+
+	server := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           ping.NewHandler(cfg.Hosts, cfg.BaseURL, options...),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Println("Listening on", cfg.Listen, "...")
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	// A second signal kills the process straight away.
+	stop()
+
+	log.Println("shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 
-	log.Println("Listening on", binding, "...")
-	log.Fatal(http.ListenAndServe(binding, nil))
+	failed := false
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("error finishing in-flight requests: %v", err)
+		failed = true
+	}
+	stopPruning()
+	stopReloading()
+	if writer != nil {
+		if err := writer.Close(shutdownCtx); err != nil {
+			log.Printf("unable to save every queued visit: %v", err)
+			failed = true
+		}
+	}
+	if countries != nil {
+		countries.Close()
+	}
+	if err := ping.Close(); err != nil {
+		log.Printf("error closing database: %v", err)
+		failed = true
+	}
+	if failed {
+		os.Exit(1)
+	}
+	log.Println("shut down cleanly")
 }
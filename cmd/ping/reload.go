@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/parkr/ping"
+	"github.com/parkr/ping/config"
+	"github.com/parkr/ping/sites"
+)
+
+// siteReloadInterval is how often the config file is checked for changes and
+// the sites table is read again.
+const siteReloadInterval = 30 * time.Second
+
+// reloadSites keeps the allowlist in registry up to date with the hosts in
+// the config file and the sites table, reloading them on SIGHUP, whenever the
+// config file changes, and every siteReloadInterval. Only the hosts are
+// reloaded; other settings need a restart. The returned function stops
+// reloading and waits for any reload in progress to finish.
+func reloadSites(registry *sites.Registry, configPath string, overrides *config.Overrides, hosts []string) (stop func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(siteReloadInterval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	lastModified := modTime(configPath)
+	reload := func(resolve bool) {
+		if resolve {
+			cfg, err := config.Resolve(configPath, os.Getenv, overrides)
+			if err != nil {
+				log.Printf("sites: keeping the current hosts, invalid configuration:\n%v", err)
+			} else {
+				hosts = cfg.Hosts
+			}
+		}
+		if err := ping.ReloadSites(registry, hosts); err != nil {
+			log.Printf("sites: unable to read the sites table: %v", err)
+		}
+	}
+
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-hup:
+				log.Println("sites: reloading on SIGHUP")
+				lastModified = modTime(configPath)
+				reload(true)
+			case <-ticker.C:
+				modified := modTime(configPath)
+				changed := !modified.Equal(lastModified)
+				if changed {
+					log.Printf("sites: reloading %s, which changed", configPath)
+					lastModified = modified
+				}
+				reload(changed)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(hup)
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
+}
+
+// modTime returns when the file at path was last modified, or the zero time
+// if there's no such file.
+func modTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
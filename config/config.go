@@ -0,0 +1,281 @@
+// Package config loads the settings of the ping server from a YAML file, the
+// environment and command-line flags, in increasing order of precedence, and
+// validates them.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/parkr/ping/batch"
+	"github.com/parkr/ping/clientip"
+	"github.com/parkr/ping/reports"
+	"github.com/parkr/ping/sites"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultPort = "8000"
+
+// Config holds every setting of the ping server.
+type Config struct {
+	// Listen is the IP and port to bind to, like ":8000".
+	Listen string `yaml:"listen"`
+	// Database is the PING_DB connection string. If it's empty, visits are
+	// kept in a temporary SQLite database, as they always have been.
+	Database string `yaml:"database"`
+	// BaseURL is the URL the ping server is reached at, used by the scripts
+	// it serves. It defaults to http://localhost on the port of Listen.
+	BaseURL string `yaml:"base_url"`
+	// Hosts are the sites allowed to record visits and read reports, in
+	// addition to those in the sites table, so there may be none.
+	Hosts []string `yaml:"hosts"`
+	// TrustedProxies are the CIDRs of the proxies trusted to report the
+	// client IP.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	HashVisitors bool   `yaml:"hash_visitors"`
+	GeoIPDB      string `yaml:"geoip_db"`
+	DropBots     bool   `yaml:"drop_bots"`
+
+	// RetentionDays is how long visits are kept before they're rolled up and
+	// deleted, or 0 to keep them forever.
+	RetentionDays  int  `yaml:"retention_days"`
+	BatchWrites    bool `yaml:"batch_writes"`
+	WriteQueueSize int  `yaml:"write_queue_size"`
+
+	// PublicReports are the paths of the reports which can be read without an
+	// API token.
+	PublicReports []string `yaml:"public_reports"`
+}
+
+// Default returns the settings used when nothing else is given.
+func Default() Config {
+	return Config{
+		Listen:         ":" + defaultPort,
+		WriteQueueSize: batch.DefaultQueueSize,
+		PublicReports:  []string{"/counts", "/stats.js"},
+	}
+}
+
+// Resolve builds the effective configuration: the defaults, overridden by
+// the YAML file at path (if path isn't empty), then by the environment as
+// read by getenv, then by the flags in overrides. The result is validated,
+// and every problem with it is reported at once.
+func Resolve(path string, getenv func(string) string, overrides *Overrides) (Config, error) {
+	c := Default()
+	if path != "" {
+		if err := c.load(path); err != nil {
+			return c, err
+		}
+	}
+	c.applyEnv(getenv)
+	overrides.apply(&c)
+	c.normalize()
+	return c, c.Validate()
+}
+
+// load decodes the YAML file at path over c. Unknown keys are an error, so
+// typos don't go unnoticed.
+func (c *Config) load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read config file: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv applies PORT, PING_DB and PING_PROXIED. PING_PROXIED=true trusts
+// proxies on private networks, unless trusted proxies are configured.
+func (c *Config) applyEnv(getenv func(string) string) {
+	if port := getenv("PORT"); port != "" {
+		c.Listen = ":" + port
+	}
+	if database := getenv("PING_DB"); database != "" {
+		c.Database = database
+	}
+	if getenv("PING_PROXIED") == "true" && len(c.TrustedProxies) == 0 {
+		for _, network := range clientip.PrivateNetworks {
+			c.TrustedProxies = append(c.TrustedProxies, network.String())
+		}
+	}
+}
+
+// normalize trims the lists and fills in the defaults which depend on other
+// settings.
+func (c *Config) normalize() {
+	c.Hosts = trimList(c.Hosts)
+	c.TrustedProxies = trimList(c.TrustedProxies)
+	c.PublicReports = trimList(c.PublicReports)
+	if c.BaseURL == "" {
+		if _, port, err := net.SplitHostPort(c.Listen); err == nil {
+			c.BaseURL = "http://localhost:" + port
+		}
+	}
+	c.BaseURL = strings.TrimSuffix(c.BaseURL, "/")
+}
+
+// Validate reports every invalid setting.
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]interface{}{key}, args...)...))
+	}
+
+	if _, port, err := net.SplitHostPort(c.Listen); err != nil {
+		invalid("listen", "%q is not an address like :8000 or 127.0.0.1:8000", c.Listen)
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		invalid("listen", "%q is not a valid port", port)
+	}
+
+	if u, err := url.Parse(c.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" {
+		invalid("base_url", "%q is not an http:// or https:// URL without a query string", c.BaseURL)
+	}
+
+	for _, host := range c.Hosts {
+		if strings.ContainsAny(host, "/?#@ ") {
+			invalid("hosts", "%q is not a hostname like example.com", host)
+		} else if _, err := sites.Normalize(host); err != nil {
+			invalid("hosts", "%v", err)
+		}
+	}
+
+	if _, err := clientip.ParseNetworks(strings.Join(c.TrustedProxies, ",")); err != nil {
+		invalid("trusted_proxies", "%v", err)
+	}
+
+	if c.GeoIPDB != "" {
+		if _, err := os.Stat(c.GeoIPDB); err != nil {
+			invalid("geoip_db", "%v", err)
+		}
+	}
+
+	if c.RetentionDays < 0 {
+		invalid("retention_days", "%d is negative", c.RetentionDays)
+	}
+	if c.WriteQueueSize < 1 {
+		invalid("write_queue_size", "%d is not a positive number", c.WriteQueueSize)
+	}
+
+	for _, path := range c.PublicReports {
+		if !slices.Contains(reports.Paths, path) {
+			invalid("public_reports", "%q is not one of %s", path, strings.Join(reports.Paths, ", "))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// YAML renders the configuration as a config file, with any password in the
+// database URL redacted.
+func (c Config) YAML() ([]byte, error) {
+	if u, err := url.Parse(c.Database); err == nil && u.User != nil {
+		c.Database = u.Redacted()
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), encoder.Close()
+}
+
+// Overrides are the settings given as command-line flags.
+type Overrides struct {
+	set []func(*Config)
+}
+
+// RegisterFlags defines a flag on fs for each setting. Only the flags which
+// are given override the config file and environment.
+func RegisterFlags(fs *flag.FlagSet) *Overrides {
+	o := &Overrides{}
+	str := func(name, usage string, field func(*Config) *string) {
+		fs.Func(name, usage, func(value string) error {
+			o.set = append(o.set, func(c *Config) { *field(c) = value })
+			return nil
+		})
+	}
+	list := func(name, usage string, field func(*Config) *[]string) {
+		fs.Func(name, usage, func(value string) error {
+			o.set = append(o.set, func(c *Config) { *field(c) = strings.Split(value, ",") })
+			return nil
+		})
+	}
+	boolean := func(name, usage string, field func(*Config) *bool) {
+		fs.BoolFunc(name, usage, func(value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			o.set = append(o.set, func(c *Config) { *field(c) = b })
+			return nil
+		})
+	}
+	integer := func(name, usage string, field func(*Config) *int) {
+		fs.Func(name, usage, func(value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return err
+			}
+			o.set = append(o.set, func(c *Config) { *field(c) = n })
+			return nil
+		})
+	}
+
+	str("http", "The IP/port to bind to. (default \":$PORT\" or \":"+defaultPort+"\")",
+		func(c *Config) *string { return &c.Listen })
+	list("hosts", "The hosts allowed to use this service. Comma-separated.",
+		func(c *Config) *[]string { return &c.Hosts })
+	str("baseurl", "Base URL used for XHR requests in stats.js and ping.js?v=2 (default \"http://localhost:<port>\")",
+		func(c *Config) *string { return &c.BaseURL })
+	list("trusted-proxies", "The CIDRs of the proxies trusted to report the client IP in Forwarded, X-Forwarded-For or X-Real-IP. Comma-separated.",
+		func(c *Config) *[]string { return &c.TrustedProxies })
+	boolean("hash-visitors", "Store a daily salted hash of each visitor instead of their IP.",
+		func(c *Config) *bool { return &c.HashVisitors })
+	str("geoip-db", "Path to a MaxMind-format .mmdb database, like GeoLite2 Country, used to look up each visitor's country.",
+		func(c *Config) *string { return &c.GeoIPDB })
+	boolean("drop-bots", "Drop visits from bots instead of flagging them.",
+		func(c *Config) *bool { return &c.DropBots })
+	integer("retention-days", "Roll up and delete visits older than this many days. 0 keeps them forever.",
+		func(c *Config) *int { return &c.RetentionDays })
+	boolean("batch-writes", "Queue visits and save them in batches instead of one at a time.",
+		func(c *Config) *bool { return &c.BatchWrites })
+	list("public-reports", "The paths of the reports which can be read without an API token. Comma-separated. (default \"/counts,/stats.js\")",
+		func(c *Config) *[]string { return &c.PublicReports })
+	integer("write-queue-size", fmt.Sprintf("The most visits queued at once with -batch-writes. (default %d)", batch.DefaultQueueSize),
+		func(c *Config) *int { return &c.WriteQueueSize })
+	return o
+}
+
+func (o *Overrides) apply(c *Config) {
+	if o == nil {
+		return
+	}
+	for _, set := range o.set {
+		set(c)
+	}
+}
+
+func trimList(list []string) []string {
+	trimmed := []string{}
+	for _, entry := range list {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			trimmed = append(trimmed, entry)
+		}
+	}
+	return trimmed
+}
@@ -7,24 +7,27 @@ import (
 )
 
 const (
+	CorsAccessControlAllowHeadersHeaderName = "Access-Control-Allow-Headers"
 	CorsAccessControlAllowMethodsHeaderName = "Access-Control-Allow-Methods"
 	CorsAccessControlAllowOriginHeaderName  = "Access-Control-Allow-Origin"
 )
 
-func NewMiddleware(allowedHosts []string, nextHandler http.Handler) corsHandler {
-	allowedHostsMap := make(map[string]bool, len(allowedHosts))
-	for _, allowedHost := range allowedHosts {
-		allowedHostsMap[allowedHost] = true
-	}
+// Allowlist reports whether a host, which may include a port, may make
+// cross-origin requests. It is consulted on every request, so it may change
+// while the server is running.
+type Allowlist interface {
+	Allowed(host string) bool
+}
 
+func NewMiddleware(allowedHosts Allowlist, nextHandler http.Handler) corsHandler {
 	return corsHandler{
-		allowedHosts: allowedHostsMap,
+		allowedHosts: allowedHosts,
 		next:         nextHandler,
 	}
 }
 
 type corsHandler struct {
-	allowedHosts map[string]bool
+	allowedHosts Allowlist
 	next         http.Handler
 }
 
@@ -48,6 +51,9 @@ func (c corsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (c corsHandler) addCORSHeaders(w http.ResponseWriter, r *http.Request) {
 	log.Printf("cors: adding headers for %q", r.URL.Path)
 	w.Header().Set(CorsAccessControlAllowMethodsHeaderName, "GET, POST")
+	// Reports may need an API token, which is sent in the Authorization
+	// header.
+	w.Header().Set(CorsAccessControlAllowHeadersHeaderName, "Authorization")
 	if sanitizedOrigin, ok := c.allowCORSOrigin(r.Header.Get("Origin")); ok {
 		log.Printf("cors: sanitized origin %q", sanitizedOrigin)
 		w.Header().Set(CorsAccessControlAllowOriginHeaderName, sanitizedOrigin)
@@ -69,7 +75,5 @@ func (c corsHandler) allowCORSOrigin(origin string) (string, bool) {
 	}
 	parsedOrigin.Path = ""
 
-	originHostname := parsedOrigin.Hostname()
-	_, ok := c.allowedHosts[originHostname]
-	return parsedOrigin.String(), ok
+	return parsedOrigin.String(), c.allowedHosts.Allowed(parsedOrigin.Host)
 }
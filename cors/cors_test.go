@@ -4,10 +4,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/parkr/ping/sites"
 )
 
 func TestAddCorsHeaders_OriginRequestHeader_Success(t *testing.T) {
-	middleware := NewMiddleware([]string{"example.org"}, nil)
+	middleware := NewMiddleware(sites.NewRegistry([]string{"example.org"}), nil)
 
 	recorder := httptest.NewRecorder()
 	request, err := http.NewRequest(http.MethodOptions, "/foo", nil)
@@ -24,6 +26,10 @@ func TestAddCorsHeaders_OriginRequestHeader_Success(t *testing.T) {
 		t.Errorf("expected %s: %v, got: %v", CorsAccessControlAllowMethodsHeaderName, expectedAllowedMethods, actual)
 	}
 
+	if actual := recorder.Header().Get(CorsAccessControlAllowHeadersHeaderName); actual != "Authorization" {
+		t.Errorf("expected %s: Authorization, got: %v", CorsAccessControlAllowHeadersHeaderName, actual)
+	}
+
 	expectedAllowedHosts := "https://example.org"
 	actual = recorder.Header().Get(CorsAccessControlAllowOriginHeaderName)
 	if actual != expectedAllowedHosts {
@@ -32,7 +38,7 @@ func TestAddCorsHeaders_OriginRequestHeader_Success(t *testing.T) {
 }
 
 func TestAddCorsHeaders_RefererRequestHeader_Success(t *testing.T) {
-	middleware := NewMiddleware([]string{"example.org"}, nil)
+	middleware := NewMiddleware(sites.NewRegistry([]string{"example.org"}), nil)
 
 	recorder := httptest.NewRecorder()
 	request, err := http.NewRequest(http.MethodOptions, "/foo", nil)
@@ -57,7 +63,7 @@ func TestAddCorsHeaders_RefererRequestHeader_Success(t *testing.T) {
 }
 
 func TestAddCorsHeaders_NeitherRequestHeader_Success(t *testing.T) {
-	middleware := NewMiddleware([]string{"example.org"}, nil)
+	middleware := NewMiddleware(sites.NewRegistry([]string{"example.org"}), nil)
 
 	recorder := httptest.NewRecorder()
 	request, err := http.NewRequest(http.MethodOptions, "/foo", nil)
@@ -82,7 +88,7 @@ func TestAddCorsHeaders_NeitherRequestHeader_Success(t *testing.T) {
 }
 
 func TestAddCorsHeaders_UnparseableRequestHeader_Success(t *testing.T) {
-	middleware := NewMiddleware([]string{"example.org"}, nil)
+	middleware := NewMiddleware(sites.NewRegistry([]string{"example.org"}), nil)
 
 	recorder := httptest.NewRecorder()
 	request, err := http.NewRequest(http.MethodOptions, "/foo", nil)
@@ -105,3 +111,36 @@ func TestAddCorsHeaders_UnparseableRequestHeader_Success(t *testing.T) {
 		t.Errorf("expected %s: %v, got: %v", CorsAccessControlAllowOriginHeaderName, expectedAllowedHosts, actual)
 	}
 }
+
+func TestAddCorsHeaders_Patterns(t *testing.T) {
+	middleware := NewMiddleware(sites.NewRegistry([]string{"example.org", "*.preview.example.com", "localhost:4000"}), nil)
+
+	testCases := []struct {
+		origin   string
+		expected string
+	}{
+		{"https://example.org", "https://example.org"},
+		{"https://Example.ORG.", "https://Example.ORG."},
+		{"http://example.org:8080", "http://example.org:8080"},
+		{"https://www.example.org", ""},
+		{"https://pr-1.preview.example.com", "https://pr-1.preview.example.com"},
+		{"https://preview.example.com", ""},
+		{"http://localhost:4000", "http://localhost:4000"},
+		{"http://localhost:4001", ""},
+	}
+	for _, testCase := range testCases {
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest(http.MethodOptions, "/foo", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Add("Origin", testCase.origin)
+
+		middleware.ServeHTTP(recorder, request)
+
+		actual := recorder.Header().Get(CorsAccessControlAllowOriginHeaderName)
+		if actual != testCase.expected {
+			t.Errorf("origin %q: expected %s: %q, got: %q", testCase.origin, CorsAccessControlAllowOriginHeaderName, testCase.expected, actual)
+		}
+	}
+}
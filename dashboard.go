@@ -0,0 +1,331 @@
+package ping
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/parkr/ping/analytics"
+	"github.com/parkr/ping/dashboard"
+	"github.com/parkr/ping/database"
+	"github.com/parkr/ping/sites"
+)
+
+const (
+	// dashboardCookieName is the cookie holding the session ID of a viewer
+	// who logged in to the dashboard. Sessions last dashboardSessionAge, or
+	// until the viewer logs out or the token they logged in with is revoked.
+	dashboardCookieName = "ping_dashboard"
+	dashboardSessionAge = 30 * 24 * time.Hour
+	// dashboardCSRFCookieName is the cookie holding the token which the
+	// dashboard's forms send back. Another site can make a viewer's browser
+	// post a form to the dashboard, but can't read the cookie to include it.
+	dashboardCSRFCookieName = "ping_csrf"
+	// dashboardDays is the number of days shown when no range is chosen.
+	dashboardDays = 30
+	// dashboardRows is the number of rows in each table of the dashboard.
+	dashboardRows = 10
+)
+
+// dashboardHandler serves the dashboard, to viewers with an API token which
+// can read reports, given in the Authorization header or by logging in.
+type dashboardHandler struct {
+	// secureCookies marks the login cookie Secure, for servers reached over
+	// HTTPS.
+	secureCookies bool
+	// sites is the allowlist, whose hosts are the sites which can be shown.
+	sites *sites.Registry
+}
+
+func (d dashboardHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/dashboard", "/dashboard/":
+		d.report(w, r)
+	case "/dashboard/login":
+		d.login(w, r)
+	case "/dashboard/logout":
+		d.logout(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// viewer returns the record of the API token the request was made with, or
+// its session was started with, or nil if it has none which can read
+// reports.
+func (d dashboardHandler) viewer(r *http.Request) (*database.APIToken, error) {
+	var record *database.APIToken
+	var err error
+	if token, ok := bearerToken(r); ok {
+		record, err = db.GetAPIToken(token)
+	} else if cookie, cookieErr := r.Cookie(dashboardCookieName); cookieErr == nil {
+		record, err = db.GetDashboardSession(cookie.Value, time.Now())
+	}
+	if err != nil || record == nil || !record.Allows(database.ScopeRead) {
+		return nil, err
+	}
+	return record, nil
+}
+
+// cookie returns a dashboard cookie, which expires after maxAge seconds, or
+// with the browser session if maxAge is 0.
+func (d dashboardHandler) cookie(name, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/dashboard",
+		MaxAge:   maxAge,
+		Secure:   d.secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// csrfToken returns the token in the viewer's CSRF cookie, setting a new one
+// if they have none.
+func (d dashboardHandler) csrfToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(dashboardCSRFCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(random)
+	http.SetCookie(w, d.cookie(dashboardCSRFCookieName, token, 0))
+	return token, nil
+}
+
+// validCSRFToken returns whether the form posted in r sent back the token in
+// the viewer's CSRF cookie.
+func validCSRFToken(r *http.Request) bool {
+	cookie, err := r.Cookie(dashboardCSRFCookieName)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	sent := r.PostFormValue(dashboard.CSRFField)
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(sent)) == 1
+}
+
+// writeLogin responds with the login form, showing message if it isn't
+// empty.
+func (d dashboardHandler) writeLogin(w http.ResponseWriter, r *http.Request, code int, message string) {
+	csrfToken, err := d.csrfToken(w, r)
+	if err != nil {
+		log.Println("Error creating CSRF token:", err)
+		http.Error(w, "unable to show login form", http.StatusInternalServerError)
+		return
+	}
+	dashboard.WriteLogin(w, code, csrfToken, message)
+}
+
+func (d dashboardHandler) login(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		d.writeLogin(w, r, http.StatusOK, "")
+		return
+	}
+	if !validCSRFToken(r) {
+		d.writeLogin(w, r, http.StatusForbidden, "The form expired. Please try again.")
+		return
+	}
+	token := strings.TrimSpace(r.PostFormValue("token"))
+	record, err := db.GetAPIToken(token)
+	if err != nil {
+		log.Println("Error looking up API token:", err)
+		http.Error(w, "unable to look up token", http.StatusInternalServerError)
+		return
+	}
+	if record == nil || !record.Allows(database.ScopeRead) {
+		d.writeLogin(w, r, http.StatusUnauthorized, errInvalidToken.Error())
+		return
+	}
+	now := time.Now()
+	session, err := db.CreateDashboardSession(record.ID, now, now.Add(dashboardSessionAge))
+	if err != nil {
+		log.Println("Error starting dashboard session:", err)
+		http.Error(w, "unable to log in", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, d.cookie(dashboardCookieName, session, int(dashboardSessionAge/time.Second)))
+	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+}
+
+func (d dashboardHandler) logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !validCSRFToken(r) {
+		http.Error(w, "invalid form", http.StatusForbidden)
+		return
+	}
+	if cookie, err := r.Cookie(dashboardCookieName); err == nil {
+		if err := db.DeleteDashboardSession(cookie.Value); err != nil {
+			log.Println("Error ending dashboard session:", err)
+			http.Error(w, "unable to log out", http.StatusInternalServerError)
+			return
+		}
+	}
+	http.SetCookie(w, d.cookie(dashboardCookieName, "", -1))
+	http.Redirect(w, r, "/dashboard/login", http.StatusSeeOther)
+}
+
+// report shows the traffic of the host param, or the first site the viewer
+// can read, between the from and to dates, or over the last dashboardDays.
+func (d dashboardHandler) report(w http.ResponseWriter, r *http.Request) {
+	viewer, err := d.viewer(r)
+	if err != nil {
+		log.Println("Error looking up API token:", err)
+		http.Error(w, "unable to look up token", http.StatusInternalServerError)
+		return
+	}
+	if viewer == nil {
+		http.Redirect(w, r, "/dashboard/login", http.StatusSeeOther)
+		return
+	}
+
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Path = ""
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if filter.To.IsZero() {
+		filter.To = today.AddDate(0, 0, 1)
+	}
+	if filter.From.IsZero() {
+		filter.From = filter.To.AddDate(0, 0, -dashboardDays)
+	}
+	if !filter.From.Before(filter.To) {
+		http.Error(w, "invalid range: from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	siteHosts, err := d.siteHosts(viewer)
+	if err != nil {
+		log.Println("Error listing dashboard sites:", err)
+		http.Error(w, "unable to list sites", http.StatusInternalServerError)
+		return
+	}
+	csrfToken, err := d.csrfToken(w, r)
+	if err != nil {
+		log.Println("Error creating CSRF token:", err)
+		http.Error(w, "unable to load dashboard", http.StatusInternalServerError)
+		return
+	}
+	report := dashboard.Report{
+		From:      filter.From.Format(dashboard.DateFormat),
+		To:        filter.To.AddDate(0, 0, -1).Format(dashboard.DateFormat),
+		CSRFToken: csrfToken,
+		Sites:     siteHosts,
+	}
+	if filter.Host == "" && len(report.Sites) > 0 {
+		filter.Host = report.Sites[0]
+	}
+	if filter.Host != "" {
+		if viewer.Host != "" && !sites.Match(viewer.Host, filter.Host) {
+			http.Error(w, errTokenHost.Error(), http.StatusForbidden)
+			return
+		}
+		if !d.sites.Allowed(filter.Host) {
+			http.Error(w, errUnknownSite.Error(), http.StatusNotFound)
+			return
+		}
+	}
+	report.Host = filter.Host
+	if report.Host == "" {
+		dashboard.WriteReport(w, report)
+		return
+	}
+
+	if err := loadDashboardReport(&report, filter); err != nil {
+		log.Println("Error loading dashboard:", err)
+		http.Error(w, "unable to load dashboard", http.StatusInternalServerError)
+		return
+	}
+	dashboard.WriteReport(w, report)
+}
+
+// siteHosts returns the hosts in the allowlist which viewer can read, for
+// the site picker. A wildcard entry can't be reported on itself, so it's
+// replaced by the hosts it matches which have visits.
+func (d dashboardHandler) siteHosts(viewer *database.APIToken) ([]string, error) {
+	visited, err := db.ListDistinctColumn("host")
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, host := range d.sites.Hosts() {
+		if !sites.IsWildcard(host) {
+			seen[host] = true
+		}
+	}
+	for _, host := range visited {
+		if d.sites.Allowed(host) {
+			seen[host] = true
+		}
+	}
+	hosts := []string{}
+	for host := range seen {
+		if viewer.Host == "" || sites.Match(viewer.Host, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts, nil
+}
+
+// loadDashboardReport fills in the traffic of report's host matching filter.
+func loadDashboardReport(report *dashboard.Report, filter analytics.Filter) error {
+	page := analytics.Page{Limit: dashboardRows}
+	var err error
+	if report.Views, err = db.Views(filter); err != nil {
+		return err
+	}
+	if report.Visitors, err = db.Visitors(filter); err != nil {
+		return err
+	}
+	if report.Sessions, err = db.Sessions(filter); err != nil {
+		return err
+	}
+	series, err := db.Series(filter, dashboardInterval(filter.From, filter.To))
+	if err != nil {
+		return err
+	}
+	report.Chart = dashboard.NewChart(series)
+	if report.TopPages, err = db.TopPaths(filter, page); err != nil {
+		return err
+	}
+	if report.Referrers, err = db.Referrers(filter, page, false); err != nil {
+		return err
+	}
+	if report.Devices, err = db.Breakdown(filter, analytics.DimensionDevice, page); err != nil {
+		return err
+	}
+	if report.Browsers, err = db.Breakdown(filter, analytics.DimensionBrowser, page); err != nil {
+		return err
+	}
+	report.OSes, err = db.Breakdown(filter, analytics.DimensionOS, page)
+	return err
+}
+
+// dashboardInterval picks the periods of the chart, so a range has between
+// a few dozen and a few hundred bars.
+func dashboardInterval(from, to time.Time) analytics.Interval {
+	switch days := to.Sub(from).Hours() / 24; {
+	case days <= 3:
+		return analytics.IntervalHour
+	case days <= 120:
+		return analytics.IntervalDay
+	case days <= 2*365:
+		return analytics.IntervalWeek
+	default:
+		return analytics.IntervalMonth
+	}
+}
@@ -0,0 +1,180 @@
+// Package dashboard renders the pages of the web dashboard which the ping
+// server serves under /dashboard. The templates are embedded in the binary,
+// and the pages need no JavaScript.
+package dashboard
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/parkr/ping/analytics"
+)
+
+// ContentSecurityPolicy only allows the dashboard's own inline styles and
+// forms, and keeps it out of frames.
+const ContentSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'"
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"duration": formatDuration,
+	"percent":  formatPercent,
+	"share":    share,
+	"breakdown": func(title string, entries []analytics.BreakdownEntry, total int) breakdownTable {
+		return breakdownTable{title, entries, total}
+	},
+}).ParseFS(templateFiles, "templates/*.html"))
+
+// Report is everything shown on the dashboard for a site and date range.
+type Report struct {
+	// Sites are the hosts the viewer can choose from, and Host is the one
+	// shown.
+	Sites []string
+	Host  string
+	// From and To are the first and last days of the range, inclusive, in
+	// DateFormat.
+	From string
+	To   string
+
+	Views     int
+	Visitors  int
+	Sessions  analytics.SessionStats
+	Chart     Chart
+	TopPages  []analytics.Entry
+	Referrers []analytics.ReferrerEntry
+	Devices   []analytics.BreakdownEntry
+	Browsers  []analytics.BreakdownEntry
+	OSes      []analytics.BreakdownEntry
+
+	// CSRFToken is sent back by the logout form.
+	CSRFToken string
+}
+
+// CSRFField is the field in which the dashboard's forms send back their CSRF
+// token.
+const CSRFField = "csrf"
+
+// DateFormat is the format of the days in a Report, as used by date inputs.
+const DateFormat = "2006-01-02"
+
+// WriteReport responds with the dashboard page for report.
+func WriteReport(w http.ResponseWriter, report Report) {
+	write(w, http.StatusOK, "report", report)
+}
+
+// WriteLogin responds with the login form, which sends back csrfToken,
+// showing message if it isn't empty.
+func WriteLogin(w http.ResponseWriter, code int, csrfToken, message string) {
+	write(w, code, "login", struct{ CSRFToken, Message string }{csrfToken, message})
+}
+
+func write(w http.ResponseWriter, code int, name string, data interface{}) {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, data); err != nil {
+		log.Printf("dashboard: unable to render %s: %v", name, err)
+		http.Error(w, "unable to render dashboard", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", ContentSecurityPolicy)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	// Note: All w.Header() modifications must be made BEFORE this call.
+	w.WriteHeader(code)
+	w.Write(buf.Bytes())
+}
+
+// Chart is an SVG bar chart of the views in a series, with the visitors of
+// each period drawn over them.
+type Chart struct {
+	Width  int
+	Height int
+	// MaxViews is the views of the highest bar.
+	MaxViews int
+	Bars     []Bar
+}
+
+// Bar is the bar of a single period of a Chart, in SVG user units.
+type Bar struct {
+	X              float64
+	Width          float64
+	ViewsY         float64
+	ViewsHeight    float64
+	VisitorsY      float64
+	VisitorsHeight float64
+	Period         string
+	Views          int
+	Visitors       int
+}
+
+const (
+	chartWidth  = 800
+	chartHeight = 200
+	// barGap is the fraction of each bar's slot left empty.
+	barGap = 0.2
+)
+
+// NewChart lays out a bar for each bucket of a series.
+func NewChart(buckets []analytics.Bucket) Chart {
+	chart := Chart{Width: chartWidth, Height: chartHeight}
+	for _, bucket := range buckets {
+		if bucket.Views > chart.MaxViews {
+			chart.MaxViews = bucket.Views
+		}
+	}
+	if len(buckets) == 0 {
+		return chart
+	}
+
+	slot := float64(chartWidth) / float64(len(buckets))
+	scale := 0.0
+	if chart.MaxViews > 0 {
+		scale = float64(chartHeight) / float64(chart.MaxViews)
+	}
+	for i, bucket := range buckets {
+		viewsHeight := float64(bucket.Views) * scale
+		visitorsHeight := float64(bucket.Visitors) * scale
+		chart.Bars = append(chart.Bars, Bar{
+			X:              float64(i)*slot + slot*barGap/2,
+			Width:          slot * (1 - barGap),
+			ViewsY:         chartHeight - viewsHeight,
+			ViewsHeight:    viewsHeight,
+			VisitorsY:      chartHeight - visitorsHeight,
+			VisitorsHeight: visitorsHeight,
+			Period:         bucket.Period,
+			Views:          bucket.Views,
+			Visitors:       bucket.Visitors,
+		})
+	}
+	return chart
+}
+
+// breakdownTable is a table of the values of one dimension of a Report.
+type breakdownTable struct {
+	Title   string
+	Entries []analytics.BreakdownEntry
+	Total   int
+}
+
+func formatDuration(seconds float64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+func formatPercent(fraction float64) string {
+	return fmt.Sprintf("%.0f%%", fraction*100)
+}
+
+// share returns part as a percentage of total, for the width of a table
+// row's bar.
+func share(part, total int) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(part)*100/float64(total))
+}
@@ -0,0 +1,103 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/parkr/ping/analytics"
+)
+
+func TestNewChart(t *testing.T) {
+	chart := NewChart([]analytics.Bucket{
+		{Period: "2024-01-01 00:00:00", Views: 4, Visitors: 2},
+		{Period: "2024-01-02 00:00:00", Views: 0, Visitors: 0},
+		{Period: "2024-01-03 00:00:00", Views: 2, Visitors: 1},
+		{Period: "2024-01-04 00:00:00", Views: 1, Visitors: 1},
+	})
+
+	if chart.MaxViews != 4 || len(chart.Bars) != 4 {
+		t.Fatalf("expected 4 bars up to 4 views, got: %+v", chart)
+	}
+	first := chart.Bars[0]
+	if first.ViewsY != 0 || first.ViewsHeight != chartHeight {
+		t.Errorf("expected the highest bar to fill the chart, got: %+v", first)
+	}
+	if first.VisitorsHeight != chartHeight/2 || first.VisitorsY != chartHeight/2 {
+		t.Errorf("expected the visitors to fill half the bar, got: %+v", first)
+	}
+	if chart.Bars[1].ViewsHeight != 0 {
+		t.Errorf("expected an empty bar for a day without views, got: %+v", chart.Bars[1])
+	}
+	if first.X != 20 || first.Width != 160 || chart.Bars[1].X != 220 {
+		t.Errorf("expected bars spread evenly across the chart, got: %+v", chart.Bars[:2])
+	}
+
+	if empty := NewChart(nil); len(empty.Bars) != 0 || empty.MaxViews != 0 {
+		t.Errorf("expected an empty chart, got: %+v", empty)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	WriteReport(recorder, Report{
+		Sites:    []string{"example.com", "example.org"},
+		Host:     "example.org",
+		From:     "2024-01-01",
+		To:       "2024-01-31",
+		Views:    10,
+		Visitors: 5,
+		Sessions: analytics.SessionStats{Sessions: 4, BounceRate: 0.5, AverageDuration: 94.5},
+		TopPages: []analytics.Entry{{Host: "example.org", Path: "/<script>alert(1)</script>", Views: 5, Visitors: 3}},
+		Referrers: []analytics.ReferrerEntry{
+			{Source: "Google", Category: "search", Views: 3, Visitors: 2},
+			{Category: "direct", Views: 7, Visitors: 3},
+		},
+		Devices:   []analytics.BreakdownEntry{{Value: "desktop", Views: 10, Visitors: 5}},
+		CSRFToken: "c0ffee",
+	})
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, recorder.Code)
+	}
+	if actual := recorder.Header().Get("Content-Security-Policy"); actual != ContentSecurityPolicy {
+		t.Errorf("expected the content security policy, got: %q", actual)
+	}
+
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		`<option value="example.org" selected>example.org</option>`,
+		`<input type="date" name="from" value="2024-01-01"`,
+		`<div class="value">50%</div><div class="label">Bounce rate</div>`,
+		`<div class="value">1m34s</div>`,
+		`&lt;script&gt;alert(1)&lt;/script&gt;`,
+		`style="width: 50.0%"`,
+		`<span>Direct</span>`,
+		`<h2>Devices</h2>`,
+		`<span>desktop</span>`,
+		`<input type="hidden" name="csrf" value="c0ffee">`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected body to contain %q, got: %s", expected, body)
+		}
+	}
+	if strings.Contains(body, "<script>") {
+		t.Errorf("expected the path to be escaped, got: %s", body)
+	}
+}
+
+func TestWriteLogin(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	WriteLogin(recorder, http.StatusUnauthorized, "c0ffee", "invalid token")
+
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, recorder.Code)
+	}
+	body := recorder.Body.String()
+	for _, expected := range []string{`<p class="error">invalid token</p>`, `action="/dashboard/login"`, `name="token"`, `name="csrf" value="c0ffee"`} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected body to contain %q, got: %s", expected, body)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package ping
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parkr/ping/analytics"
+	"github.com/parkr/ping/database"
+)
+
+func TestDashboard_Login(t *testing.T) {
+	withTestDB(t, nil)
+	token := createTestToken(t, "", database.ScopeRead)
+	handler := NewHandler([]string{"example.org"}, "https://ping.example.com")
+
+	request, err := http.NewRequest("GET", "/dashboard", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assertStatusCode(t, recorder, http.StatusSeeOther)
+	if location := recorder.Header().Get("Location"); location != "/dashboard/login" {
+		t.Errorf("expected a redirect to the login page, got: %q", location)
+	}
+
+	// The login form sets the CSRF cookie, which its form sends back.
+	request, err = http.NewRequest("GET", "/dashboard/login", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assertStatusCode(t, recorder, http.StatusOK)
+	var csrf *http.Cookie
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == dashboardCSRFCookieName {
+			csrf = cookie
+		}
+	}
+	if csrf == nil || !strings.Contains(recorder.Body.String(), `name="csrf" value="`+csrf.Value+`"`) {
+		t.Fatalf("expected a CSRF cookie and its token in the form, got: %+v %s", csrf, recorder.Body)
+	}
+
+	post := func(target string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		request, err := http.NewRequest("POST", target, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder = post("/dashboard/login", url.Values{"token": {token}})
+	assertStatusCode(t, recorder, http.StatusForbidden)
+	recorder = post("/dashboard/login", url.Values{"token": {token}, "csrf": {"forged"}}, csrf)
+	assertStatusCode(t, recorder, http.StatusForbidden)
+
+	recorder = post("/dashboard/login", url.Values{"token": {"ping_nope"}, "csrf": {csrf.Value}}, csrf)
+	assertStatusCode(t, recorder, http.StatusUnauthorized)
+	if !strings.Contains(recorder.Body.String(), "invalid token") {
+		t.Errorf("expected the login page to say the token is invalid, got: %s", recorder.Body)
+	}
+
+	recorder = post("/dashboard/login", url.Values{"token": {token}, "csrf": {csrf.Value}}, csrf)
+	assertStatusCode(t, recorder, http.StatusSeeOther)
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != dashboardCookieName || cookies[0].Value == "" || cookies[0].Value == token {
+		t.Fatalf("expected a cookie holding a session ID, not the token, got: %+v", cookies)
+	}
+	if !cookies[0].HttpOnly || !cookies[0].Secure || cookies[0].SameSite != http.SameSiteStrictMode || cookies[0].Path != "/dashboard" {
+		t.Errorf("expected a secure, HTTP only, same site cookie for /dashboard, got: %+v", cookies[0])
+	}
+	session := cookies[0]
+
+	request, err = http.NewRequest("GET", "/dashboard", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.AddCookie(session)
+	request.AddCookie(csrf)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assertStatusCode(t, recorder, http.StatusOK)
+	if !strings.Contains(recorder.Body.String(), "<h1>example.org</h1>") {
+		t.Errorf("expected the dashboard of the allowed site, got: %s", recorder.Body)
+	}
+
+	assertStatusCode(t, post("/dashboard/logout", nil, session), http.StatusForbidden)
+	recorder = post("/dashboard/logout", url.Values{"csrf": {csrf.Value}}, session, csrf)
+	assertStatusCode(t, recorder, http.StatusSeeOther)
+	if cookies := recorder.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("expected the cookie to be deleted, got: %+v", cookies)
+	}
+
+	// The session ends with logging out, even if the cookie is kept.
+	request, err = http.NewRequest("GET", "/dashboard", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.AddCookie(session)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assertStatusCode(t, recorder, http.StatusSeeOther)
+}
+
+func TestDashboard_Report(t *testing.T) {
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(database.SQLDateTimeFormat)
+	withTestDB(t, []*database.Visit{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/popular-post", UserAgent: "go test client", Device: "desktop", Browser: "Firefox", Referrer: "https://www.google.com/", CreatedAt: yesterday},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/popular-post", UserAgent: "go test client", Device: "mobile", CreatedAt: yesterday},
+		{IP: "127.0.0.1", Host: "example.com", Path: "/secret-post", UserAgent: "go test client", CreatedAt: yesterday},
+		{IP: "127.0.0.1", Host: "example.org", Path: "/old-post", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00"},
+	})
+	oneSite := createTestToken(t, "example.org", database.ScopeRead)
+	handler := NewHandler([]string{"example.org", "example.com"}, "")
+
+	get := func(target string) *httptest.ResponseRecorder {
+		request, err := http.NewRequest("GET", target, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Authorization", "Bearer "+oneSite)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := get("/dashboard")
+	assertStatusCode(t, recorder, http.StatusOK)
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		"<h1>example.org</h1>",
+		`<option value="example.org" selected>`,
+		"<span>/popular-post</span>",
+		"<span>Google</span>",
+		"<span>desktop</span>",
+		"<span>mobile</span>",
+		"<span>Firefox</span>",
+		`<div class="value">2</div><div class="label">Views</div>`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected the dashboard to contain %q, got: %s", expected, body)
+		}
+	}
+	for _, unexpected := range []string{"example.com", "/secret-post", "/old-post"} {
+		if strings.Contains(body, unexpected) {
+			t.Errorf("expected the dashboard not to contain %q, got: %s", unexpected, body)
+		}
+	}
+
+	recorder = get("/dashboard?host=example.org&from=2024-01-01&to=2024-01-31")
+	assertStatusCode(t, recorder, http.StatusOK)
+	if body := recorder.Body.String(); !strings.Contains(body, "<span>/old-post</span>") || strings.Contains(body, "/popular-post") {
+		t.Errorf("expected only the visits in January 2024, got: %s", body)
+	}
+
+	assertStatusCode(t, get("/dashboard?host=example.com"), http.StatusForbidden)
+	assertStatusCode(t, get("/dashboard?from=2024-02-01&to=2024-01-01"), http.StatusBadRequest)
+}
+
+func TestDashboardInterval(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for days, expected := range map[int]analytics.Interval{
+		1:    analytics.IntervalHour,
+		30:   analytics.IntervalDay,
+		365:  analytics.IntervalWeek,
+		1000: analytics.IntervalMonth,
+	} {
+		if actual := dashboardInterval(from, from.AddDate(0, 0, days)); actual != expected {
+			t.Errorf("expected %s for %d days, got: %s", expected, days, actual)
+		}
+	}
+}
+
+func TestDashboard_Sites(t *testing.T) {
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(database.SQLDateTimeFormat)
+	withTestDB(t, []*database.Visit{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/", UserAgent: "go test client", CreatedAt: yesterday},
+		{IP: "127.0.0.1", Host: "blog.example.net", Path: "/", UserAgent: "go test client", CreatedAt: yesterday},
+		{IP: "127.0.0.1", Host: "removed.example.com", Path: "/", UserAgent: "go test client", CreatedAt: yesterday},
+	})
+	allSites := createTestToken(t, "", database.ScopeRead)
+	oneSite := createTestToken(t, "*.example.net", database.ScopeRead)
+	handler := NewHandler([]string{"example.org", "*.example.net", "new.example.org"}, "")
+
+	testCases := []struct {
+		name         string
+		token        string
+		target       string
+		expectedCode int
+		expected     []string
+		unexpected   []string
+	}{
+		{"all sites", allSites, "/dashboard", http.StatusOK,
+			[]string{`<option value="blog.example.net"`, `<option value="example.org"`, `<option value="new.example.org"`},
+			[]string{"removed.example.com", "*.example.net"}},
+		{"one site", oneSite, "/dashboard", http.StatusOK,
+			[]string{`<option value="blog.example.net" selected>`},
+			[]string{"example.org", "removed.example.com"}},
+		{"site removed from the allowlist", allSites, "/dashboard?host=removed.example.com", http.StatusNotFound, nil, nil},
+		{"site of another token", oneSite, "/dashboard?host=example.org", http.StatusForbidden, nil, nil},
+	}
+	for _, testCase := range testCases {
+		request, err := http.NewRequest("GET", testCase.target, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Authorization", "Bearer "+testCase.token)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != testCase.expectedCode {
+			t.Errorf("%s: expected status code %d, got: %d %s", testCase.name, testCase.expectedCode, recorder.Code, recorder.Body)
+		}
+		body := recorder.Body.String()
+		for _, expected := range testCase.expected {
+			if !strings.Contains(body, expected) {
+				t.Errorf("%s: expected the dashboard to contain %q, got: %s", testCase.name, expected, body)
+			}
+		}
+		for _, unexpected := range testCase.unexpected {
+			if strings.Contains(body, unexpected) {
+				t.Errorf("%s: expected the dashboard not to contain %q, got: %s", testCase.name, unexpected, body)
+			}
+		}
+	}
+}
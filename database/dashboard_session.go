@@ -0,0 +1,65 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	insertDashboardSession = `INSERT INTO dashboard_sessions (id_hash, token_id, created_at, expires_at) VALUES (?, ?, ?, ?)`
+	selectDashboardSession = `SELECT t.id, t.name, t.host, t.scope, t.created_at
+		FROM dashboard_sessions s JOIN api_tokens t ON t.id = s.token_id
+		WHERE s.id_hash = ? AND s.expires_at > ?`
+	deleteDashboardSession         = `DELETE FROM dashboard_sessions WHERE id_hash = ?`
+	deleteExpiredDashboardSessions = `DELETE FROM dashboard_sessions WHERE expires_at <= ?`
+	deleteTokenDashboardSessions   = `DELETE FROM dashboard_sessions WHERE token_id = ?`
+)
+
+// CreateDashboardSession starts a session of the dashboard for the API token
+// with tokenID, which lasts until expires, and returns its ID. Like tokens,
+// only a hash of the ID is stored. Expired sessions are deleted.
+func CreateDashboardSession(db *sqlx.DB, tokenID int, now, expires time.Time) (string, error) {
+	id, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(tx.Rebind(deleteExpiredDashboardSessions), now.UTC().Format(SQLDateTimeFormat)); err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(tx.Rebind(insertDashboardSession), hashToken(id), tokenID,
+		now.UTC().Format(SQLDateTimeFormat), expires.UTC().Format(SQLDateTimeFormat))
+	if err != nil {
+		return "", err
+	}
+	return id, tx.Commit()
+}
+
+// GetDashboardSession fetches the record of the API token the session with
+// id was started with, returning nil if the session has expired, or there is
+// no such session or token any more.
+func GetDashboardSession(db *sqlx.DB, id string, now time.Time) (*APIToken, error) {
+	record := APIToken{}
+	err := db.Get(&record, db.Rebind(selectDashboardSession), hashToken(id), now.UTC().Format(SQLDateTimeFormat))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// DeleteDashboardSession ends the session with id.
+func DeleteDashboardSession(db *sqlx.DB, id string) error {
+	_, err := db.Exec(db.Rebind(deleteDashboardSession), hashToken(id))
+	return err
+}
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDashboardSessions(t *testing.T) {
+	db, err := InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	defer db.Close()
+
+	_, token, err := CreateAPIToken(db, "dashboard", "example.org", ScopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	id, err := CreateDashboardSession(db, token.ID, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored string
+	if err := db.Get(&stored, "SELECT id_hash FROM dashboard_sessions"); err != nil {
+		t.Fatal(err)
+	}
+	if stored == id || len(stored) != 64 {
+		t.Errorf("expected only a hash of the session ID to be stored, got %q", stored)
+	}
+
+	testCases := []struct {
+		name     string
+		id       string
+		at       time.Time
+		expected bool
+	}{
+		{"active", id, now.Add(time.Minute), true},
+		{"unknown", "not a session", now.Add(time.Minute), false},
+		{"expired", id, now.Add(2 * time.Hour), false},
+	}
+	for _, testCase := range testCases {
+		record, err := GetDashboardSession(db, testCase.id, testCase.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found := record != nil; found != testCase.expected {
+			t.Errorf("%s: expected a session: %v, got: %+v", testCase.name, testCase.expected, record)
+		}
+		if record != nil && (record.ID != token.ID || record.Host != "example.org") {
+			t.Errorf("%s: expected the session's token %+v, got: %+v", testCase.name, token, record)
+		}
+	}
+
+	if err := DeleteDashboardSession(db, id); err != nil {
+		t.Fatal(err)
+	}
+	if record, err := GetDashboardSession(db, id, now); err != nil || record != nil {
+		t.Errorf("expected a deleted session to be gone, got: %+v, %v", record, err)
+	}
+
+	// Revoking the token ends its sessions.
+	id, err = CreateDashboardSession(db, token.ID, now, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeleteAPIToken(db, token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if record, err := GetDashboardSession(db, id, now); err != nil || record != nil {
+		t.Errorf("expected the session of a revoked token to be gone, got: %+v, %v", record, err)
+	}
+}
@@ -2,8 +2,10 @@ package database
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -11,69 +13,146 @@ const (
 	// This is the format for a SQL Datetime Literal.
 	SQLDateTimeFormat = "2006-01-02 15:04:05"
 
-	schema = `CREATE TABLE visits (
-		id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
-    	ip varchar(255) NOT NULL,
-    	host text NOT NULL,
-      	user_agent text NOT NULL,
-    	path text NOT NULL,
-		created_at datetime NOT NULL
-	);`
-	checkIfSchemaExists = `SELECT COUNT(*) as does_exist FROM sqlite_master WHERE type='table' AND name='visits';`
-	insertVisit         = `INSERT INTO visits (ip, host, path, user_agent, created_at) VALUES (:ip, :host, :path, :user_agent, :created_at)`
-	selectVisit         = `SELECT ip, host, path, user_agent, created_at FROM visits WHERE id = ?`
+	// DriverSQLite is the database/sql driver name for SQLite databases.
+	DriverSQLite = "sqlite3"
+	// DriverPostgres is the database/sql driver name for PostgreSQL databases.
+	DriverPostgres = "postgres"
+
+	insertVisit = `INSERT INTO visits (ip, visitor_id, pageview_id, host, path, user_agent, browser, browser_version, os, device, country, is_bot, referrer, utm_source, utm_medium, utm_campaign, utm_term, utm_content, engaged_seconds, created_at)
+		VALUES (:ip, :visitor_id, :pageview_id, :host, :path, :user_agent, :browser, :browser_version, :os, :device, :country, :is_bot, :referrer, :utm_source, :utm_medium, :utm_campaign, :utm_term, :utm_content, :engaged_seconds, :created_at)`
+	selectVisit = `SELECT ip, visitor_id, pageview_id, host, path, user_agent, browser, browser_version, os, device, country, is_bot, referrer, utm_source, utm_medium, utm_campaign, utm_term, utm_content, engaged_seconds, created_at FROM visits WHERE id = ?`
 )
 
 type TableCheck struct {
 	DoesExist int `db:"does_exist"`
 }
 
+// ParseConnection determines the driver for a PING_DB connection string from
+// its scheme. Connection strings starting with postgres:// or postgresql://
+// are handed to the PostgreSQL driver as-is. Everything else is a SQLite
+// database, optionally prefixed with sqlite:// or sqlite3://.
+func ParseConnection(connection string) (driverName, dataSourceName string) {
+	scheme, rest, found := strings.Cut(connection, "://")
+	if !found {
+		return DriverSQLite, connection
+	}
+	switch strings.ToLower(scheme) {
+	case "postgres", "postgresql":
+		return DriverPostgres, connection
+	case "sqlite", "sqlite3":
+		return DriverSQLite, rest
+	default:
+		return DriverSQLite, connection
+	}
+}
+
 // InitializeForTest creates an in-memory SQL database for tests only.
 func InitializeForTest() (*sqlx.DB, error) {
-	db, err := sqlx.Connect("sqlite3", "") // An empty string appears to create a one-off, in-memory database.
+	db, err := sqlx.Connect(DriverSQLite, "") // An empty string appears to create a one-off, in-memory database.
 	if err != nil {
 		return db, err
 	}
-	_, err = db.Exec(schema)
-	return db, err
+	// Every connection to an in-memory database gets its own database, so
+	// only ever use one.
+	db.SetMaxOpenConns(1)
+	return db, Migrate(db)
 }
 
+// Initialize connects to the database described by connection and applies
+// any pending migrations.
 func Initialize(connection string) (*sqlx.DB, error) {
-	db, err := sqlx.Connect("sqlite3", connection)
+	return Connect(ParseConnection(connection))
+}
+
+// Open connects to the database described by connection without touching
+// its schema.
+func Open(connection string) (*sqlx.DB, error) {
+	driverName, dataSourceName := ParseConnection(connection)
+	return open(driverName, dataSourceName)
+}
+
+// Connect connects to the database with the given driver and applies any
+// pending migrations.
+func Connect(driverName, dataSourceName string) (*sqlx.DB, error) {
+	db, err := open(driverName, dataSourceName)
 	if err != nil {
-		return nil, err
-	}
-	if err := db.Ping(); err != nil {
 		return db, err
 	}
-	var check TableCheck
-	if err := db.Get(&check, checkIfSchemaExists); err != nil {
-		return db, err
+	return db, Migrate(db)
+}
+
+func open(driverName, dataSourceName string) (*sqlx.DB, error) {
+	switch driverName {
+	case DriverSQLite, DriverPostgres:
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driverName)
 	}
-	if check.DoesExist < 1 {
-		if _, err := db.Exec(schema); err != nil {
-			return db, err
-		}
+
+	db, err := sqlx.Connect(driverName, dataSourceName)
+	if err == nil && driverName == DriverSQLite && dataSourceName == "" {
+		// Without a path, SQLite gives every connection its own temporary
+		// database, so only ever use one.
+		db.SetMaxOpenConns(1)
 	}
-	return db, nil
+	return db, err
 }
 
 func Get(db *sqlx.DB, id int) (Visit, error) {
-	row := db.QueryRow(selectVisit, id)
+	row := db.QueryRow(db.Rebind(selectVisit), id)
 	if row.Err() != nil {
 		return Visit{}, row.Err()
 	}
 	visit := Visit{}
-	err := row.Scan(&visit.IP, &visit.Host, &visit.Path, &visit.UserAgent, &visit.CreatedAt)
+	err := row.Scan(&visit.IP, &visit.VisitorID, &visit.PageviewID, &visit.Host, &visit.Path, &visit.UserAgent,
+		&visit.Browser, &visit.BrowserVersion, &visit.OS, &visit.Device, &visit.Country, &visit.IsBot, &visit.Referrer,
+		&visit.Campaign.Source, &visit.Campaign.Medium, &visit.Campaign.Name, &visit.Campaign.Term, &visit.Campaign.Content,
+		&visit.EngagedSeconds, &visit.CreatedAt)
 	return visit, err
 }
 
 type Visit struct {
-	IP        string `db:"ip"`
-	Host      string `db:"host"`
-	Path      string `db:"path"`
-	UserAgent string `db:"user_agent"`
-	CreatedAt string `db:"created_at"`
+	// IP is the address of the visitor, or empty if only a hashed VisitorID
+	// is kept.
+	IP string `db:"ip"`
+	// VisitorID identifies the visitor when counting unique visitors. It
+	// defaults to the IP.
+	VisitorID string `db:"visitor_id"`
+	// PageviewID is a random ID the v2 script gives the page view, so the
+	// time the page was engaged with can be reported later.
+	PageviewID string `db:"pageview_id"`
+	Host       string `db:"host"`
+	Path       string `db:"path"`
+	UserAgent  string `db:"user_agent"`
+	// Browser, BrowserVersion, OS and Device are parsed from the UserAgent.
+	// They are empty for visits recorded before they were introduced.
+	Browser        string `db:"browser"`
+	BrowserVersion string `db:"browser_version"`
+	OS             string `db:"os"`
+	Device         string `db:"device"`
+	// Country is the ISO 3166-1 alpha-2 code of the country the visit came
+	// from, if known.
+	Country string `db:"country"`
+	// IsBot is set if the UserAgent belongs to a bot.
+	IsBot bool `db:"is_bot"`
+	// Referrer is the external page which linked to this one, without its
+	// query string, or empty for direct visits and internal navigation.
+	Referrer string `db:"referrer"`
+	// EngagedSeconds is how long the page was visible for, or 0 if that
+	// hasn't been reported.
+	EngagedSeconds int    `db:"engaged_seconds"`
+	CreatedAt      string `db:"created_at"`
+
+	// Campaign holds the UTM parameters from the page's URL, if any.
+	Campaign
+}
+
+// Campaign holds the UTM parameters of the link a visitor followed to a page.
+type Campaign struct {
+	Source  string `db:"utm_source"`
+	Medium  string `db:"utm_medium"`
+	Name    string `db:"utm_campaign"`
+	Term    string `db:"utm_term"`
+	Content string `db:"utm_content"`
 }
 
 func (v *Visit) String() string {
@@ -81,6 +160,32 @@ func (v *Visit) String() string {
 }
 
 func (v *Visit) Save(db *sqlx.DB) error {
+	if v.VisitorID == "" {
+		v.VisitorID = v.IP
+	}
 	_, err := db.NamedExec(insertVisit, v)
 	return err
 }
+
+// SaveVisits inserts the visits and adds each to its visitor's session, all
+// in a single transaction, so a batch costs one commit.
+func SaveVisits(db *sqlx.DB, visits []*Visit) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, visit := range visits {
+		if visit.VisitorID == "" {
+			visit.VisitorID = visit.IP
+		}
+		if _, err := tx.NamedExec(insertVisit, visit); err != nil {
+			return err
+		}
+		if err := trackSession(tx, visit); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
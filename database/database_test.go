@@ -0,0 +1,43 @@
+package database
+
+import "testing"
+
+func TestParseConnection(t *testing.T) {
+	for _, testCase := range []struct {
+		connection     string
+		driverName     string
+		dataSourceName string
+	}{
+		{"", DriverSQLite, ""},
+		{"./data/ping.sqlite3", DriverSQLite, "./data/ping.sqlite3"},
+		{"file:ping.sqlite3?cache=shared", DriverSQLite, "file:ping.sqlite3?cache=shared"},
+		{"sqlite:///srv/data/ping.sqlite3", DriverSQLite, "/srv/data/ping.sqlite3"},
+		{"sqlite3://ping.sqlite3", DriverSQLite, "ping.sqlite3"},
+		{"postgres://ping@localhost/ping?sslmode=disable", DriverPostgres, "postgres://ping@localhost/ping?sslmode=disable"},
+		{"postgresql://ping@localhost/ping", DriverPostgres, "postgresql://ping@localhost/ping"},
+		{"POSTGRES://ping@localhost/ping", DriverPostgres, "POSTGRES://ping@localhost/ping"},
+	} {
+		driverName, dataSourceName := ParseConnection(testCase.connection)
+		if driverName != testCase.driverName || dataSourceName != testCase.dataSourceName {
+			t.Errorf("ParseConnection(%q) = (%q, %q), want (%q, %q)",
+				testCase.connection, driverName, dataSourceName, testCase.driverName, testCase.dataSourceName)
+		}
+	}
+}
+
+func TestInitialize_TemporaryDatabase(t *testing.T) {
+	db, err := Initialize("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// A second connection would open an empty database of its own.
+	if max := db.Stats().MaxOpenConnections; max != 1 {
+		t.Errorf("expected a single connection to the temporary database, got: %d", max)
+	}
+	var count int
+	if err := db.Get(&count, "SELECT COUNT(*) FROM visits"); err != nil {
+		t.Errorf("expected the temporary database to be migrated, got: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	updateEngagement = `UPDATE visits SET engaged_seconds = ?
+		WHERE host = ? AND pageview_id = ? AND engaged_seconds < ?`
+	countPageviews = `SELECT COUNT(*) FROM visits WHERE host = ? AND pageview_id = ?`
+)
+
+// RecordEngagement sets the number of seconds the page view with the given
+// ID on host was engaged with. The v2 script reports a running total each
+// time the page is hidden, so the time only ever grows, even if reports
+// arrive out of order. It returns false if there is no such page view.
+func RecordEngagement(db *sqlx.DB, host, pageviewID string, seconds int) (bool, error) {
+	result, err := db.Exec(db.Rebind(updateEngagement), seconds, host, pageviewID, seconds)
+	if err != nil {
+		return false, err
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated > 0 {
+		return updated > 0, err
+	}
+
+	var count int
+	err = db.Get(&count, db.Rebind(countPageviews), host, pageviewID)
+	return count > 0, err
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestRecordEngagement(t *testing.T) {
+	db, err := InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	defer db.Close()
+
+	visit := &Visit{IP: "127.0.0.1", PageviewID: "abc123", Host: "example.org", Path: "/root", CreatedAt: "2024-01-01 09:00:00"}
+	if err := visit.Save(db); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, testCase := range []struct {
+		host     string
+		id       string
+		seconds  int
+		found    bool
+		expected int
+	}{
+		{"example.org", "abc123", 10, true, 10},
+		{"example.org", "abc123", 25, true, 25},
+		// A report which arrives late doesn't take time away.
+		{"example.org", "abc123", 10, true, 25},
+		{"example.org", "def456", 10, false, 25},
+		// Page views on one host can't be updated from another.
+		{"example.com", "abc123", 60, false, 25},
+	} {
+		found, err := RecordEngagement(db, testCase.host, testCase.id, testCase.seconds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != testCase.found {
+			t.Errorf("%s%s: expected found to be %t, got %t", testCase.host, testCase.id, testCase.found, found)
+		}
+
+		visit, err := Get(db, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if visit.EngagedSeconds != testCase.expected {
+			t.Errorf("%s%s: expected %d engaged seconds, got %d", testCase.host, testCase.id, testCase.expected, visit.EngagedSeconds)
+		}
+	}
+}
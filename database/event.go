@@ -0,0 +1,88 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	insertEvent         = `INSERT INTO events (ip, visitor_id, host, path, name, user_agent, is_bot, created_at) VALUES (:ip, :visitor_id, :host, :path, :name, :user_agent, :is_bot, :created_at) RETURNING id`
+	insertEventProperty = `INSERT INTO event_properties (event_id, key, value) VALUES (?, ?, ?)`
+	selectEvent         = `SELECT ip, visitor_id, host, path, name, user_agent, is_bot, created_at FROM events WHERE id = ?`
+	selectEventProps    = `SELECT key, value FROM event_properties WHERE event_id = ?`
+)
+
+// Event is a custom event, like a signup or a download, which happened on a
+// page.
+type Event struct {
+	IP         string            `db:"ip"`
+	VisitorID  string            `db:"visitor_id"`
+	Host       string            `db:"host"`
+	Path       string            `db:"path"`
+	Name       string            `db:"name"`
+	UserAgent  string            `db:"user_agent"`
+	IsBot      bool              `db:"is_bot"`
+	CreatedAt  string            `db:"created_at"`
+	Properties map[string]string `db:"-"`
+}
+
+func (e *Event) String() string {
+	return fmt.Sprintf("<%s | %s triggered %q on %s%s %v @ %s>", e.CreatedAt, e.IP, e.Name, e.Host, e.Path, e.Properties, e.UserAgent)
+}
+
+// Save inserts the event and its properties in a single transaction.
+func (e *Event) Save(db *sqlx.DB) error {
+	if e.VisitorID == "" {
+		e.VisitorID = e.IP
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query, args, err := tx.BindNamed(insertEvent, e)
+	if err != nil {
+		return err
+	}
+	var id int64
+	if err := tx.Get(&id, query, args...); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(e.Properties))
+	for key := range e.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, err := tx.Exec(tx.Rebind(insertEventProperty), id, key, e.Properties[key]); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetEvent fetches the event with the given id and its properties.
+func GetEvent(db *sqlx.DB, id int) (Event, error) {
+	event := Event{}
+	if err := db.Get(&event, db.Rebind(selectEvent), id); err != nil {
+		return event, err
+	}
+	rows, err := db.Query(db.Rebind(selectEventProps), id)
+	if err != nil {
+		return event, err
+	}
+	defer rows.Close()
+	event.Properties = map[string]string{}
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return event, err
+		}
+		event.Properties[key] = value
+	}
+	return event, rows.Err()
+}
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migrations holds the SQL migrations for each driver, in
+// migrations/<driver>/<version>_<name>.sql. Migrations are applied in version
+// order and must never be edited once released; add a new one instead.
+//
+//go:embed migrations
+var migrations embed.FS
+
+// ErrSchemaTooNew is returned when the database has migrations applied which
+// this binary does not know about, i.e. it was migrated by a newer version of
+// ping.
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+
+const (
+	sqliteCreateSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer NOT NULL PRIMARY KEY,
+		name text NOT NULL,
+		applied_at datetime NOT NULL
+	);`
+	postgresCreateSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer NOT NULL PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamp NOT NULL
+	);`
+
+	sqliteCheckIfTableExists   = `SELECT COUNT(*) as does_exist FROM sqlite_master WHERE type='table' AND name=?;`
+	postgresCheckIfTableExists = `SELECT COUNT(*) as does_exist FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?;`
+
+	selectSchemaVersion    = `SELECT COALESCE(MAX(version), 0) FROM schema_migrations;`
+	insertSchemaMigrations = `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?);`
+)
+
+// Migration is a single forward schema change.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// Migrations lists every migration for the given driver in version order.
+func Migrations(driverName string) ([]Migration, error) {
+	dir := path.Join("migrations", driverName)
+	entries, err := fs.ReadDir(migrations, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for database driver %q: %w", driverName, err)
+	}
+
+	all := make([]Migration, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %q has no version prefix: %w", name, err)
+		}
+		contents, err := fs.ReadFile(migrations, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, Migration{Version: version, Name: name, SQL: string(contents)})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	return all, nil
+}
+
+// SchemaVersion returns the version of the last migration applied to db, or 0
+// if none have been applied yet.
+func SchemaVersion(db *sqlx.DB) (int, error) {
+	checkIfTableExists := sqliteCheckIfTableExists
+	if db.DriverName() == DriverPostgres {
+		checkIfTableExists = postgresCheckIfTableExists
+	}
+	var check TableCheck
+	if err := db.Get(&check, db.Rebind(checkIfTableExists), "schema_migrations"); err != nil {
+		return 0, err
+	}
+	if check.DoesExist < 1 {
+		return 0, nil
+	}
+	var version int
+	err := db.Get(&version, selectSchemaVersion)
+	return version, err
+}
+
+// PendingMigrations lists the migrations which have yet to be applied to db.
+// It returns ErrSchemaTooNew if db is ahead of the migrations in this binary.
+func PendingMigrations(db *sqlx.DB) ([]Migration, error) {
+	all, err := Migrations(db.DriverName())
+	if err != nil {
+		return nil, err
+	}
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := 0
+	if len(all) > 0 {
+		latest = all[len(all)-1].Version
+	}
+	if version > latest {
+		return nil, fmt.Errorf("%w: database is at version %d, binary supports up to %d", ErrSchemaTooNew, version, latest)
+	}
+
+	pending := []Migration{}
+	for _, migration := range all {
+		if migration.Version > version {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies all pending migrations to db, each in its own transaction.
+func Migrate(db *sqlx.DB) error {
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	createSchemaMigrations := sqliteCreateSchemaMigrations
+	if db.DriverName() == DriverPostgres {
+		createSchemaMigrations = postgresCreateSchemaMigrations
+	}
+	if _, err := db.Exec(createSchemaMigrations); err != nil {
+		return err
+	}
+
+	for _, migration := range pending {
+		if err := applyMigration(db, migration); err != nil {
+			return fmt.Errorf("applying migration %s: %w", migration.Name, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(db *sqlx.DB, migration Migration) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(migration.SQL); err != nil {
+		return err
+	}
+	appliedAt := time.Now().UTC().Format(SQLDateTimeFormat)
+	if _, err := tx.Exec(tx.Rebind(insertSchemaMigrations), migration.Version, migration.Name, appliedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
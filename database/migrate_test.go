@@ -0,0 +1,140 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func connectForTest(t *testing.T) *sqlx.DB {
+	t.Helper()
+	db, err := sqlx.Connect(DriverSQLite, "")
+	if err != nil {
+		t.Fatalf("unable to connect: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrate_FreshDatabase(t *testing.T) {
+	db := connectForTest(t)
+
+	all, err := Migrations(DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 {
+		t.Fatal("expected at least one migration")
+	}
+
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != len(all) {
+		t.Errorf("expected %d pending migrations, got %d", len(all), len(pending))
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("unable to migrate: %v", err)
+	}
+
+	version, err := SchemaVersion(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := all[len(all)-1].Version; version != expected {
+		t.Errorf("expected schema version %d, got %d", expected, version)
+	}
+
+	pending, err = PendingMigrations(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("expected no pending migrations, got %+v", pending)
+	}
+
+	// Migrating an up-to-date database is a no-op.
+	if err := Migrate(db); err != nil {
+		t.Fatalf("unable to migrate twice: %v", err)
+	}
+}
+
+func TestMigrate_ExistingVisitsTable(t *testing.T) {
+	db := connectForTest(t)
+
+	// This is the schema created before migrations were introduced.
+	_, err := db.Exec(`CREATE TABLE visits (
+		id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+		ip varchar(255) NOT NULL,
+		host text NOT NULL,
+		user_agent text NOT NULL,
+		path text NOT NULL,
+		created_at datetime NOT NULL
+	);
+	INSERT INTO visits (ip, host, path, user_agent, created_at) VALUES
+	('127.0.0.1', 'example.org', '/root', 'go test client', datetime('now'));`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("unable to migrate: %v", err)
+	}
+
+	var count int
+	if err := db.Get(&count, "SELECT COUNT(*) FROM visits"); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected existing visit to be kept, got %d visits", count)
+	}
+
+	visit, err := Get(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visit.VisitorID != "127.0.0.1" {
+		t.Errorf("expected existing visit to be identified by its ip, got %q", visit.VisitorID)
+	}
+}
+
+func TestMigrate_SchemaTooNew(t *testing.T) {
+	db := connectForTest(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("unable to migrate: %v", err)
+	}
+
+	_, err := db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (9999, '9999_from_the_future.sql', datetime('now'))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(db); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("expected ErrSchemaTooNew, got: %v", err)
+	}
+}
+
+func TestMigrations_MatchAcrossDrivers(t *testing.T) {
+	sqlite, err := Migrations(DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	postgres, err := Migrations(DriverPostgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sqlite) != len(postgres) {
+		t.Fatalf("expected the same number of migrations for each driver, got %d for %s and %d for %s",
+			len(sqlite), DriverSQLite, len(postgres), DriverPostgres)
+	}
+	for i := range sqlite {
+		if sqlite[i].Version != postgres[i].Version || sqlite[i].Name != postgres[i].Name {
+			t.Errorf("expected migration %d to match, got %s and %s", i, sqlite[i].Name, postgres[i].Name)
+		}
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE visits ADD COLUMN referrer text NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+ALTER TABLE visits ADD COLUMN utm_source text NOT NULL DEFAULT '';
+ALTER TABLE visits ADD COLUMN utm_medium text NOT NULL DEFAULT '';
+ALTER TABLE visits ADD COLUMN utm_campaign text NOT NULL DEFAULT '';
+ALTER TABLE visits ADD COLUMN utm_term text NOT NULL DEFAULT '';
+ALTER TABLE visits ADD COLUMN utm_content text NOT NULL DEFAULT '';
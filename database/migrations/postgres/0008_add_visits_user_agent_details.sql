@@ -0,0 +1,4 @@
+ALTER TABLE visits ADD COLUMN browser text NOT NULL DEFAULT '';
+ALTER TABLE visits ADD COLUMN browser_version text NOT NULL DEFAULT '';
+ALTER TABLE visits ADD COLUMN os text NOT NULL DEFAULT '';
+ALTER TABLE visits ADD COLUMN device text NOT NULL DEFAULT '';
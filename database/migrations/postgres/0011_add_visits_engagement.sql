@@ -0,0 +1,3 @@
+ALTER TABLE visits ADD COLUMN pageview_id varchar(64) NOT NULL DEFAULT '';
+ALTER TABLE visits ADD COLUMN engaged_seconds integer NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS visits_host_pageview_id ON visits (host, pageview_id);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id serial NOT NULL PRIMARY KEY,
+	name text NOT NULL,
+	token_hash varchar(64) NOT NULL UNIQUE,
+	host varchar(255) NOT NULL DEFAULT '',
+	scope varchar(16) NOT NULL,
+	created_at timestamp NOT NULL
+);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS dashboard_sessions (
+	id_hash varchar(64) NOT NULL PRIMARY KEY,
+	token_id integer NOT NULL,
+	created_at timestamp NOT NULL,
+	expires_at timestamp NOT NULL
+);
+CREATE INDEX IF NOT EXISTS dashboard_sessions_token_id ON dashboard_sessions (token_id);
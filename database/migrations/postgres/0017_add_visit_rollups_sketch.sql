@@ -0,0 +1 @@
+ALTER TABLE visit_rollups ADD COLUMN visitor_sketch bytea;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS visits (
+	id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+	ip varchar(255) NOT NULL,
+	host text NOT NULL,
+	user_agent text NOT NULL,
+	path text NOT NULL,
+	created_at datetime NOT NULL
+);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS events (
+	id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+	ip varchar(255) NOT NULL,
+	host text NOT NULL,
+	path text NOT NULL,
+	name text NOT NULL,
+	user_agent text NOT NULL,
+	created_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS events_host_name_created_at ON events (host, name, created_at);
+
+CREATE TABLE IF NOT EXISTS event_properties (
+	event_id integer NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+	key text NOT NULL,
+	value text NOT NULL,
+	PRIMARY KEY (event_id, key)
+);
@@ -0,0 +1,9 @@
+ALTER TABLE visits ADD COLUMN visitor_id varchar(255) NOT NULL DEFAULT '';
+UPDATE visits SET visitor_id = ip;
+ALTER TABLE events ADD COLUMN visitor_id varchar(255) NOT NULL DEFAULT '';
+UPDATE events SET visitor_id = ip;
+
+CREATE TABLE IF NOT EXISTS salts (
+	day varchar(10) NOT NULL PRIMARY KEY,
+	salt varchar(64) NOT NULL
+);
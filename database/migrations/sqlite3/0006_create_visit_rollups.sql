@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS visit_rollups (
+	created_at datetime NOT NULL,
+	host text NOT NULL,
+	path text NOT NULL,
+	views integer NOT NULL,
+	visitors integer NOT NULL,
+	PRIMARY KEY (created_at, host, path)
+);
+CREATE INDEX IF NOT EXISTS visits_created_at ON visits (created_at);
@@ -0,0 +1,16 @@
+ALTER TABLE visits ADD COLUMN is_bot integer NOT NULL DEFAULT 0;
+ALTER TABLE events ADD COLUMN is_bot integer NOT NULL DEFAULT 0;
+
+CREATE TABLE visit_rollups_by_bot (
+	created_at datetime NOT NULL,
+	host text NOT NULL,
+	path text NOT NULL,
+	is_bot integer NOT NULL DEFAULT 0,
+	views integer NOT NULL,
+	visitors integer NOT NULL,
+	PRIMARY KEY (created_at, host, path, is_bot)
+);
+INSERT INTO visit_rollups_by_bot (created_at, host, path, views, visitors)
+	SELECT created_at, host, path, views, visitors FROM visit_rollups;
+DROP TABLE visit_rollups;
+ALTER TABLE visit_rollups_by_bot RENAME TO visit_rollups;
@@ -0,0 +1 @@
+ALTER TABLE visits ADD COLUMN country varchar(2) NOT NULL DEFAULT '';
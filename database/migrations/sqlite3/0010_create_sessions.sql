@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS sessions (
+	id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+	visitor_id varchar(255) NOT NULL,
+	host text NOT NULL,
+	entry_path text NOT NULL,
+	exit_path text NOT NULL,
+	pageviews integer NOT NULL DEFAULT 1,
+	duration integer NOT NULL DEFAULT 0,
+	is_bot integer NOT NULL DEFAULT 0,
+	started_at datetime NOT NULL,
+	last_seen_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS sessions_host_visitor_id_last_seen_at ON sessions (host, visitor_id, last_seen_at);
+CREATE INDEX IF NOT EXISTS sessions_started_at ON sessions (started_at);
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS sites (
+	host varchar(255) NOT NULL PRIMARY KEY,
+	created_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
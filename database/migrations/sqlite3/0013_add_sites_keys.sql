@@ -0,0 +1,3 @@
+ALTER TABLE sites ADD COLUMN site_id varchar(32);
+ALTER TABLE sites ADD COLUMN secret varchar(128) NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS sites_site_id ON sites (site_id);
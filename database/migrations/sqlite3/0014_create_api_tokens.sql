@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+	name text NOT NULL,
+	token_hash varchar(64) NOT NULL UNIQUE,
+	host varchar(255) NOT NULL DEFAULT '',
+	scope varchar(16) NOT NULL,
+	created_at datetime NOT NULL
+);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS submission_nonces (
+	site_id varchar(32) NOT NULL,
+	nonce varchar(64) NOT NULL,
+	created_at datetime NOT NULL,
+	PRIMARY KEY (site_id, nonce)
+);
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	insertNonce         = `INSERT INTO submission_nonces (site_id, nonce, created_at) VALUES (?, ?, ?) ON CONFLICT (site_id, nonce) DO NOTHING`
+	deleteExpiredNonces = `DELETE FROM submission_nonces WHERE created_at < ?`
+)
+
+// UseNonce records that the site with siteID sent a signed submission with
+// nonce at now, returning false if the site sent it before. Nonces used
+// before expiredBefore are forgotten, so the caller must reject submissions
+// signed long enough ago that their nonce may have been.
+func UseNonce(db *sqlx.DB, siteID, nonce string, now, expiredBefore time.Time) (bool, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(tx.Rebind(deleteExpiredNonces), expiredBefore.UTC().Format(SQLDateTimeFormat)); err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(tx.Rebind(insertNonce), siteID, nonce, now.UTC().Format(SQLDateTimeFormat))
+	if err != nil {
+		return false, err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return inserted == 1, tx.Commit()
+}
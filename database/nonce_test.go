@@ -0,0 +1,45 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUseNonce(t *testing.T) {
+	db, err := InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	use := func(siteID, nonce string, at time.Time) bool {
+		t.Helper()
+		fresh, err := UseNonce(db, siteID, nonce, at, at.Add(-10*time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fresh
+	}
+
+	if !use("site", "abc", now) {
+		t.Error("expected the first use of a nonce to be fresh")
+	}
+	if use("site", "abc", now.Add(time.Minute)) {
+		t.Error("expected a nonce to be refused the second time")
+	}
+	if !use("other", "abc", now.Add(time.Minute)) {
+		t.Error("expected another site to be able to use the same nonce")
+	}
+	if !use("site", "abc", now.Add(time.Hour)) {
+		t.Error("expected an expired nonce to be forgotten")
+	}
+
+	var count int
+	if err := db.Get(&count, "SELECT COUNT(*) FROM submission_nonces"); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected the expired nonces to be deleted, got %d nonces", count)
+	}
+}
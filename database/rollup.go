@@ -0,0 +1,179 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/parkr/ping/hll"
+)
+
+const (
+	selectOldestVisit  = `SELECT MIN(created_at) FROM visits WHERE created_at < ?`
+	selectLatestRollup = `SELECT MAX(created_at) FROM visit_rollups`
+	countRollupsForDay = `SELECT COUNT(*) FROM visit_rollups WHERE created_at = ?`
+	selectDayTotals    = `SELECT host, path, is_bot, COUNT(id) AS views, COUNT(DISTINCT visitor_id) AS visitors FROM visits
+		WHERE created_at >= ? AND created_at < ? GROUP BY host, path, is_bot`
+	selectDayVisitors = `SELECT DISTINCT host, path, is_bot, visitor_id FROM visits WHERE created_at >= ? AND created_at < ?`
+	insertRollup      = `INSERT INTO visit_rollups (created_at, host, path, is_bot, views, visitors, visitor_sketch) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	deleteVisitsBatch = `DELETE FROM visits WHERE id IN (
+		SELECT id FROM visits WHERE created_at < ? ORDER BY id LIMIT ?)`
+)
+
+// RollupHorizon returns the time before which visits have been rolled up
+// into daily rows in the visit_rollups table, or the zero time if none have.
+// Any raw visits left before the horizon are waiting to be pruned and must
+// not be counted again.
+func RollupHorizon(db *sqlx.DB) (time.Time, error) {
+	var latest sql.NullString
+	if err := db.Get(&latest, selectLatestRollup); err != nil {
+		return time.Time{}, err
+	}
+	if !latest.Valid {
+		return time.Time{}, nil
+	}
+	day, err := parseDateTime(latest.String)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day.AddDate(0, 0, 1), nil
+}
+
+// PruneVisits rolls up and deletes the visits created before the start of the
+// UTC day containing before. Each call rolls up at most one day and deletes
+// at most batchSize visits, so the database is never locked for long; call
+// it until it returns 0 to prune everything.
+//
+// Days are rolled up oldest first, and rolling up a day moves the
+// RollupHorizon past it before any of its visits are deleted, so counts are
+// never short or doubled while pruning is in progress.
+func PruneVisits(db *sqlx.DB, before time.Time, batchSize int) (int, error) {
+	before = before.UTC().Truncate(24 * time.Hour)
+
+	horizon, err := RollupHorizon(db)
+	if err != nil {
+		return 0, err
+	}
+	if horizon.Before(before) {
+		if err := rollupOldestDay(db, before); err != nil {
+			return 0, err
+		}
+		if horizon, err = RollupHorizon(db); err != nil {
+			return 0, err
+		}
+	}
+	if horizon.IsZero() {
+		return 0, nil
+	}
+
+	result, err := db.Exec(db.Rebind(deleteVisitsBatch), horizon.Format(SQLDateTimeFormat), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+// rollupKey identifies a row of visit_rollups within a day.
+type rollupKey struct {
+	host  string
+	path  string
+	isBot bool
+}
+
+// rollupOldestDay aggregates the visits of the oldest day before before into
+// visit_rollups, unless that day has already been rolled up. Each row keeps a
+// sketch of its visitor IDs, so visitors can still be counted once across
+// several days and paths.
+func rollupOldestDay(db *sqlx.DB, before time.Time) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldest sql.NullString
+	if err := tx.Get(&oldest, tx.Rebind(selectOldestVisit), before.Format(SQLDateTimeFormat)); err != nil {
+		return err
+	}
+	if !oldest.Valid {
+		return nil
+	}
+	createdAt, err := parseDateTime(oldest.String)
+	if err != nil {
+		return err
+	}
+	day := createdAt.Truncate(24 * time.Hour).Format(SQLDateTimeFormat)
+	nextDay := createdAt.Truncate(24*time.Hour).AddDate(0, 0, 1).Format(SQLDateTimeFormat)
+
+	var existing int
+	if err := tx.Get(&existing, tx.Rebind(countRollupsForDay), day); err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+
+	totals := []struct {
+		Host     string `db:"host"`
+		Path     string `db:"path"`
+		IsBot    bool   `db:"is_bot"`
+		Views    int    `db:"views"`
+		Visitors int    `db:"visitors"`
+	}{}
+	if err := tx.Select(&totals, tx.Rebind(selectDayTotals), day, nextDay); err != nil {
+		return err
+	}
+	sketches, err := daySketches(tx, day, nextDay)
+	if err != nil {
+		return err
+	}
+	for _, total := range totals {
+		sketch, err := sketches[rollupKey{total.Host, total.Path, total.IsBot}].MarshalBinary()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(tx.Rebind(insertRollup), day, total.Host, total.Path, total.IsBot, total.Views, total.Visitors, sketch)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// daySketches adds the visitor IDs of the visits between day and nextDay to
+// a sketch for each host, path and bot flag.
+func daySketches(tx *sqlx.Tx, day, nextDay string) (map[rollupKey]*hll.Sketch, error) {
+	rows, err := tx.Query(tx.Rebind(selectDayVisitors), day, nextDay)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sketches := map[rollupKey]*hll.Sketch{}
+	for rows.Next() {
+		var key rollupKey
+		var visitorID string
+		if err := rows.Scan(&key.host, &key.path, &key.isBot, &visitorID); err != nil {
+			return nil, err
+		}
+		if sketches[key] == nil {
+			sketches[key] = &hll.Sketch{}
+		}
+		sketches[key].Add(visitorID)
+	}
+	return sketches, rows.Err()
+}
+
+// parseDateTime parses a created_at value as returned by the database driver:
+// SQLite returns the stored text, while PostgreSQL returns a timestamp which
+// database/sql formats as RFC 3339.
+func parseDateTime(value string) (time.Time, error) {
+	for _, layout := range []string{SQLDateTimeFormat, time.RFC3339Nano} {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unable to parse %q as a datetime", value)
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parkr/ping/hll"
+)
+
+func TestPruneVisits(t *testing.T) {
+	db, err := InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+		INSERT INTO visits (ip, visitor_id, host, path, user_agent, created_at) VALUES
+		('127.0.0.1', 'a', 'example.org', '/root', 'go test client', '2024-01-01 09:00:00'),
+		('127.0.0.1', 'a', 'example.org', '/root', 'go test client', '2024-01-01 10:00:00'),
+		('127.0.0.2', 'b', 'example.org', '/root', 'go test client', '2024-01-01 11:00:00'),
+		('127.0.0.2', 'b', 'example.org', '/foo', 'go test client', '2024-01-01 23:59:59'),
+		('127.0.0.1', 'a', 'example.org', '/root', 'go test client', '2024-01-03 09:00:00'),
+		('127.0.0.1', 'a', 'example.org', '/root', 'go test client', '2024-01-04 09:00:00');`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Visits on the day containing before are kept.
+	before := time.Date(2024, time.January, 4, 12, 0, 0, 0, time.UTC)
+
+	// The first call rolls up 2024-01-01 and deletes the first batch.
+	deleted, err := PruneVisits(db, before, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 3 {
+		t.Errorf("expected 3 visits to be deleted, got %d", deleted)
+	}
+	horizon, err := RollupHorizon(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC); !horizon.Equal(expected) {
+		t.Errorf("expected rollup horizon %s, got %s", expected, horizon)
+	}
+
+	total := deleted
+	for deleted > 0 {
+		if deleted, err = PruneVisits(db, before, 3); err != nil {
+			t.Fatal(err)
+		}
+		total += deleted
+	}
+	if total != 5 {
+		t.Errorf("expected 5 visits to be deleted, got %d", total)
+	}
+
+	var remaining int
+	if err := db.Get(&remaining, "SELECT COUNT(*) FROM visits"); err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 1 {
+		t.Errorf("expected 1 visit to remain, got %d", remaining)
+	}
+
+	rollups := []struct {
+		CreatedAt string `db:"created_at"`
+		Path      string `db:"path"`
+		Views     int    `db:"views"`
+		Visitors  int    `db:"visitors"`
+		Sketch    []byte `db:"visitor_sketch"`
+	}{}
+	if err := db.Select(&rollups, "SELECT created_at, path, views, visitors, visitor_sketch FROM visit_rollups ORDER BY created_at, path"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		day      string
+		path     string
+		views    int
+		visitors int
+	}{
+		{"2024-01-01", "/foo", 1, 1},
+		{"2024-01-01", "/root", 3, 2},
+		{"2024-01-03", "/root", 1, 1},
+	}
+	if len(rollups) != len(expected) {
+		t.Fatalf("expected %d rollups, got %+v", len(expected), rollups)
+	}
+	for i, rollup := range rollups {
+		if !strings.HasPrefix(rollup.CreatedAt, expected[i].day) || rollup.Path != expected[i].path ||
+			rollup.Views != expected[i].views || rollup.Visitors != expected[i].visitors {
+			t.Errorf("expected rollup %+v, got %+v", expected[i], rollup)
+		}
+		var sketch hll.Sketch
+		if err := sketch.UnmarshalBinary(rollup.Sketch); err != nil {
+			t.Errorf("expected rollup %+v to have a visitor sketch: %v", expected[i], err)
+		} else if sketch.Count() != expected[i].visitors {
+			t.Errorf("expected the sketch of rollup %+v to count %d visitors, got %d", expected[i], expected[i].visitors, sketch.Count())
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// SaltDayFormat is the format of the day a salt is used for.
+	SaltDayFormat = "2006-01-02"
+
+	insertSalt         = `INSERT INTO salts (day, salt) VALUES (?, ?) ON CONFLICT (day) DO NOTHING`
+	selectSalt         = `SELECT salt FROM salts WHERE day = ?`
+	deleteExpiredSalts = `DELETE FROM salts WHERE day < ?`
+)
+
+// DailySalt returns the salt for day, formatted with SaltDayFormat, creating
+// it if this is the first request for that day. The salts of all earlier days
+// are deleted, so hashes made with them can never be recomputed.
+func DailySalt(db *sqlx.DB, day string) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// Another ping process sharing the database may have created the salt
+	// already, in which case its salt wins.
+	if _, err := tx.Exec(tx.Rebind(insertSalt), day, hex.EncodeToString(random)); err != nil {
+		return "", err
+	}
+	var salt string
+	if err := tx.Get(&salt, tx.Rebind(selectSalt), day); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(tx.Rebind(deleteExpiredSalts), day); err != nil {
+		return "", err
+	}
+	return salt, tx.Commit()
+}
@@ -0,0 +1,43 @@
+package database
+
+import "testing"
+
+func TestDailySalt(t *testing.T) {
+	db, err := InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	defer db.Close()
+
+	first, err := DailySalt(db, "2024-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 64 {
+		t.Errorf("expected a 64 character salt, got %q", first)
+	}
+
+	again, err := DailySalt(db, "2024-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first {
+		t.Errorf("expected the same salt for the same day, got %q and %q", first, again)
+	}
+
+	next, err := DailySalt(db, "2024-01-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next == first {
+		t.Errorf("expected a new salt for the next day, got %q", next)
+	}
+
+	var days []string
+	if err := db.Select(&days, "SELECT day FROM salts"); err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 1 || days[0] != "2024-01-02" {
+		t.Errorf("expected only the salt for 2024-01-02 to be kept, got %v", days)
+	}
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SessionTimeout is how long a visitor can go without viewing a page before
+// their next view starts a new session.
+const SessionTimeout = 30 * time.Minute
+
+const (
+	selectOpenSession = `SELECT id, started_at FROM sessions
+		WHERE host = ? AND visitor_id = ? AND last_seen_at >= ? ORDER BY last_seen_at DESC LIMIT 1`
+	extendSession = `UPDATE sessions SET exit_path = ?, pageviews = pageviews + 1, duration = ?, last_seen_at = ? WHERE id = ?`
+	insertSession = `INSERT INTO sessions (visitor_id, host, entry_path, exit_path, is_bot, started_at, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	deleteSessionsBatch = `DELETE FROM sessions WHERE id IN (
+		SELECT id FROM sessions WHERE last_seen_at < ? ORDER BY id LIMIT ?)`
+	selectSession = `SELECT visitor_id, host, entry_path, exit_path, pageviews, duration, is_bot, started_at, last_seen_at
+		FROM sessions WHERE id = ?`
+)
+
+// Session is a visitor's uninterrupted series of page views on a host. It
+// ends once the visitor has been gone for SessionTimeout.
+type Session struct {
+	VisitorID string `db:"visitor_id"`
+	Host      string `db:"host"`
+	// EntryPath is the first page viewed in the session and ExitPath the
+	// last.
+	EntryPath string `db:"entry_path"`
+	ExitPath  string `db:"exit_path"`
+	Pageviews int    `db:"pageviews"`
+	// Duration is the number of seconds between the first and last page
+	// views.
+	Duration   int    `db:"duration"`
+	IsBot      bool   `db:"is_bot"`
+	StartedAt  string `db:"started_at"`
+	LastSeenAt string `db:"last_seen_at"`
+}
+
+// trackSession adds the visit to its visitor's open session on the host, or
+// starts a new session if they have none. Visits without a VisitorID can't
+// be told apart and aren't part of any session.
+func trackSession(tx *sqlx.Tx, visit *Visit) error {
+	if visit.VisitorID == "" {
+		return nil
+	}
+	createdAt, err := parseDateTime(visit.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	var open struct {
+		ID        int    `db:"id"`
+		StartedAt string `db:"started_at"`
+	}
+	err = tx.Get(&open, tx.Rebind(selectOpenSession),
+		visit.Host, visit.VisitorID, createdAt.Add(-SessionTimeout).Format(SQLDateTimeFormat))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		_, err = tx.Exec(tx.Rebind(insertSession),
+			visit.VisitorID, visit.Host, visit.Path, visit.Path, visit.IsBot, visit.CreatedAt, visit.CreatedAt)
+	case err == nil:
+		var startedAt time.Time
+		if startedAt, err = parseDateTime(open.StartedAt); err != nil {
+			return err
+		}
+		duration := int(createdAt.Sub(startedAt) / time.Second)
+		_, err = tx.Exec(tx.Rebind(extendSession), visit.Path, duration, visit.CreatedAt, open.ID)
+	}
+	return err
+}
+
+// PruneSessions deletes at most batchSize of the sessions which ended before
+// the start of the UTC day containing before, and returns how many were
+// deleted; call it until it returns 0 to prune everything.
+func PruneSessions(db *sqlx.DB, before time.Time, batchSize int) (int, error) {
+	before = before.UTC().Truncate(24 * time.Hour)
+	result, err := db.Exec(db.Rebind(deleteSessionsBatch), before.Format(SQLDateTimeFormat), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	return int(deleted), err
+}
+
+// GetSession fetches the session with the given id.
+func GetSession(db *sqlx.DB, id int) (Session, error) {
+	session := Session{}
+	err := db.Get(&session, db.Rebind(selectSession), id)
+	return session, err
+}
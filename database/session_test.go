@@ -0,0 +1,54 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestSaveVisits_TracksSessions(t *testing.T) {
+	db, err := InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	defer db.Close()
+
+	err = SaveVisits(db, []*Visit{
+		{VisitorID: "a", Host: "example.org", Path: "/root", CreatedAt: "2024-01-01 09:00:00"},
+		{VisitorID: "a", Host: "example.org", Path: "/foo", CreatedAt: "2024-01-01 09:10:00"},
+		// Another visitor, and the same visitor on another host, have their
+		// own sessions.
+		{VisitorID: "b", Host: "example.org", Path: "/foo", CreatedAt: "2024-01-01 09:15:00"},
+		{VisitorID: "a", Host: "example.com", Path: "/", CreatedAt: "2024-01-01 09:20:00"},
+		{VisitorID: "a", Host: "example.org", Path: "/bar", CreatedAt: "2024-01-01 09:40:00"},
+		// Returning after more than 30 minutes starts a new session.
+		{VisitorID: "a", Host: "example.org", Path: "/root", CreatedAt: "2024-01-01 10:10:01"},
+		// Visitors who can't be identified aren't tracked.
+		{Host: "example.org", Path: "/root", CreatedAt: "2024-01-01 10:10:01"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	if err := db.Get(&count, "SELECT COUNT(*) FROM sessions"); err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("expected 4 sessions, got %d", count)
+	}
+
+	for id, expected := range map[int]Session{
+		1: {VisitorID: "a", Host: "example.org", EntryPath: "/root", ExitPath: "/bar", Pageviews: 3, Duration: 40 * 60},
+		2: {VisitorID: "b", Host: "example.org", EntryPath: "/foo", ExitPath: "/foo", Pageviews: 1},
+		3: {VisitorID: "a", Host: "example.com", EntryPath: "/", ExitPath: "/", Pageviews: 1},
+		4: {VisitorID: "a", Host: "example.org", EntryPath: "/root", ExitPath: "/root", Pageviews: 1},
+	} {
+		session, err := GetSession(db, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.StartedAt, session.LastSeenAt = "", ""
+		if session != expected {
+			t.Errorf("expected session %d to be %+v, got %+v", id, expected, session)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	selectSiteHosts = `SELECT host FROM sites ORDER BY host`
+	selectSites     = `SELECT host, COALESCE(site_id, '') AS site_id, secret FROM sites ORDER BY host`
+	selectSite      = `SELECT host, COALESCE(site_id, '') AS site_id, secret FROM sites WHERE site_id = ?`
+	insertSite      = `INSERT INTO sites (host, site_id, secret) VALUES (?, ?, ?)`
+	deleteSite      = `DELETE FROM sites WHERE host = ?`
+)
+
+// Site is a host in the sites table. Its SiteID is public, and is given by
+// the tracking script of the site's pages. Its Secret, if it has one, signs
+// the visits submitted by the site's servers.
+type Site struct {
+	Host   string `db:"host"`
+	SiteID string `db:"site_id"`
+	Secret string `db:"secret"`
+}
+
+// ListSites returns the hosts in the sites table, which are allowed in
+// addition to those the server was configured with.
+func ListSites(db *sqlx.DB) ([]string, error) {
+	hosts := []string{}
+	if err := db.Select(&hosts, selectSiteHosts); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// GetSites returns every site in the sites table.
+func GetSites(db *sqlx.DB) ([]Site, error) {
+	sites := []Site{}
+	if err := db.Select(&sites, selectSites); err != nil {
+		return nil, err
+	}
+	return sites, nil
+}
+
+// GetSite fetches the site with the given site ID, returning nil if there is
+// no such site.
+func GetSite(db *sqlx.DB, siteID string) (*Site, error) {
+	site := Site{}
+	err := db.Get(&site, db.Rebind(selectSite), siteID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &site, nil
+}
+
+// AddSite adds host to the sites table with a new random site ID and, if
+// withSecret is set, a new random secret.
+func AddSite(db *sqlx.DB, host string, withSecret bool) (*Site, error) {
+	siteID, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	site := &Site{Host: host, SiteID: siteID}
+	if withSecret {
+		if site.Secret, err = randomHex(32); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := db.Exec(db.Rebind(insertSite), site.Host, site.SiteID, site.Secret); err != nil {
+		return nil, err
+	}
+	return site, nil
+}
+
+// RemoveSite deletes host from the sites table, returning false if it wasn't
+// there.
+func RemoveSite(db *sqlx.DB, host string) (bool, error) {
+	result, err := db.Exec(db.Rebind(deleteSite), host)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
+
+func randomHex(size int) (string, error) {
+	random := make([]byte, size)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
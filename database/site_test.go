@@ -0,0 +1,90 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestListSites(t *testing.T) {
+	db, err := InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	defer db.Close()
+
+	hosts, err := ListSites(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 0 {
+		t.Errorf("expected no sites, got %v", hosts)
+	}
+
+	if _, err := db.Exec(`INSERT INTO sites (host) VALUES ('example.org'), ('example.com')`); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err = ListSites(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(hosts, ",") != "example.com,example.org" {
+		t.Errorf("expected both sites in order, got %v", hosts)
+	}
+}
+
+func TestAddSite(t *testing.T) {
+	db, err := InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	defer db.Close()
+
+	public, err := AddSite(db, "example.org", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(public.SiteID) != 16 || public.Secret != "" {
+		t.Errorf("expected a 16 character site ID and no secret, got %+v", public)
+	}
+	signed, err := AddSite(db, "example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signed.Secret) != 64 || signed.SiteID == public.SiteID {
+		t.Errorf("expected a new site ID and a 64 character secret, got %+v", signed)
+	}
+	if _, err := AddSite(db, "example.org", false); err == nil {
+		t.Error("expected an error adding example.org twice")
+	}
+
+	site, err := GetSite(db, signed.SiteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if site == nil || *site != *signed {
+		t.Errorf("expected %+v, got %+v", signed, site)
+	}
+	if site, err := GetSite(db, "unknown"); err != nil || site != nil {
+		t.Errorf("expected no site, got %+v, %v", site, err)
+	}
+
+	// Sites inserted by hand have no site ID.
+	if _, err := db.Exec(`INSERT INTO sites (host) VALUES ('example.net')`); err != nil {
+		t.Fatal(err)
+	}
+	all, err := GetSites(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[2].Host != "example.org" || all[1].SiteID != "" {
+		t.Errorf("expected all three sites, got %+v", all)
+	}
+
+	removed, err := RemoveSite(db, "example.org")
+	if err != nil || !removed {
+		t.Errorf("expected example.org to be removed, got %v, %v", removed, err)
+	}
+	if removed, err := RemoveSite(db, "example.org"); err != nil || removed {
+		t.Errorf("expected example.org to be gone, got %v, %v", removed, err)
+	}
+}
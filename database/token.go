@@ -0,0 +1,122 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// ScopeRead allows a token to read reports.
+	ScopeRead = "read"
+	// ScopeWrite allows a token to read reports and submit visits.
+	ScopeWrite = "write"
+
+	// tokenPrefix starts every API token, so they're easy to spot in config
+	// files and logs.
+	tokenPrefix = "ping_"
+
+	insertAPIToken  = `INSERT INTO api_tokens (name, token_hash, host, scope, created_at) VALUES (?, ?, ?, ?, ?) RETURNING id`
+	selectAPIToken  = `SELECT id, name, host, scope, created_at FROM api_tokens WHERE token_hash = ?`
+	selectAPITokens = `SELECT id, name, host, scope, created_at FROM api_tokens ORDER BY id`
+	deleteAPIToken  = `DELETE FROM api_tokens WHERE id = ?`
+)
+
+// APIToken grants access to the ping API. Only a hash of the token itself is
+// stored, so it can't be recovered from the database.
+type APIToken struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+	// Host is the site the token may access, or empty for every site.
+	Host      string `db:"host"`
+	Scope     string `db:"scope"`
+	CreatedAt string `db:"created_at"`
+}
+
+// Allows returns whether the token grants scope.
+func (t *APIToken) Allows(scope string) bool {
+	return t.Scope == ScopeWrite || t.Scope == scope
+}
+
+// CreateAPIToken creates a token with the given name and scope, for host or,
+// if host is empty, every site. The token is returned along with its record,
+// and can't be retrieved again.
+func CreateAPIToken(db *sqlx.DB, name, host, scope string) (string, *APIToken, error) {
+	if scope != ScopeRead && scope != ScopeWrite {
+		return "", nil, fmt.Errorf("invalid scope %q: must be %q or %q", scope, ScopeRead, ScopeWrite)
+	}
+	random, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+	token := tokenPrefix + random
+	record := &APIToken{
+		Name:      name,
+		Host:      host,
+		Scope:     scope,
+		CreatedAt: time.Now().UTC().Format(SQLDateTimeFormat),
+	}
+	var id int
+	err = db.QueryRowx(db.Rebind(insertAPIToken), record.Name, hashToken(token), record.Host, record.Scope, record.CreatedAt).Scan(&id)
+	if err != nil {
+		return "", nil, err
+	}
+	record.ID = id
+	return token, record, nil
+}
+
+// GetAPIToken fetches the record of token, returning nil if there is no such
+// token.
+func GetAPIToken(db *sqlx.DB, token string) (*APIToken, error) {
+	record := APIToken{}
+	err := db.Get(&record, db.Rebind(selectAPIToken), hashToken(token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ListAPITokens returns the records of every token.
+func ListAPITokens(db *sqlx.DB) ([]APIToken, error) {
+	records := []APIToken{}
+	if err := db.Select(&records, selectAPITokens); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// DeleteAPIToken revokes the token with the given ID, and ends the dashboard
+// sessions started with it, returning false if there was no such token.
+func DeleteAPIToken(db *sqlx.DB, id int) (bool, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(tx.Rebind(deleteTokenDashboardSessions), id); err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(tx.Rebind(deleteAPIToken), id)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, tx.Commit()
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAPITokens(t *testing.T) {
+	db, err := InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize db: %v", err)
+	}
+	defer db.Close()
+
+	token, created, err := CreateAPIToken(db, "dashboard", "example.org", ScopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, "ping_") || len(token) != 69 {
+		t.Errorf("expected a ping_ token with 64 hex characters, got %q", token)
+	}
+	if _, _, err := CreateAPIToken(db, "admin", "", "admin"); err == nil {
+		t.Error("expected an error creating a token with an unknown scope")
+	}
+
+	var stored string
+	if err := db.Get(&stored, "SELECT token_hash FROM api_tokens"); err != nil {
+		t.Fatal(err)
+	}
+	if stored == token || len(stored) != 64 {
+		t.Errorf("expected only a hash of the token to be stored, got %q", stored)
+	}
+
+	record, err := GetAPIToken(db, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record == nil || record.ID != created.ID || record.Host != "example.org" || record.Scope != ScopeRead {
+		t.Errorf("expected %+v, got %+v", created, record)
+	}
+	if !record.Allows(ScopeRead) || record.Allows(ScopeWrite) {
+		t.Errorf("expected a read token to allow reads only")
+	}
+	if record, err := GetAPIToken(db, token+"0"); err != nil || record != nil {
+		t.Errorf("expected no token, got %+v, %v", record, err)
+	}
+
+	records, err := ListAPITokens(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Name != "dashboard" {
+		t.Errorf("expected the dashboard token, got %+v", records)
+	}
+
+	deleted, err := DeleteAPIToken(db, created.ID)
+	if err != nil || !deleted {
+		t.Errorf("expected the token to be deleted, got %v, %v", deleted, err)
+	}
+	if record, err := GetAPIToken(db, token); err != nil || record != nil {
+		t.Errorf("expected the token to be revoked, got %+v, %v", record, err)
+	}
+}
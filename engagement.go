@@ -0,0 +1,85 @@
+package ping
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/parkr/ping/batch"
+	"github.com/parkr/ping/jsv1"
+)
+
+const (
+	maxPageviewIDLength = 64
+	// maxEngagedSeconds is the longest time on a page which is believed: a
+	// day.
+	maxEngagedSeconds = 24 * 60 * 60
+)
+
+// validPageviewID reports whether id looks like a page view ID made by the
+// v2 script: a UUID, or some other short run of letters, digits and dashes.
+func validPageviewID(id string) bool {
+	if id == "" || len(id) > maxPageviewIDLength {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// engageHandler records how many seconds the page view given by the id param,
+// on the host in the referer, was engaged with, as reported by the v2 script
+// with navigator.sendBeacon when the page is hidden. With batched writes, the
+// page view may still be queued, so the queue is flushed before giving up on
+// it.
+type engageHandler struct {
+	writer *batch.Writer
+}
+
+func (e engageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parsedReferer, err := parseReferer(r.Referer())
+	if err != nil {
+		log.Printf("referer invalid (%q): %v", sanitizeUserInput(r.Referer()), err)
+		jsv1.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id := r.FormValue("id")
+	if !validPageviewID(id) {
+		jsv1.Error(w, http.StatusBadRequest, "invalid pageview id")
+		return
+	}
+
+	seconds, err := strconv.Atoi(r.FormValue("seconds"))
+	if err != nil || seconds < 1 || seconds > maxEngagedSeconds {
+		jsv1.Error(w, http.StatusBadRequest, fmt.Sprintf("seconds must be between 1 and %d", maxEngagedSeconds))
+		return
+	}
+
+	host := sanitizeUserInput(parsedReferer.Host)
+	found, err := db.RecordEngagement(host, id, seconds)
+	if err == nil && !found && e.writer != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), maxFlushWait)
+		err = e.writer.Flush(ctx)
+		cancel()
+		if err == nil {
+			found, err = db.RecordEngagement(host, id, seconds)
+		}
+	}
+	if err != nil {
+		log.Println("Error saving engagement to db:", err)
+		jsv1.Error(w, http.StatusInternalServerError, "unable to record engagement")
+		return
+	}
+	if !found {
+		jsv1.Error(w, http.StatusNotFound, "unknown pageview")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
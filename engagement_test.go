@@ -0,0 +1,108 @@
+package ping
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/parkr/ping/analytics"
+	"github.com/parkr/ping/database"
+)
+
+func TestEngage(t *testing.T) {
+	handler := newTestHandler(t, []string{"example.org"}, nil)
+
+	for _, pageview := range []string{"0f8fad5b-d9cb-469f-a165-70867728950e", "lq2x7k-4fzyo82mvyr"} {
+		recorder := serve(handler, newSubmitRequest(t, url.Values{
+			"host":     {"example.org"},
+			"path":     {"/long-read"},
+			"pageview": {pageview},
+		}))
+		assertStatusCode(t, recorder, http.StatusCreated)
+	}
+
+	visit, err := database.Get(db.DB(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visit.PageviewID != "0f8fad5b-d9cb-469f-a165-70867728950e" {
+		t.Errorf("expected the pageview id to be stored, got: %q", visit.PageviewID)
+	}
+
+	testCases := []struct {
+		name         string
+		id           string
+		seconds      string
+		expectedCode int
+	}{
+		{"first report", "0f8fad5b-d9cb-469f-a165-70867728950e", "12", http.StatusNoContent},
+		{"later report", "0f8fad5b-d9cb-469f-a165-70867728950e", "40", http.StatusNoContent},
+		{"other page view", "lq2x7k-4fzyo82mvyr", "20", http.StatusNoContent},
+	}
+	for _, testCase := range testCases {
+		recorder := serve(handler, newEngageRequest(t, url.Values{"id": {testCase.id}, "seconds": {testCase.seconds}}))
+		if recorder.Code != testCase.expectedCode {
+			t.Errorf("%s: expected status code %d, got: %d %s", testCase.name, testCase.expectedCode, recorder.Code, recorder.Body)
+		}
+		verifyCorsHeaders(t, recorder, "https://example.org")
+	}
+
+	request, err := http.NewRequest("GET", "/engagement?host=example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := serve(handler, request)
+
+	assertStatusCode(t, recorder, http.StatusOK)
+
+	var body map[string][]analytics.EngagementEntry
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	expected := []analytics.EngagementEntry{
+		{Host: "example.org", Path: "/long-read", Views: 2, Visitors: 1, AverageSeconds: 30, MedianSeconds: 30},
+	}
+	if !reflect.DeepEqual(body["entries"], expected) {
+		t.Errorf("expected entries %+v, got: %+v", expected, body["entries"])
+	}
+}
+
+func TestEngage_InvalidParams(t *testing.T) {
+	handler := newTestHandler(t, []string{"example.org"}, []*database.Visit{
+		{IP: "127.0.0.1", PageviewID: "abc", Host: "example.org", Path: "/", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00"},
+	})
+
+	testCases := []struct {
+		name         string
+		query        url.Values
+		referrer     string
+		expectedCode int
+		expectedBody string
+	}{
+		{"missing id", url.Values{"seconds": {"10"}}, "", http.StatusBadRequest, "invalid pageview id"},
+		{"quoted id", url.Values{"id": {"abc\"def"}, "seconds": {"10"}}, "", http.StatusBadRequest, "invalid pageview id"},
+		{"long id", url.Values{"id": {strings.Repeat("a", 65)}, "seconds": {"10"}}, "", http.StatusBadRequest, "invalid pageview id"},
+		{"missing seconds", url.Values{"id": {"abc"}}, "", http.StatusBadRequest, "seconds must be between 1 and 86400"},
+		{"zero seconds", url.Values{"id": {"abc"}, "seconds": {"0"}}, "", http.StatusBadRequest, "seconds must be between 1 and 86400"},
+		{"more than a day", url.Values{"id": {"abc"}, "seconds": {"86401"}}, "", http.StatusBadRequest, "seconds must be between 1 and 86400"},
+		{"unknown page view", url.Values{"id": {"def"}, "seconds": {"10"}}, "", http.StatusNotFound, "unknown pageview"},
+		{"unauthorized host", url.Values{"id": {"abc"}, "seconds": {"10"}}, "https://unauthorized.org/", http.StatusUnauthorized, "unauthorized host"},
+	}
+	for _, testCase := range testCases {
+		request := newEngageRequest(t, testCase.query)
+		if testCase.referrer != "" {
+			request.Header.Set("Referer", testCase.referrer)
+		}
+		recorder := serve(handler, request)
+
+		if recorder.Code != testCase.expectedCode {
+			t.Errorf("%s: expected status code %d, got: %d %s", testCase.name, testCase.expectedCode, recorder.Code, recorder.Body)
+		}
+		if !strings.Contains(recorder.Body.String(), testCase.expectedBody) {
+			t.Errorf("%s: expected body to contain %q, got: %s", testCase.name, testCase.expectedBody, recorder.Body)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package ping
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/parkr/ping/bots"
+	"github.com/parkr/ping/database"
+	"github.com/parkr/ping/jsv1"
+)
+
+const (
+	maxEventNameLength          = 64
+	maxEventProperties          = 10
+	maxEventPropertyKeyLength   = 64
+	maxEventPropertyValueLength = 255
+)
+
+type eventv2Handler struct {
+	nextHandler http.Handler
+}
+
+// eventv2 takes an XHR request with the host, path, name & props of an event
+// in the form and rewrites the referer, so the host of the event is
+// authorized just like the host of a visit.
+func (e eventv2Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.FormValue("host")
+	path := r.FormValue("path")
+	if host == "" || path == "" || r.FormValue("name") == "" {
+		jsv1.Error(w, http.StatusBadRequest, "missing param")
+		return
+	}
+	referer := url.URL{Host: host, Path: path}
+
+	req := r.Clone(r.Context())
+	req.Header.Set("Referer", referer.String())
+
+	e.nextHandler.ServeHTTP(w, req)
+}
+
+type eventRecorder struct {
+	options handlerOptions
+}
+
+// recordEvent saves the event named in the form on the page in the referer.
+func (e eventRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parsedReferer, err := parseReferer(r.Referer())
+	if err != nil {
+		log.Printf("referer invalid (%q): %v", sanitizeUserInput(r.Referer()), err)
+		jsv1.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userAgent := r.Header.Get("User-Agent")
+	if userAgent == "" {
+		log.Println("empty user-agent")
+		jsv1.Error(w, http.StatusBadRequest, "empty user-agent")
+		return
+	}
+
+	name := r.FormValue("name")
+	if len(name) > maxEventNameLength {
+		jsv1.Error(w, http.StatusBadRequest, fmt.Sprintf("event name longer than %d characters", maxEventNameLength))
+		return
+	}
+
+	properties, err := parseEventProperties(r.FormValue("props"))
+	if err != nil {
+		jsv1.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	host := sanitizeUserInput(parsedReferer.Host)
+	userAgent = sanitizeUserInput(userAgent)
+	ip, visitorID, err := e.options.visitors.identify(host, e.options.proxies.ClientIP(r), userAgent, now)
+	if err != nil {
+		log.Println("Error identifying visitor:", err)
+		jsv1.Error(w, http.StatusInternalServerError, "unable to identify visitor")
+		return
+	}
+
+	event := &database.Event{
+		IP:         ip,
+		VisitorID:  visitorID,
+		Host:       host,
+		Path:       sanitizeUserInput(parsedReferer.Path),
+		Name:       sanitizeUserInput(name),
+		UserAgent:  userAgent,
+		IsBot:      bots.IsBot(userAgent),
+		CreatedAt:  now.Format(database.SQLDateTimeFormat),
+		Properties: properties,
+	}
+	log.Println("Logging event:", sanitizeUserInput(event.String()))
+
+	if err := db.SaveEvent(event); err != nil {
+		log.Println("Error saving to db:", err)
+		jsv1.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	jsv1.Write(w, http.StatusCreated)
+}
+
+// parseEventProperties parses the JSON object of string properties sent with
+// an event, enforcing the limits on their number and size.
+func parseEventProperties(props string) (map[string]string, error) {
+	properties := map[string]string{}
+	if props == "" {
+		return properties, nil
+	}
+	if err := json.Unmarshal([]byte(props), &properties); err != nil {
+		return nil, fmt.Errorf("props must be a JSON object of strings")
+	}
+	if len(properties) > maxEventProperties {
+		return nil, fmt.Errorf("more than %d props", maxEventProperties)
+	}
+	sanitized := make(map[string]string, len(properties))
+	for key, value := range properties {
+		if key == "" || len(key) > maxEventPropertyKeyLength {
+			return nil, fmt.Errorf("prop names must be 1 to %d characters", maxEventPropertyKeyLength)
+		}
+		if len(value) > maxEventPropertyValueLength {
+			return nil, fmt.Errorf("prop values must be at most %d characters", maxEventPropertyValueLength)
+		}
+		sanitized[sanitizeUserInput(key)] = sanitizeUserInput(value)
+	}
+	return sanitized, nil
+}
@@ -0,0 +1,156 @@
+package ping
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/parkr/ping/analytics"
+	"github.com/parkr/ping/database"
+	"github.com/parkr/ping/dnt"
+	"github.com/parkr/ping/secgpc"
+)
+
+func newEventRequest(t *testing.T, form url.Values) *http.Request {
+	t.Helper()
+	request, err := http.NewRequest("POST", "/event", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("User-Agent", "go test client")
+	request.Header.Set("Referer", "https://example.org/pricing")
+	return request
+}
+
+func TestEvent_Success(t *testing.T) {
+	withTestDB(t, nil)
+
+	request := newEventRequest(t, url.Values{
+		"host":  {"example.org"},
+		"path":  {"/pricing"},
+		"name":  {"signup"},
+		"props": {`{"plan":"pro","button":"hero"}`},
+	})
+	request.RemoteAddr = "100.0.0.0"
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "")
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusCreated)
+	verifyCorsHeaders(t, recorder, "https://example.org")
+
+	event, err := database.GetEvent(db.DB(), 1)
+	if err != nil {
+		t.Fatalf("expected no error getting event from db, got: %v", err)
+	}
+
+	if event.Host != "example.org" || event.Path != "/pricing" || event.Name != "signup" {
+		t.Errorf("expected signup event on example.org/pricing, got: %s", &event)
+	}
+	if event.IP != "100.0.0.0" {
+		t.Errorf("expected event ip %q, got: %q", "100.0.0.0", event.IP)
+	}
+	expectedProperties := map[string]string{"plan": "pro", "button": "hero"}
+	if !reflect.DeepEqual(event.Properties, expectedProperties) {
+		t.Errorf("expected event properties %v, got: %v", expectedProperties, event.Properties)
+	}
+}
+
+func TestEvent_InvalidParams(t *testing.T) {
+	withTestDB(t, nil)
+
+	for _, testCase := range []struct {
+		form     url.Values
+		code     int
+		expected string
+	}{
+		{url.Values{"host": {"example.org"}, "path": {"/"}}, http.StatusBadRequest, "missing param"},
+		{url.Values{"host": {"example.org"}, "name": {"signup"}}, http.StatusBadRequest, "missing param"},
+		{url.Values{"host": {"unauthorized.org"}, "path": {"/"}, "name": {"signup"}}, http.StatusUnauthorized, "unauthorized host"},
+		{url.Values{"host": {"example.org"}, "path": {"/"}, "name": {strings.Repeat("a", 65)}}, http.StatusBadRequest, "event name longer than 64 characters"},
+		{url.Values{"host": {"example.org"}, "path": {"/"}, "name": {"signup"}, "props": {`{"plan":1}`}}, http.StatusBadRequest, "props must be a JSON object of strings"},
+		{url.Values{"host": {"example.org"}, "path": {"/"}, "name": {"signup"}, "props": {`["pro"]`}}, http.StatusBadRequest, "props must be a JSON object of strings"},
+		{url.Values{"host": {"example.org"}, "path": {"/"}, "name": {"signup"}, "props": {`{"a":"1","b":"2","c":"3","d":"4","e":"5","f":"6","g":"7","h":"8","i":"9","j":"10","k":"11"}`}}, http.StatusBadRequest, "more than 10 props"},
+		{url.Values{"host": {"example.org"}, "path": {"/"}, "name": {"signup"}, "props": {`{"plan":"` + strings.Repeat("a", 256) + `"}`}}, http.StatusBadRequest, "prop values must be at most 255 characters"},
+	} {
+		recorder := httptest.NewRecorder()
+		handler := NewHandler([]string{"example.org"}, "")
+		handler.ServeHTTP(recorder, newEventRequest(t, testCase.form))
+
+		if recorder.Code != testCase.code {
+			t.Errorf("%v: expected status code %d, got %d", testCase.form, testCase.code, recorder.Code)
+		}
+		expected := `(function(){console.error("` + testCase.expected + `")})();`
+		if recorder.Body.String() != expected {
+			t.Errorf("%v: expected body %q, got: %q", testCase.form, expected, recorder.Body.String())
+		}
+	}
+
+	count, err := db.Events(analytics.Filter{}, "", "", analytics.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(count) != 0 {
+		t.Errorf("expected no events to be saved, got: %+v", count)
+	}
+}
+
+func TestEvent_RequestNotToTrack(t *testing.T) {
+	for header, value := range map[string]string{
+		dnt.DoNotTrackHeaderName: dnt.DoNotTrackHeaderValue,
+		secgpc.SecGPCHeaderName:  secgpc.SecGPCHeaderValue,
+	} {
+		request := newEventRequest(t, url.Values{"host": {"example.org"}, "path": {"/"}, "name": {"signup"}})
+		request.Header.Set(header, value)
+
+		recorder := httptest.NewRecorder()
+		handler := NewHandler([]string{"example.org"}, "")
+		handler.ServeHTTP(recorder, request)
+
+		assertStatusCode(t, recorder, http.StatusNoContent)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	withTestDB(t, nil)
+	for _, event := range []*database.Event{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/", Name: "signup", CreatedAt: "2024-01-01 09:00:00", Properties: map[string]string{"plan": "pro"}},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/", Name: "signup", CreatedAt: "2024-01-01 09:00:00", Properties: map[string]string{"plan": "pro"}},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/", Name: "signup", CreatedAt: "2024-01-01 09:00:00", Properties: map[string]string{"plan": "free"}},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/", Name: "signup", CreatedAt: "2024-02-01 09:00:00", Properties: map[string]string{"plan": "free"}},
+	} {
+		if err := db.SaveEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	request, err := http.NewRequest("GET", "/events?host=example.org&name=signup&property=plan&from=2024-01-01&to=2024-01-31", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "")
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusOK)
+
+	var body map[string][]analytics.EventEntry
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []analytics.EventEntry{
+		{Name: "signup", Value: "pro", Count: 2, Visitors: 2},
+		{Name: "signup", Value: "free", Count: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(body["entries"], expected) {
+		t.Errorf("expected entries %+v, got: %+v", expected, body["entries"])
+	}
+}
@@ -0,0 +1,62 @@
+// Package geoip looks up the country of an IP in a local MaxMind-format
+// (.mmdb) database, like GeoLite2 Country, without calling out to any
+// service.
+package geoip
+
+import (
+	"net"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// DB is an open country database.
+type DB struct {
+	reader *maxminddb.Reader
+}
+
+// Open opens the .mmdb file at path.
+func Open(path string) (*DB, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{reader: reader}, nil
+}
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country of ip, like
+// "GB", or an empty string if it isn't known. ip may include a port. A nil DB
+// knows no countries.
+func (db *DB) Country(ip string) string {
+	if db == nil {
+		return ""
+	}
+	parsed := parseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	var record countryRecord
+	if err := db.reader.Lookup(parsed, &record); err != nil {
+		return ""
+	}
+	return record.Country.ISOCode
+}
+
+// Close closes the database file.
+func (db *DB) Close() error {
+	return db.reader.Close()
+}
+
+func parseIP(ip string) net.IP {
+	ip = strings.TrimSpace(ip)
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return net.ParseIP(ip)
+}
@@ -0,0 +1,41 @@
+package geoip
+
+import "testing"
+
+// testdata/country-test.mmdb was written with github.com/maxmind/mmdbwriter
+// and maps 81.2.69.0/24 to GB, 89.160.20.0/24 to SE, 1.128.0.0/16 to AU and
+// 2001:218::/32 to JP.
+func TestCountry(t *testing.T) {
+	db, err := Open("testdata/country-test.mmdb")
+	if err != nil {
+		t.Fatalf("unable to open fixture: %v", err)
+	}
+	defer db.Close()
+
+	for ip, expected := range map[string]string{
+		"81.2.69.142":       "GB",
+		"81.2.69.142:54321": "GB",
+		"[2001:218::1]:443": "JP",
+		"1.128.0.1":         "AU",
+		"127.0.0.1":         "",
+		"not an ip":         "",
+		"":                  "",
+	} {
+		if actual := db.Country(ip); actual != expected {
+			t.Errorf("expected Country(%q) to be %q, got %q", ip, expected, actual)
+		}
+	}
+}
+
+func TestCountry_NilDB(t *testing.T) {
+	var db *DB
+	if country := db.Country("81.2.69.142"); country != "" {
+		t.Errorf("expected a nil DB to know no countries, got %q", country)
+	}
+}
+
+func TestOpen_MissingFile(t *testing.T) {
+	if _, err := Open("testdata/missing.mmdb"); err == nil {
+		t.Error("expected an error opening a missing file")
+	}
+}
@@ -0,0 +1,93 @@
+package ping
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/parkr/ping/cors"
+	"github.com/parkr/ping/database"
+	"github.com/parkr/ping/store"
+)
+
+func withTestDB(t *testing.T, visits []*database.Visit) {
+	t.Helper()
+	previous := db
+	var err error
+	db, err = store.InitializeForTest()
+	if err != nil {
+		t.Fatalf("unexpected error initializing database: %+v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		db = previous
+	})
+
+	for _, visit := range visits {
+		if err := db.SaveVisit(visit); err != nil {
+			t.Fatalf("unable to save visit %s: %v", visit, err)
+		}
+	}
+}
+
+// newTestHandler opens a test database holding visits, like withTestDB, and
+// returns a handler allowing hosts.
+func newTestHandler(t *testing.T, hosts []string, visits []*database.Visit, options ...Option) http.Handler {
+	t.Helper()
+	withTestDB(t, visits)
+	return NewHandler(hosts, "", options...)
+}
+
+// serve records the response of handler to request.
+func serve(handler http.Handler, request *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func assertStatusCode(t *testing.T, recorder *httptest.ResponseRecorder, expectedCode int) {
+	if recorder.Code != expectedCode {
+		t.Errorf("handler expected status code %d, got %v",
+			expectedCode, recorder.Code)
+	}
+}
+
+func verifyCorsHeaders(t *testing.T, recorder *httptest.ResponseRecorder, origin string) {
+	actual := recorder.Header().Get(cors.CorsAccessControlAllowOriginHeaderName)
+	if actual != origin {
+		t.Errorf("expected %s: %v, got: %v", cors.CorsAccessControlAllowOriginHeaderName, origin, actual)
+	}
+
+	expectedAllowedMethods := "GET, POST"
+	actual = recorder.Header().Get(cors.CorsAccessControlAllowMethodsHeaderName)
+	if actual != expectedAllowedMethods {
+		t.Errorf("expected %s: %v, got: %v", cors.CorsAccessControlAllowMethodsHeaderName, expectedAllowedMethods, actual)
+	}
+}
+
+// newSubmitRequest posts form to /submit.js, like the v2 script on a page of
+// example.org.
+func newSubmitRequest(t *testing.T, form url.Values) *http.Request {
+	t.Helper()
+	request, err := http.NewRequest("POST", "/submit.js", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("User-Agent", "go test client")
+	request.Header.Set("Referer", "https://example.org/")
+	return request
+}
+
+func newEngageRequest(t *testing.T, query url.Values) *http.Request {
+	t.Helper()
+	request, err := http.NewRequest("POST", "/engage?"+query.Encode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("User-Agent", "go test client")
+	request.Header.Set("Referer", "https://example.org/")
+	return request
+}
@@ -0,0 +1,161 @@
+// Package hll estimates how many distinct values a set holds with a
+// HyperLogLog sketch, which is a few kilobytes at most however many values
+// are added, and can be merged with other sketches to estimate the size of
+// their union. Estimates are typically within 2% of the true count, and
+// exact for a handful of values.
+package hll
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	// precision is the number of bits of a value's hash which pick its
+	// register. Changing it, or the hash, makes stored sketches unreadable.
+	precision = 12
+	registers = 1 << precision
+	maxRank   = 64 - precision + 1
+
+	// A sketch is encoded as one of these, followed by its registers: either
+	// every register, or the index and value of the registers which aren't
+	// zero, whichever is shorter.
+	encodingDense  = 1
+	encodingSparse = 2
+)
+
+// ErrInvalidEncoding is returned when unmarshaling data which isn't an
+// encoded Sketch.
+var ErrInvalidEncoding = errors.New("hll: invalid sketch encoding")
+
+// Sketch estimates the number of distinct values added to it. The zero value
+// is an empty sketch.
+type Sketch struct {
+	registers []uint8
+}
+
+// Add adds value to the sketch.
+func (s *Sketch) Add(value string) {
+	if s.registers == nil {
+		s.registers = make([]uint8, registers)
+	}
+	hash := hash64(value)
+	index := hash >> (64 - precision)
+	// The register keeps the longest run of leading zeros seen in the rest of
+	// the hash, plus one. The low bit set stops the run at maxRank.
+	rank := uint8(bits.LeadingZeros64(hash<<precision|1<<(precision-1))) + 1
+	if rank > s.registers[index] {
+		s.registers[index] = rank
+	}
+}
+
+// Merge adds every value added to other to the sketch.
+func (s *Sketch) Merge(other *Sketch) {
+	if other == nil || other.registers == nil {
+		return
+	}
+	if s.registers == nil {
+		s.registers = make([]uint8, registers)
+	}
+	for i, rank := range other.registers {
+		if rank > s.registers[i] {
+			s.registers[i] = rank
+		}
+	}
+}
+
+// Count estimates the number of distinct values added to the sketch.
+func (s *Sketch) Count() int {
+	if s == nil || s.registers == nil {
+		return 0
+	}
+	sum, zeros := 0.0, 0
+	for _, rank := range s.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	m := float64(registers)
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// Small sets leave most registers empty, and are counted more accurately
+	// by how many are.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(estimate))
+}
+
+// MarshalBinary encodes the sketch to be stored.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	nonZero := 0
+	for _, rank := range s.registers {
+		if rank > 0 {
+			nonZero++
+		}
+	}
+	if s.registers != nil && 3*nonZero >= registers {
+		return append([]byte{encodingDense}, s.registers...), nil
+	}
+
+	data := make([]byte, 1, 1+3*nonZero)
+	data[0] = encodingSparse
+	for i, rank := range s.registers {
+		if rank > 0 {
+			data = append(data, byte(i>>8), byte(i), rank)
+		}
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a sketch encoded by MarshalBinary.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return ErrInvalidEncoding
+	}
+	decoded := make([]uint8, registers)
+	switch data[0] {
+	case encodingDense:
+		if len(data) != 1+registers {
+			return ErrInvalidEncoding
+		}
+		copy(decoded, data[1:])
+	case encodingSparse:
+		if (len(data)-1)%3 != 0 {
+			return ErrInvalidEncoding
+		}
+		for i := 1; i < len(data); i += 3 {
+			index := int(data[i])<<8 | int(data[i+1])
+			if index >= registers {
+				return ErrInvalidEncoding
+			}
+			decoded[index] = data[i+2]
+		}
+	default:
+		return ErrInvalidEncoding
+	}
+	for _, rank := range decoded {
+		if rank > maxRank {
+			return ErrInvalidEncoding
+		}
+	}
+	s.registers = decoded
+	return nil
+}
+
+// hash64 hashes value with FNV-1a, finished with MurmurHash3's mixer, since
+// FNV spreads its last bytes poorly and similar values, like IPs, are
+// common.
+func hash64(value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb3fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,96 @@
+package hll
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func sketchOf(values ...string) *Sketch {
+	s := &Sketch{}
+	for _, value := range values {
+		s.Add(value)
+	}
+	return s
+}
+
+func TestSketch_Count(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 10, 100, 1000, 10000, 100000} {
+		s := &Sketch{}
+		for i := 0; i < n; i++ {
+			value := fmt.Sprintf("203.0.%d.%d", i/256, i%256)
+			s.Add(value)
+			s.Add(value)
+		}
+		count := s.Count()
+		if n <= 10 && count != n {
+			t.Errorf("expected %d values to be counted exactly, got %d", n, count)
+		}
+		if diff := math.Abs(float64(count-n)) / float64(n); n > 10 && diff > 0.05 {
+			t.Errorf("expected about %d values, got %d (%.1f%% off)", n, count, 100*diff)
+		}
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	merged := sketchOf("a", "b", "c")
+	merged.Merge(sketchOf("b", "c", "d"))
+	merged.Merge(&Sketch{})
+	merged.Merge(nil)
+	if count := merged.Count(); count != 4 {
+		t.Errorf("expected the union of the sketches to have 4 values, got %d", count)
+	}
+
+	empty := &Sketch{}
+	empty.Merge(sketchOf("a"))
+	if count := empty.Count(); count != 1 {
+		t.Errorf("expected merging into an empty sketch to copy it, got %d values", count)
+	}
+}
+
+func TestSketch_MarshalBinary(t *testing.T) {
+	large := &Sketch{}
+	for i := 0; i < 10000; i++ {
+		large.Add(fmt.Sprint(i))
+	}
+	for _, testCase := range []struct {
+		name     string
+		sketch   *Sketch
+		encoding byte
+		size     int
+	}{
+		{"empty", &Sketch{}, encodingSparse, 1},
+		{"small", sketchOf("a", "b", "c"), encodingSparse, 10},
+		{"large", large, encodingDense, 1 + registers},
+	} {
+		data, err := testCase.sketch.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data[0] != testCase.encoding || len(data) != testCase.size {
+			t.Errorf("%s: expected encoding %d in %d bytes, got %d in %d", testCase.name, testCase.encoding, testCase.size, data[0], len(data))
+		}
+		decoded := &Sketch{}
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %v", testCase.name, err)
+		}
+		if decoded.Count() != testCase.sketch.Count() {
+			t.Errorf("%s: expected %d values once decoded, got %d", testCase.name, testCase.sketch.Count(), decoded.Count())
+		}
+	}
+}
+
+func TestSketch_UnmarshalBinary_Invalid(t *testing.T) {
+	for _, data := range [][]byte{
+		nil,
+		{0},
+		{encodingDense, 1, 2},
+		{encodingSparse, 0, 1},
+		{encodingSparse, 0xff, 0xff, 1},
+		{encodingSparse, 0, 1, maxRank + 1},
+	} {
+		if err := (&Sketch{}).UnmarshalBinary(data); err != ErrInvalidEncoding {
+			t.Errorf("expected %v to be invalid, got: %v", data, err)
+		}
+	}
+}
@@ -6,22 +6,18 @@ import (
 	"net/url"
 
 	"github.com/parkr/ping/jsv1"
+	"github.com/parkr/ping/sites"
 )
 
-func NewHostAuthMiddleware(allowedHosts []string, nextHandler http.Handler) http.Handler {
-	allowedHostsMap := make(map[string]bool, len(allowedHosts))
-	for _, allowedHost := range allowedHosts {
-		allowedHostsMap[allowedHost] = true
-	}
-
+func NewHostAuthMiddleware(allowedHosts *sites.Registry, nextHandler http.Handler) http.Handler {
 	return hostAuthMiddleware{
-		allowedHosts: allowedHostsMap,
+		allowedHosts: allowedHosts,
 		next:         nextHandler,
 	}
 }
 
 type hostAuthMiddleware struct {
-	allowedHosts map[string]bool
+	allowedHosts *sites.Registry
 	next         http.Handler
 }
 
@@ -50,7 +46,6 @@ func (m hostAuthMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	m.next.ServeHTTP(w, r)
 }
 
-func (m hostAuthMiddleware) allowedHost(hostname string) bool {
-	_, ok := m.allowedHosts[hostname]
-	return ok
+func (m hostAuthMiddleware) allowedHost(host string) bool {
+	return m.allowedHosts.Allowed(host)
 }
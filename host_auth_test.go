@@ -0,0 +1,45 @@
+package ping
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/parkr/ping/sites"
+)
+
+func TestHostAuthMiddleware_Patterns(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := NewHostAuthMiddleware(sites.NewRegistry([]string{"example.org", "*.preview.example.com", "localhost:4000"}), next)
+
+	testCases := []struct {
+		referrer     string
+		expectedCode int
+	}{
+		{"https://example.org/post", http.StatusNoContent},
+		{"https://EXAMPLE.org./post", http.StatusNoContent},
+		{"http://example.org:8080/post", http.StatusNoContent},
+		{"https://www.example.org/post", http.StatusUnauthorized},
+		{"https://example.org.evil.com/post", http.StatusUnauthorized},
+		{"https://pr-1.preview.example.com/post", http.StatusNoContent},
+		{"https://preview.example.com/post", http.StatusUnauthorized},
+		{"http://localhost:4000/post", http.StatusNoContent},
+		{"http://localhost/post", http.StatusUnauthorized},
+	}
+	for _, testCase := range testCases {
+		request, err := http.NewRequest("GET", "/ping", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Referer", testCase.referrer)
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != testCase.expectedCode {
+			t.Errorf("referrer %q: expected status code %d, got: %d", testCase.referrer, testCase.expectedCode, recorder.Code)
+		}
+	}
+}
@@ -4,42 +4,179 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"text/template"
 )
 
 const returnedJavaScript = `
-function logVisit(document) {
+function sendToPing(url, searchParams, description) {
 	var httpRequest = new XMLHttpRequest();
 	httpRequest.onreadystatechange = () => {
 		if (httpRequest.readyState === XMLHttpRequest.DONE) {
 			if (httpRequest.status > 100 && httpRequest.status < 300) {
-				console.log("visit log result:", httpRequest.responseText)
+				console.log(description + " result:", httpRequest.responseText)
 			} else {
 				console.error('There was a problem with the request.')
 				console.error(httpRequest.status, httpRequest.responseText, httpRequest)
 			}
 		}
 	};
+	url.search = "?" + searchParams.toString()
+	httpRequest.open('POST', url.toString(), true);
+	httpRequest.send();
+}
+function newPageviewID() {
+	if (window.crypto && crypto.randomUUID) {
+		return crypto.randomUUID()
+	}
+	return Date.now().toString(36) + '-' + Math.random().toString(36).slice(2)
+}
+function logVisit(document, siteID, pageviewID, referrer) {
 	const visitSearchParams = new URLSearchParams()
+	if (siteID) {
+		visitSearchParams.append('site', siteID)
+	}
 	visitSearchParams.append('host', document.location.hostname)
 	visitSearchParams.append('path', document.location.pathname)
-	const visitURL = new URL('https://ping.parkermoo.re/submit.js')
-	visitURL.search = "?" + visitSearchParams.toString()
-	httpRequest.open('POST', visitURL.toString(), true);
-	httpRequest.send();
+	visitSearchParams.append('referrer', referrer)
+	visitSearchParams.append('pageview', pageviewID)
+	const pageSearchParams = new URLSearchParams(document.location.search)
+	for (const utmParam of ['utm_source', 'utm_medium', 'utm_campaign', 'utm_term', 'utm_content']) {
+		if (pageSearchParams.has(utmParam)) {
+			visitSearchParams.append(utmParam, pageSearchParams.get(utmParam))
+		}
+	}
+	sendToPing(new URL('%[1]s/submit.js'), visitSearchParams, 'visit log')
+}
+/**
+ * Record a custom event, like a signup or a download, on the current page.
+ * props is an optional object of up to 10 string properties, e.g.
+ * ping.track('signup', {plan: 'pro'}).
+ */
+function trackEvent(document, siteID, name, props) {
+	const eventSearchParams = new URLSearchParams()
+	if (siteID) {
+		eventSearchParams.append('site', siteID)
+	}
+	eventSearchParams.append('host', document.location.hostname)
+	eventSearchParams.append('path', document.location.pathname)
+	eventSearchParams.append('name', name)
+	eventSearchParams.append('props', JSON.stringify(props || {}))
+	sendToPing(new URL('%[1]s/event'), eventSearchParams, 'event log')
+}
+/**
+ * Count the time the page is visible for, and report the running total with
+ * a beacon whenever the page is hidden, which may be the last chance to.
+ * Calling the returned function reports the page view one last time and
+ * starts counting for the next one, with the given ID.
+ */
+function trackEngagement(document, siteID, pageviewID) {
+	let engagedMillis = 0
+	let visibleSince = document.visibilityState === 'visible' ? Date.now() : null
+	let reportedSeconds = 0
+	const report = () => {
+		if (visibleSince !== null) {
+			engagedMillis += Date.now() - visibleSince
+			visibleSince = null
+		}
+		const seconds = Math.round(engagedMillis / 1000)
+		if (seconds < 1 || seconds === reportedSeconds || !navigator.sendBeacon) {
+			return
+		}
+		reportedSeconds = seconds
+		const url = new URL('%[1]s/engage')
+		const engageSearchParams = new URLSearchParams({id: pageviewID, seconds: seconds})
+		if (siteID) {
+			engageSearchParams.append('site', siteID)
+		}
+		url.search = '?' + engageSearchParams.toString()
+		navigator.sendBeacon(url.toString())
+	}
+	document.addEventListener('visibilitychange', () => {
+		if (document.visibilityState === 'visible') {
+			visibleSince = Date.now()
+		} else {
+			report()
+		}
+	});
+	window.addEventListener('pagehide', report);
+	return (nextPageviewID) => {
+		report()
+		pageviewID = nextPageviewID
+		engagedMillis = 0
+		reportedSeconds = 0
+		visibleSince = document.visibilityState === 'visible' ? Date.now() : null
+	}
+}
+/**
+ * Call onNavigate with the previous URL whenever a single-page application
+ * changes its route with history.pushState or history.replaceState, or the
+ * visitor goes back or forward. Changes which keep the same path, like
+ * updating the query string or hash, are ignored.
+ */
+function trackNavigation(window, onNavigate) {
+	let lastURL = window.location.href
+	let lastPath = window.location.pathname
+	const navigated = () => {
+		const previousURL = lastURL
+		lastURL = window.location.href
+		if (window.location.pathname === lastPath) {
+			return
+		}
+		lastPath = window.location.pathname
+		onNavigate(previousURL)
+	}
+	for (const method of ['pushState', 'replaceState']) {
+		const original = window.history[method]
+		window.history[method] = function() {
+			const result = original.apply(this, arguments)
+			navigated()
+			return result
+		}
+	}
+	window.addEventListener('popstate', navigated);
 }
 (function(){
+	const script = document.currentScript
+	// The site ID given by <script data-site="..."> lets ping check that
+	// visits, events and engaged time are logged from the site's own hosts.
+	const siteID = script ? script.dataset.site : undefined
+	const pageviewID = newPageviewID()
+	window.ping = window.ping || {};
+	window.ping.track = (name, props) => trackEvent(document, siteID, name, props);
+	const nextPageview = trackEngagement(document, siteID, pageviewID)
 	document.addEventListener('readystatechange', (event) => {
 		if (document.readyState === 'complete') {
-			logVisit(document)
+			logVisit(document, siteID, pageviewID, document.referrer)
 		}
 	});
+	// Sites which aren't single-page applications, or which log their own
+	// route changes, can opt out with <script data-spa="off">.
+	if (!script || script.dataset.spa !== 'off') {
+		trackNavigation(window, (previousURL) => {
+			const nextPageviewID = newPageviewID()
+			nextPageview(nextPageviewID)
+			logVisit(document, siteID, nextPageviewID, previousURL)
+		})
+	}
 })()
 `
 
-func Write(w http.ResponseWriter, code int) {
+// Write responds with the v2 tracking script, which submits visits to the
+// ping server at pingBaseURL.
+func Write(w http.ResponseWriter, code int, pingBaseURL string) {
+	content := Render(pingBaseURL)
 	w.Header().Set("Content-Type", "application/javascript")
-	w.Header().Set("Content-Length", strconv.Itoa(len(returnedJavaScript)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
 	// Note: All w.Header() modifications must be made BEFORE this call.
 	w.WriteHeader(code)
-	fmt.Fprintf(w, returnedJavaScript)
+	fmt.Fprint(w, content)
+}
+
+// Render returns the v2 tracking script for the given ping base URL. The base
+// URL is escaped so it cannot break out of the JavaScript string it is
+// embedded in.
+func Render(pingBaseURL string) string {
+	baseURL := strings.TrimSuffix(pingBaseURL, "/")
+	return fmt.Sprintf(returnedJavaScript, template.JSEscapeString(baseURL))
 }
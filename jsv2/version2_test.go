@@ -0,0 +1,91 @@
+package jsv2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWrite_UsesPingBaseURL(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	Write(recorder, http.StatusOK, "https://ping.example.com")
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	body := recorder.Body.String()
+	for _, expected := range []string{
+		"new URL('https://ping.example.com/submit.js')",
+		"new URL('https://ping.example.com/event')",
+		"new URL('https://ping.example.com/engage')",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected body to contain %q, got: %s", expected, body)
+		}
+	}
+
+	if strings.Contains(body, "parkermoo.re") {
+		t.Errorf("expected body not to contain the hardcoded domain, got: %s", body)
+	}
+
+	expectedLength := strconv.Itoa(len(body))
+	if actual := recorder.Header().Get("Content-Length"); actual != expectedLength {
+		t.Errorf("expected Content-Length %s, got %s", expectedLength, actual)
+	}
+}
+
+func TestRender_TracksNavigation(t *testing.T) {
+	script := Render("https://ping.example.com")
+
+	for _, expected := range []string{
+		"'pushState', 'replaceState'",
+		"window.addEventListener('popstate', navigated)",
+		"script.dataset.spa !== 'off'",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected script to contain %q, got: %s", expected, script)
+		}
+	}
+}
+
+func TestRender_TrimsTrailingSlash(t *testing.T) {
+	script := Render("https://ping.example.com/")
+
+	expected := "new URL('https://ping.example.com/submit.js')"
+	if !strings.Contains(script, expected) {
+		t.Errorf("expected script to contain %q, got: %s", expected, script)
+	}
+}
+
+func TestRender_EscapesPingBaseURL(t *testing.T) {
+	script := Render(`https://ping.example.com/');alert(1);('</script>`)
+
+	for _, unexpected := range []string{"');alert(1);('", "</script>"} {
+		if strings.Contains(script, unexpected) {
+			t.Errorf("expected script not to contain %q, got: %s", unexpected, script)
+		}
+	}
+
+	expected := `new URL('https://ping.example.com/\');alert(1);(\'\u003C/script\u003E/submit.js')`
+	if !strings.Contains(script, expected) {
+		t.Errorf("expected script to contain %q, got: %s", expected, script)
+	}
+}
+
+func TestRender_SendsSiteID(t *testing.T) {
+	script := Render("https://ping.example.com")
+
+	for _, expected := range []string{
+		"script ? script.dataset.site : undefined",
+		"visitSearchParams.append('site', siteID)",
+		"eventSearchParams.append('site', siteID)",
+		"engageSearchParams.append('site', siteID)",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected script to contain %q, got: %s", expected, script)
+		}
+	}
+}
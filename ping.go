@@ -1,33 +1,52 @@
 package ping
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/jmoiron/sqlx"
 	"github.com/parkr/ping/analytics"
+	"github.com/parkr/ping/batch"
+	"github.com/parkr/ping/bots"
+	"github.com/parkr/ping/clientip"
 	"github.com/parkr/ping/cors"
 	"github.com/parkr/ping/database"
 	"github.com/parkr/ping/dnt"
+	"github.com/parkr/ping/geoip"
 	"github.com/parkr/ping/jsv1"
 	"github.com/parkr/ping/jsv2"
+	"github.com/parkr/ping/reports"
 	"github.com/parkr/ping/secgpc"
+	"github.com/parkr/ping/sites"
+	"github.com/parkr/ping/store"
+	"github.com/parkr/ping/useragent"
 )
 
-const xForwardedForHeaderName = "X-Forwarded-For"
-
-var db *sqlx.DB
+var db store.Store
 
+// Initialize opens the storage backend described by connection. See
+// store.Open for the supported connection strings.
 func Initialize(connection string) error {
 	var err error
-	db, err = database.Initialize(connection)
+	db, err = store.Open(connection)
 	return err
 }
 
+// Close closes the storage backend opened by Initialize.
+func Close() error {
+	if db == nil {
+		return nil
+	}
+	return db.Close()
+}
+
 func parseReferer(referer string) (*url.URL, error) {
 	if referer == "" {
 		return nil, errors.New("referer is empty")
@@ -36,21 +55,41 @@ func parseReferer(referer string) (*url.URL, error) {
 	return url.Parse(referer)
 }
 
-// ping routes to pingv1 or pingv2 depending on the version code in the form.
-func ping(w http.ResponseWriter, r *http.Request) {
+type pingHandler struct {
+	pingBaseURL string
+	options     handlerOptions
+	// requireSiteID refuses visits to hosts which belong to a site unless the
+	// site param names it, like refererSiteMiddleware. Submissions forwarded
+	// by submitv2 have been checked by siteAuthMiddleware already.
+	requireSiteID bool
+}
+
+// ServeHTTP routes to pingv1 or pingv2 depending on the version code in the
+// form.
+func (p pingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	version := r.FormValue("v")
 	switch version {
 	case "2":
-		pingv2(w, r)
+		pingv2(w, p.pingBaseURL)
 	default:
-		pingv1(w, r)
+		var record http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pingv1(w, r, p.options)
+		})
+		if p.requireSiteID {
+			record = refererSiteMiddleware{record}
+		}
+		record.ServeHTTP(w, r)
 	}
 }
 
 // pingv1 implements the referer-based logging.
-// When a request comes in, the referer and remote IP (or X-Forwarded-For)
-// are used to write the ping entry.
-func pingv1(w http.ResponseWriter, r *http.Request) {
+// When a request comes in, the referer and client IP (see
+// clientip.Resolver) are used to write the ping entry. The page's own
+// referrer, if known, is given in the referrer param, and the ID the ?v=2
+// script gave the page view in the pageview param. Only the UTM params of the
+// referer's query string are kept. Depending on the options, the IP is looked
+// up in a GeoIP database and only a salted hash of it is stored.
+func pingv1(w http.ResponseWriter, r *http.Request, options handlerOptions) {
 	parsedReferer, err := parseReferer(r.Referer())
 	if err != nil {
 		log.Printf("referer invalid (%q): %v", sanitizeUserInput(r.Referer()), err)
@@ -58,14 +97,6 @@ func pingv1(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var ip string
-	if res := r.Header.Get(xForwardedForHeaderName); res != "" {
-		log.Println("Fetching IP from proxy:", sanitizeUserInput(res))
-		ip = res
-	} else {
-		ip = r.RemoteAddr
-	}
-
 	userAgent := r.Header.Get("User-Agent")
 	if userAgent == "" {
 		log.Println("empty user-agent")
@@ -73,16 +104,57 @@ func pingv1(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	pageviewID := r.FormValue("pageview")
+	if pageviewID != "" && !validPageviewID(pageviewID) {
+		jsv1.Error(w, http.StatusBadRequest, "invalid pageview id")
+		return
+	}
+
+	now := time.Now().UTC()
+	host := sanitizeUserInput(parsedReferer.Host)
+	userAgent = sanitizeUserInput(userAgent)
+	ip := options.proxies.ClientIP(r)
+	country := options.countries.Country(ip)
+	ip, visitorID, err := options.visitors.identify(host, ip, userAgent, now)
+	if err != nil {
+		log.Println("Error identifying visitor:", err)
+		jsv1.Error(w, http.StatusInternalServerError, "unable to identify visitor")
+		return
+	}
+
+	parsedUserAgent := useragent.Parse(userAgent)
 	visit := &database.Visit{
-		IP:        sanitizeUserInput(ip),
-		Host:      sanitizeUserInput(parsedReferer.Host),
-		Path:      sanitizeUserInput(parsedReferer.Path),
-		UserAgent: sanitizeUserInput(userAgent),
-		CreatedAt: time.Now().UTC().Format(database.SQLDateTimeFormat),
+		IP:             ip,
+		VisitorID:      visitorID,
+		PageviewID:     pageviewID,
+		Host:           host,
+		Path:           sanitizeUserInput(parsedReferer.Path),
+		UserAgent:      userAgent,
+		Browser:        parsedUserAgent.Browser,
+		BrowserVersion: parsedUserAgent.BrowserVersion,
+		OS:             parsedUserAgent.OS,
+		Device:         parsedUserAgent.Device,
+		Country:        country,
+		IsBot:          bots.IsBot(userAgent),
+		Referrer:       sanitizeUserInput(externalReferrer(r.FormValue("referrer"), parsedReferer.Host)),
+		CreatedAt:      now.Format(database.SQLDateTimeFormat),
+		Campaign:       campaignFromQuery(parsedReferer.Query()),
 	}
 	log.Println("Logging visit:", sanitizeUserInput(visit.String()))
 
-	err = visit.Save(db)
+	if options.writer != nil {
+		ctx, cancel := context.WithTimeout(r.Context(), maxEnqueueWait)
+		defer cancel()
+		if err := options.writer.Enqueue(ctx, visit); err != nil {
+			log.Println("Error queueing visit:", err)
+			jsv1.Error(w, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		jsv1.Write(w, http.StatusAccepted)
+		return
+	}
+
+	err = db.SaveVisit(visit)
 
 	if err != nil {
 		log.Println("Error saving to db:", err)
@@ -94,18 +166,19 @@ func pingv1(w http.ResponseWriter, r *http.Request) {
 }
 
 // pingv2 implements the js-based logging.
-// When a request comes in, it returns JS that will call /submit.js to capture
-// the full path of the page visited.
-func pingv2(w http.ResponseWriter, _ *http.Request) {
-	jsv2.Write(w, http.StatusOK)
+// When a request comes in, it returns JS that will call /submit.js on the ping
+// server at pingBaseURL to capture the full path of the page visited.
+func pingv2(w http.ResponseWriter, pingBaseURL string) {
+	jsv2.Write(w, http.StatusOK, pingBaseURL)
 }
 
 type submitv2Handler struct {
 	nextHandler http.Handler
+	proxies     *clientip.Resolver
 }
 
-// submitv2 takes an XHR request with the host & path in the form and rewrites
-// as a pingv1 request using the referer.
+// submitv2 takes an XHR request with the host, path, referrer, pageview & UTM
+// params in the form and rewrites as a pingv1 request using the referer.
 func (s submitv2Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	host := r.FormValue("host")
 	path := r.FormValue("path")
@@ -113,60 +186,98 @@ func (s submitv2Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		jsv1.Error(w, http.StatusBadRequest, "missing param")
 		return
 	}
-	referer := url.URL{Host: host, Path: path}
+	referer := url.URL{Host: host, Path: path, RawQuery: utmQuery(r.Form).Encode()}
+
+	target := "/ping.js"
+	query := url.Values{}
+	for _, param := range []string{"referrer", "pageview"} {
+		if value := r.FormValue(param); value != "" {
+			query.Set(param, value)
+		}
+	}
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
 
-	req, err := http.NewRequest(http.MethodGet, "/ping.js", nil)
+	req, err := http.NewRequest(http.MethodGet, target, nil)
 	if err != nil {
 		jsv1.Error(w, http.StatusInternalServerError, "unable to rewrite")
 		return
 	}
 	req.Header.Set("Referer", referer.String())
 	req.Header.Set("User-Agent", r.Header.Get("User-Agent"))
-
-	remoteAddr := r.Header.Get(xForwardedForHeaderName)
-	if remoteAddr == "" {
-		remoteAddr = r.RemoteAddr
-	}
-	req.Header.Set(xForwardedForHeaderName, remoteAddr)
+	req.RemoteAddr = s.proxies.ClientIP(r)
 
 	log.Printf("forwarding v2 to v1")
 
 	s.nextHandler.ServeHTTP(w, req)
 }
 
+// counts responds with the views and visitors of a host & path. The counts can
+// be limited to a time range with the from and to params, and broken down into
+// a series of periods with the interval param.
 func counts(w http.ResponseWriter, r *http.Request) {
-	host := r.FormValue("host")
-	path := r.FormValue("path")
-
-	var err error
-	var views, visitors int
-	if host == "" || path == "" {
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.Host == "" || filter.Path == "" {
 		jsonError(w, http.StatusBadRequest, "missing param")
-	} else {
-		views, err = analytics.ViewsForHostPath(db, host, path)
-		if err != nil {
-			jsonError(w, http.StatusInternalServerError, err.Error())
-			return
-		}
+		return
+	}
 
-		visitors, err = analytics.VisitorsForHostPath(db, host, path)
+	var interval analytics.Interval
+	if name := r.FormValue("interval"); name != "" {
+		interval, err = analytics.ParseInterval(name)
 		if err != nil {
-			jsonError(w, http.StatusInternalServerError, err.Error())
+			jsonError(w, http.StatusBadRequest, err.Error())
 			return
 		}
+	}
 
+	views, err := db.Views(filter)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	visitors, err := db.Visitors(filter)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if interval == "" {
 		writeJsonResponse(w, map[string]int{
 			"views":    views,
 			"visitors": visitors,
 		})
+		return
+	}
+
+	series, err := db.Series(filter, interval)
+	if errors.Is(err, analytics.ErrInvalidRange) {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
+
+	writeJsonResponse(w, map[string]interface{}{
+		"views":    views,
+		"visitors": visitors,
+		"series":   series,
+	})
 }
 
 func all(w http.ResponseWriter, r *http.Request) {
 	thing := r.FormValue("type")
 
 	if thing == "path" || thing == "host" {
-		entries, err := analytics.ListDistinctColumn(db, thing)
+		entries, err := db.ListDistinctColumn(thing)
 
 		if err != nil {
 			jsonError(w, http.StatusInternalServerError, err.Error())
@@ -180,6 +291,221 @@ func all(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// top responds with the most viewed paths (type=path, the default) or hosts
+// (type=host), or the pages sessions most often started (type=entry) or ended
+// (type=exit) on, within the optional host, from and to params, sorted and
+// paginated by the sort, limit and offset params.
+func top(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := pageFromRequest(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var entries []analytics.Entry
+	switch thing := r.FormValue("type"); thing {
+	case "", "path":
+		entries, err = db.TopPaths(filter, page)
+	case "host":
+		entries, err = db.TopHosts(filter, page)
+	case "entry":
+		entries, err = db.TopEntryPages(filter, page)
+	case "exit":
+		entries, err = db.TopExitPages(filter, page)
+	default:
+		jsonError(w, http.StatusBadRequest, "unknown type "+strconv.Quote(thing))
+		return
+	}
+	if errors.Is(err, analytics.ErrInvalidPage) {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJsonResponse(w, map[string][]analytics.Entry{"entries": entries})
+}
+
+// referrers responds with the traffic sources of the visits within the
+// optional host, path, from and to params, sorted and paginated by the sort,
+// limit and offset params. With group=category, sources are grouped into
+// search, social, website and direct traffic.
+func referrers(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := pageFromRequest(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var byCategory bool
+	switch group := r.FormValue("group"); group {
+	case "", "source":
+	case "category":
+		byCategory = true
+	default:
+		jsonError(w, http.StatusBadRequest, "unknown group "+strconv.Quote(group))
+		return
+	}
+
+	entries, err := db.Referrers(filter, page, byCategory)
+	if errors.Is(err, analytics.ErrInvalidPage) {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJsonResponse(w, map[string][]analytics.ReferrerEntry{"entries": entries})
+}
+
+// campaigns responds with the views and visitors from each UTM campaign,
+// source & medium within the optional host, path, from and to params, sorted
+// and paginated by the sort, limit and offset params.
+func campaigns(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := pageFromRequest(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := db.Campaigns(filter, page)
+	if errors.Is(err, analytics.ErrInvalidPage) {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJsonResponse(w, map[string][]analytics.CampaignEntry{"entries": entries})
+}
+
+// engagement responds with the average and median seconds spent on each path
+// within the optional host, path, from and to params, sorted and paginated by
+// the sort, limit and offset params.
+func engagement(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := pageFromRequest(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := db.Engagement(filter, page)
+	if errors.Is(err, analytics.ErrInvalidPage) {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJsonResponse(w, map[string][]analytics.EngagementEntry{"entries": entries})
+}
+
+// sessions responds with the number of sessions within the optional host,
+// path, from and to params, along with their bounce rate, average duration
+// and pages per session. The path param matches the page sessions started
+// on.
+func sessions(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	stats, err := db.Sessions(filter)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJsonResponse(w, stats)
+}
+
+// breakdown responds with the views and visitors of each browser, OS or
+// device, as given by the dimension param.
+func breakdown(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := pageFromRequest(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	dimension, err := analytics.ParseDimension(r.FormValue("dimension"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := db.Breakdown(filter, dimension, page)
+	if errors.Is(err, analytics.ErrInvalidPage) {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJsonResponse(w, map[string][]analytics.BreakdownEntry{"entries": entries})
+}
+
+// events responds with the number of times each custom event was triggered
+// within the optional host, path, from and to params, most frequent first and
+// paginated by the limit and offset params. With the name param, only that
+// event is counted. With the property param, events are counted per value of
+// that property.
+func events(w http.ResponseWriter, r *http.Request) {
+	filter, err := filterFromRequest(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := pageFromRequest(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entries, err := db.Events(filter, r.FormValue("name"), r.FormValue("property"), page)
+	if err != nil {
+		jsonError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJsonResponse(w, map[string][]analytics.EventEntry{"entries": entries})
+}
+
 type statsHandler struct {
 	pingBaseURL string
 }
@@ -202,24 +528,171 @@ func health(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, "healthy")
 }
 
-func NewHandler(allowedHosts []string, pingBaseURL string) *http.ServeMux {
+// Option configures the handler returned by NewHandler.
+type Option func(*handlerOptions)
+
+type handlerOptions struct {
+	visitors  *visitorHasher
+	countries *geoip.DB
+	proxies   *clientip.Resolver
+	writer    *batch.Writer
+	sites     *sites.Registry
+	dropBots  bool
+	// publicReports are the reports which don't need an API token, or nil if
+	// API tokens aren't required at all.
+	publicReports map[string]bool
+}
+
+// WithHashedVisitors stores a hash of each visitor's IP, host and user agent,
+// salted with a salt which is replaced daily, instead of their IP. Unique
+// visitors are then counted per day: a visitor who returns on another day is
+// counted again.
+func WithHashedVisitors() Option {
+	return func(o *handlerOptions) {
+		o.visitors = &visitorHasher{}
+	}
+}
+
+// WithGeoIP looks up the country of each visitor's IP in countries and
+// stores it with the visit.
+func WithGeoIP(countries *geoip.DB) Option {
+	return func(o *handlerOptions) {
+		o.countries = countries
+	}
+}
+
+// WithTrustedProxies trusts the proxies in the given networks to report the
+// IP of the client they forwarded a request for. Without it, the forwarding
+// headers are ignored and the IP the request came from is recorded.
+func WithTrustedProxies(networks []netip.Prefix) Option {
+	return func(o *handlerOptions) {
+		o.proxies = clientip.NewResolver(networks)
+	}
+}
+
+// WithBatchedWrites queues visits on writer, to be saved in batches, instead
+// of saving each one before responding. Requests are answered with 202
+// Accepted, or 503 Service Unavailable if the queue stays full. The writer's
+// stats are served on /_metrics, which needs a token for all sites with
+// WithAPITokens, and is public without it.
+func WithBatchedWrites(writer *batch.Writer) Option {
+	return func(o *handlerOptions) {
+		o.writer = writer
+	}
+}
+
+// WithDroppedBots drops visits and events from bots instead of recording them
+// flagged as bots.
+func WithDroppedBots() Option {
+	return func(o *handlerOptions) {
+		o.dropBots = true
+	}
+}
+
+// WithSites reads the allowlist from registry, which may be changed while the
+// server is running, instead of the hosts given to NewHandler.
+func WithSites(registry *sites.Registry) Option {
+	return func(o *handlerOptions) {
+		o.sites = registry
+	}
+}
+
+// WithAPITokens requires an API token which can read the site being reported
+// on for every report but those at the public paths, which are some of
+// reports.Paths.
+func WithAPITokens(public ...string) Option {
+	return func(o *handlerOptions) {
+		o.publicReports = make(map[string]bool, len(public))
+		for _, path := range public {
+			o.publicReports[path] = true
+		}
+	}
+}
+
+func NewHandler(allowedHosts []string, pingBaseURL string, options ...Option) *http.ServeMux {
+	opts := handlerOptions{}
+	for _, option := range options {
+		option(&opts)
+	}
+	allowlist := opts.sites
+	if allowlist == nil {
+		allowlist = sites.NewRegistry(allowedHosts)
+	}
+
+	var recordVisit http.Handler = pingHandler{pingBaseURL: pingBaseURL, options: opts, requireSiteID: true}
+	var recordSubmission http.Handler = pingHandler{pingBaseURL: pingBaseURL, options: opts}
+	var recordEvent http.Handler = eventRecorder{opts}
+	if opts.dropBots {
+		recordVisit = bots.NewMiddleware(recordVisit)
+		recordSubmission = bots.NewMiddleware(recordSubmission)
+		recordEvent = bots.NewMiddleware(recordEvent)
+	}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/_health", health)
+	if opts.writer != nil {
+		var metrics http.Handler = metricsHandler{opts.writer}
+		if opts.publicReports != nil {
+			metrics = tokenAuthMiddleware{next: metrics, allSites: true}
+		}
+		mux.Handle("/_metrics", metrics)
+	}
 	pingHandler := secgpc.NewMiddleware(
 		dnt.NewMiddleware(
-			NewHostAuthMiddleware(allowedHosts,
-				http.HandlerFunc(ping))))
+			NewHostAuthMiddleware(allowlist,
+				recordVisit)))
 	mux.Handle("/ping", pingHandler)
 	mux.Handle("/ping.js", pingHandler)
-	submitHandler := cors.NewMiddleware(allowedHosts,
+	submitv2 := submitv2Handler{
 		secgpc.NewMiddleware(
 			dnt.NewMiddleware(
-				NewHostAuthMiddleware(allowedHosts,
-					submitv2Handler{pingHandler}))))
+				NewHostAuthMiddleware(allowlist,
+					recordSubmission))),
+		opts.proxies,
+	}
+	submitHandler := cors.NewMiddleware(allowlist,
+		secgpc.NewMiddleware(
+			dnt.NewMiddleware(
+				siteAuthMiddleware{
+					signed:   submitv2,
+					unsigned: NewHostAuthMiddleware(allowlist, submitv2),
+				})))
 	mux.Handle("/submit", submitHandler)
 	mux.Handle("/submit.js", submitHandler)
-	mux.Handle("/counts", cors.NewMiddleware(allowedHosts, http.HandlerFunc(counts)))
-	mux.Handle("/all", cors.NewMiddleware(allowedHosts, http.HandlerFunc(all)))
-	mux.Handle("/stats.js", cors.NewMiddleware(allowedHosts, statsHandler{pingBaseURL}))
+	eventHandler := cors.NewMiddleware(allowlist,
+		secgpc.NewMiddleware(
+			dnt.NewMiddleware(
+				eventv2Handler{NewHostAuthMiddleware(allowlist, refererSiteMiddleware{recordEvent})})))
+	mux.Handle("/event", eventHandler)
+	mux.Handle("/engage", cors.NewMiddleware(allowlist,
+		secgpc.NewMiddleware(
+			dnt.NewMiddleware(
+				NewHostAuthMiddleware(allowlist,
+					refererSiteMiddleware{engageHandler{opts.writer}})))))
+	reportHandlers := map[string]http.Handler{
+		"/counts":     http.HandlerFunc(counts),
+		"/all":        http.HandlerFunc(all),
+		"/top":        http.HandlerFunc(top),
+		"/referrers":  http.HandlerFunc(referrers),
+		"/campaigns":  http.HandlerFunc(campaigns),
+		"/engagement": http.HandlerFunc(engagement),
+		"/sessions":   http.HandlerFunc(sessions),
+		"/breakdown":  http.HandlerFunc(breakdown),
+		"/events":     http.HandlerFunc(events),
+		"/stats.js":   statsHandler{pingBaseURL},
+	}
+	dashboardPages := dashboardHandler{
+		secureCookies: strings.HasPrefix(pingBaseURL, "https://"),
+		sites:         allowlist,
+	}
+	mux.Handle("/dashboard", dashboardPages)
+	mux.Handle("/dashboard/", dashboardPages)
+	for _, path := range reports.Paths {
+		report := reportHandlers[path]
+		if opts.publicReports != nil && !opts.publicReports[path] {
+			report = tokenAuthMiddleware{next: report, allSites: path == "/all"}
+		}
+		mux.Handle(path, cors.NewMiddleware(allowlist, report))
+	}
 	return mux
 }
@@ -4,14 +4,16 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/parkr/ping/analytics"
-	"github.com/parkr/ping/cors"
 	"github.com/parkr/ping/database"
 	"github.com/parkr/ping/dnt"
+	"github.com/parkr/ping/geoip"
 	"github.com/parkr/ping/secgpc"
+	"github.com/parkr/ping/store"
 )
 
 func TestPingEmptyReferrer(t *testing.T) {
@@ -57,6 +59,7 @@ func TestPingUnauthorizedHost(t *testing.T) {
 }
 
 func TestPingEmptyUserAgent(t *testing.T) {
+	withTestDB(t, nil)
 	request, err := http.NewRequest("GET", "/ping", nil)
 	if err != nil {
 		t.Fatal(err)
@@ -126,12 +129,12 @@ func TestPingRequestGlobalPrivacyControl(t *testing.T) {
 // likely return true because `checkIfSchemaExists` query doesn't include DB
 func TestPingSuccess(t *testing.T) {
 	var err error
-	db, err = database.InitializeForTest()
+	db, err = store.InitializeForTest()
 	if err != nil {
 		t.Fatalf("unexpected error initializing database: %+v", err)
 	}
 
-	visitCountStart, _ := analytics.ViewsForHostPath(db, "example.org", "/root")
+	visitCountStart, _ := db.ViewsForHostPath("example.org", "/root")
 
 	request, err := http.NewRequest("GET", "/ping", nil)
 	if err != nil {
@@ -154,7 +157,7 @@ func TestPingSuccess(t *testing.T) {
 			recorder.Body.String(), expected)
 	}
 
-	visitCountEnd, _ := analytics.ViewsForHostPath(db, "example.org", "/root")
+	visitCountEnd, _ := db.ViewsForHostPath("example.org", "/root")
 
 	if visitCountEnd <= visitCountStart {
 		t.Errorf("visit was not saved, got %v want %v",
@@ -162,6 +165,38 @@ func TestPingSuccess(t *testing.T) {
 	}
 }
 
+func TestPingSuccess_KeepsOnlyUTMParams(t *testing.T) {
+	withTestDB(t, nil)
+
+	request, err := http.NewRequest("GET", "/ping", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request.Header.Set("Referer", "http://example.org/root?utm_source=newsletter&utm_medium=email&utm_campaign=launch&utm_term=ping&utm_content=footer&email=someone@example.com")
+	request.Header.Set("User-Agent", "go test client")
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "")
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusCreated)
+
+	visit, err := database.Get(db.DB(), 1)
+	if err != nil {
+		t.Fatalf("expected no error getting visit from db, got: %v", err)
+	}
+
+	if visit.Path != "/root" {
+		t.Errorf("expected visit path /root, got: %q", visit.Path)
+	}
+
+	expected := database.Campaign{Source: "newsletter", Medium: "email", Name: "launch", Term: "ping", Content: "footer"}
+	if visit.Campaign != expected {
+		t.Errorf("expected visit campaign %+v, got: %+v", expected, visit.Campaign)
+	}
+}
+
 func TestCountsOptionsPreflight(t *testing.T) {
 	request, err := http.NewRequest(http.MethodOptions, "/counts", nil)
 	if err != nil {
@@ -257,6 +292,100 @@ func TestCountsValid(t *testing.T) {
 
 }
 
+func TestCountsTimeRange(t *testing.T) {
+	withTestDB(t, []*database.Visit{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/post", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00"},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/post", UserAgent: "go test client", CreatedAt: "2024-01-02 09:00:00"},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/post", UserAgent: "go test client", CreatedAt: "2024-01-05 09:00:00"},
+	})
+
+	request, err := http.NewRequest("GET", "/counts?host=example.org&path=/post&from=2024-01-02&to=2024-01-05", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "")
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusOK)
+
+	var body map[string]int
+	json.NewDecoder(recorder.Body).Decode(&body)
+
+	if body["views"] != 2 {
+		t.Errorf("expected 2 views, got: %v", body)
+	}
+	if body["visitors"] != 1 {
+		t.Errorf("expected 1 visitor, got: %v", body)
+	}
+}
+
+func TestCountsSeries(t *testing.T) {
+	withTestDB(t, []*database.Visit{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/post", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00"},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/post", UserAgent: "go test client", CreatedAt: "2024-01-01 10:00:00"},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/post", UserAgent: "go test client", CreatedAt: "2024-01-03 09:00:00"},
+	})
+
+	request, err := http.NewRequest("GET", "/counts?host=example.org&path=/post&from=2024-01-01&to=2024-01-03&interval=day", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "")
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusOK)
+
+	var body struct {
+		Views    int                `json:"views"`
+		Visitors int                `json:"visitors"`
+		Series   []analytics.Bucket `json:"series"`
+	}
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body.Views != 3 || body.Visitors != 2 {
+		t.Errorf("expected 3 views and 2 visitors, got: %+v", body)
+	}
+
+	expected := []analytics.Bucket{
+		{Period: "2024-01-01 00:00:00", Views: 2, Visitors: 2},
+		{Period: "2024-01-02 00:00:00", Views: 0, Visitors: 0},
+		{Period: "2024-01-03 00:00:00", Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(body.Series, expected) {
+		t.Errorf("expected series %+v, got: %+v", expected, body.Series)
+	}
+}
+
+func TestCountsInvalidParams(t *testing.T) {
+	for _, query := range []string{
+		"host=example.org&path=/post&interval=fortnight",
+		"host=example.org&path=/post&from=yesterday",
+		"host=example.org&path=/post&to=tomorrow",
+		"host=example.org&path=/post&from=2024-01-05&to=2024-01-01",
+		"host=example.org&path=/post&from=2000-01-01&to=2024-01-01&interval=hour",
+		"host=example.org&path=/post&bots=sometimes",
+	} {
+		request, err := http.NewRequest("GET", "/counts?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler := NewHandler([]string{"example.org"}, "")
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d: %s", query, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
 func TestAllOptionsPreflight(t *testing.T) {
 	request, err := http.NewRequest(http.MethodOptions, "/all", nil)
 	if err != nil {
@@ -335,6 +464,308 @@ func TestAllPath(t *testing.T) {
 	}
 }
 
+func TestTopPaths(t *testing.T) {
+	withTestDB(t, []*database.Visit{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/popular", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00"},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/popular", UserAgent: "go test client", CreatedAt: "2024-01-01 10:00:00"},
+		{IP: "127.0.0.1", Host: "example.org", Path: "/unpopular", UserAgent: "go test client", CreatedAt: "2024-01-01 11:00:00"},
+		{IP: "127.0.0.1", Host: "example.com", Path: "/elsewhere", UserAgent: "go test client", CreatedAt: "2024-01-01 11:00:00"},
+	})
+
+	request, err := http.NewRequest("GET", "/top?host=example.org&from=2024-01-01&to=2024-01-01", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Add("Origin", "https://example.org")
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "")
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusOK)
+	verifyCorsHeaders(t, recorder, "https://example.org")
+
+	var body map[string][]analytics.Entry
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []analytics.Entry{
+		{Host: "example.org", Path: "/popular", Views: 2, Visitors: 2},
+		{Host: "example.org", Path: "/unpopular", Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(body["entries"], expected) {
+		t.Errorf("expected entries %+v, got: %+v", expected, body["entries"])
+	}
+}
+
+func TestTopHosts(t *testing.T) {
+	withTestDB(t, []*database.Visit{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/popular", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00"},
+		{IP: "127.0.0.1", Host: "example.com", Path: "/elsewhere", UserAgent: "go test client", CreatedAt: "2024-01-01 11:00:00"},
+		{IP: "127.0.0.1", Host: "example.com", Path: "/elsewhere", UserAgent: "go test client", CreatedAt: "2024-01-01 12:00:00"},
+	})
+
+	request, err := http.NewRequest("GET", "/top?type=host&limit=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "")
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusOK)
+
+	var body map[string][]analytics.Entry
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []analytics.Entry{{Host: "example.com", Views: 2, Visitors: 1}}
+	if !reflect.DeepEqual(body["entries"], expected) {
+		t.Errorf("expected entries %+v, got: %+v", expected, body["entries"])
+	}
+}
+
+func TestTopInvalidParams(t *testing.T) {
+	for _, query := range []string{
+		"type=referrer-ish",
+		"sort=id",
+		"limit=0",
+		"limit=ten",
+		"offset=-1",
+		"from=yesterday",
+	} {
+		request, err := http.NewRequest("GET", "/top?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler := NewHandler([]string{"example.org"}, "")
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d: %s", query, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestReferrers(t *testing.T) {
+	withTestDB(t, []*database.Visit{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/post", UserAgent: "go test client", Referrer: "https://www.google.com/", CreatedAt: "2024-01-01 09:00:00"},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/post", UserAgent: "go test client", Referrer: "https://www.bing.com/", CreatedAt: "2024-01-01 09:00:00"},
+		{IP: "127.0.0.3", Host: "example.org", Path: "/post", UserAgent: "go test client", Referrer: "https://t.co/abc", CreatedAt: "2024-01-01 09:00:00"},
+		{IP: "127.0.0.3", Host: "example.org", Path: "/other", UserAgent: "go test client", Referrer: "https://t.co/abc", CreatedAt: "2024-01-01 09:00:00"},
+	})
+
+	request, err := http.NewRequest("GET", "/referrers?host=example.org&path=/post&group=category", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "")
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusOK)
+
+	var body map[string][]analytics.ReferrerEntry
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []analytics.ReferrerEntry{
+		{Category: analytics.CategorySearch, Views: 2, Visitors: 2},
+		{Category: analytics.CategorySocial, Views: 1, Visitors: 1},
+	}
+	if !reflect.DeepEqual(body["entries"], expected) {
+		t.Errorf("expected entries %+v, got: %+v", expected, body["entries"])
+	}
+}
+
+func TestReferrersInvalidParams(t *testing.T) {
+	for _, query := range []string{"group=domain", "sort=referrer", "limit=-1"} {
+		request, err := http.NewRequest("GET", "/referrers?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler := NewHandler([]string{"example.org"}, "")
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d: %s", query, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
+func TestCampaigns(t *testing.T) {
+	withTestDB(t, []*database.Visit{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/post", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00",
+			Campaign: database.Campaign{Name: "launch", Source: "newsletter", Medium: "email"}},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/post", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00",
+			Campaign: database.Campaign{Name: "launch", Source: "newsletter", Medium: "email", Content: "footer"}},
+		{IP: "127.0.0.3", Host: "example.org", Path: "/post", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00"},
+	})
+
+	request, err := http.NewRequest("GET", "/campaigns?host=example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "")
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusOK)
+
+	var body map[string][]analytics.CampaignEntry
+	if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []analytics.CampaignEntry{
+		{Campaign: "launch", Source: "newsletter", Medium: "email", Views: 2, Visitors: 2},
+	}
+	if !reflect.DeepEqual(body["entries"], expected) {
+		t.Errorf("expected entries %+v, got: %+v", expected, body["entries"])
+	}
+}
+
+func TestSessions(t *testing.T) {
+	withTestDB(t, []*database.Visit{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/root", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00"},
+		{IP: "127.0.0.1", Host: "example.org", Path: "/foo", UserAgent: "go test client", CreatedAt: "2024-01-01 09:01:00"},
+		{IP: "127.0.0.1", Host: "example.org", Path: "/bar", UserAgent: "go test client", CreatedAt: "2024-01-01 09:04:00"},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/foo", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00"},
+		{IP: "127.0.0.1", Host: "example.org", Path: "/root", UserAgent: "go test client", CreatedAt: "2024-01-01 12:00:00"},
+	})
+
+	request, err := http.NewRequest("GET", "/sessions?host=example.org&from=2024-01-01&to=2024-01-01", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Add("Origin", "https://example.org")
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "")
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusOK)
+	verifyCorsHeaders(t, recorder, "https://example.org")
+
+	var stats analytics.SessionStats
+	if err := json.NewDecoder(recorder.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	expected := analytics.SessionStats{Sessions: 3, BounceRate: 2.0 / 3, AverageDuration: 80, PageviewsPerSession: 5.0 / 3}
+	if stats != expected {
+		t.Errorf("expected sessions %+v, got: %+v", expected, stats)
+	}
+
+	for thing, expected := range map[string][]analytics.Entry{
+		"entry": {{Host: "example.org", Path: "/root", Views: 2, Visitors: 1}, {Host: "example.org", Path: "/foo", Views: 1, Visitors: 1}},
+		"exit":  {{Host: "example.org", Path: "/bar", Views: 1, Visitors: 1}, {Host: "example.org", Path: "/foo", Views: 1, Visitors: 1}, {Host: "example.org", Path: "/root", Views: 1, Visitors: 1}},
+	} {
+		request, err := http.NewRequest("GET", "/top?host=example.org&type="+thing, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		assertStatusCode(t, recorder, http.StatusOK)
+
+		var body map[string][]analytics.Entry
+		if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(body["entries"], expected) {
+			t.Errorf("%s: expected entries %+v, got: %+v", thing, expected, body["entries"])
+		}
+	}
+}
+
+func TestBreakdown(t *testing.T) {
+	withTestDB(t, nil)
+
+	for _, userAgent := range []string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Mobile Safari/537.36",
+	} {
+		request, err := http.NewRequest("GET", "/ping", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Referer", "http://example.org/root")
+		request.Header.Set("User-Agent", userAgent)
+
+		recorder := httptest.NewRecorder()
+		handler := NewHandler([]string{"example.org"}, "")
+		handler.ServeHTTP(recorder, request)
+
+		assertStatusCode(t, recorder, http.StatusCreated)
+	}
+
+	visit, err := database.Get(db.DB(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visit.Browser != "Chrome" || visit.BrowserVersion != "120" || visit.OS != "Windows" || visit.Device != "desktop" {
+		t.Errorf("expected the user agent to be parsed, got: %+v", visit)
+	}
+
+	for dimension, expected := range map[string][]analytics.BreakdownEntry{
+		"browser": {{Value: "Chrome", Views: 2, Visitors: 1}, {Value: "Safari", Views: 1, Visitors: 1}},
+		"device":  {{Value: "mobile", Views: 2, Visitors: 1}, {Value: "desktop", Views: 1, Visitors: 1}},
+	} {
+		request, err := http.NewRequest("GET", "/breakdown?host=example.org&path=/root&dimension="+dimension, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler := NewHandler([]string{"example.org"}, "")
+		handler.ServeHTTP(recorder, request)
+
+		assertStatusCode(t, recorder, http.StatusOK)
+
+		var body map[string][]analytics.BreakdownEntry
+		if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(body["entries"], expected) {
+			t.Errorf("%s: expected entries %+v, got: %+v", dimension, expected, body["entries"])
+		}
+	}
+}
+
+func TestBreakdownInvalidParams(t *testing.T) {
+	for _, query := range []string{
+		"host=example.org",
+		"host=example.org&dimension=user_agent",
+		"host=example.org&dimension=browser&sort=name",
+	} {
+		request, err := http.NewRequest("GET", "/breakdown?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler := NewHandler([]string{"example.org"}, "")
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d: %s", query, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+		}
+	}
+}
+
 func TestStats_Success(t *testing.T) {
 	pingBaseURL := "http://ping.mywebsite.com"
 
@@ -382,7 +813,7 @@ func TestHealth_NoDB(t *testing.T) {
 
 func TestHealth_DB(t *testing.T) {
 	var err error
-	db, err = database.InitializeForTest()
+	db, err = store.InitializeForTest()
 	if err != nil {
 		t.Errorf("unable to initialize database: %v", err)
 	}
@@ -399,22 +830,168 @@ func TestHealth_DB(t *testing.T) {
 	assertStatusCode(t, recorder, http.StatusOK)
 }
 
-func assertStatusCode(t *testing.T, recorder *httptest.ResponseRecorder, expectedCode int) {
-	if recorder.Code != expectedCode {
-		t.Errorf("handler expected status code %d, got %v",
-			expectedCode, recorder.Code)
+// withTestDB swaps in a fresh database containing visits for the duration of
+// the test, then restores the previous one.
+func TestPingSuccess_HashedVisitors(t *testing.T) {
+	withTestDB(t, nil)
+	handler := NewHandler([]string{"example.org"}, "", WithHashedVisitors())
+
+	for _, userAgent := range []string{"go test client", "go test client", "another client"} {
+		request, err := http.NewRequest("GET", "/ping", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Referer", "http://example.org/root")
+		request.Header.Set("User-Agent", userAgent)
+		request.RemoteAddr = "100.0.0.0"
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		assertStatusCode(t, recorder, http.StatusCreated)
+	}
+
+	first, err := database.Get(db.DB(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.IP != "" {
+		t.Errorf("expected no ip to be stored, got: %q", first.IP)
+	}
+	if len(first.VisitorID) != 32 || strings.Contains(first.VisitorID, "100.0.0.0") {
+		t.Errorf("expected a hashed visitor id, got: %q", first.VisitorID)
+	}
+
+	second, err := database.Get(db.DB(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.VisitorID != first.VisitorID {
+		t.Errorf("expected the same visitor id for the same visitor, got %q and %q", first.VisitorID, second.VisitorID)
+	}
+
+	visitors, err := db.VisitorsForHostPath("example.org", "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visitors != 2 {
+		t.Errorf("expected 2 visitors, got: %d", visitors)
+	}
+}
+
+func TestPingSuccess_GeoIP(t *testing.T) {
+	withTestDB(t, nil)
+
+	countries, err := geoip.Open("geoip/testdata/country-test.mmdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer countries.Close()
+
+	request, err := http.NewRequest("GET", "/ping", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Referer", "http://example.org/root")
+	request.Header.Set("User-Agent", "go test client")
+	request.RemoteAddr = "81.2.69.142"
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "", WithGeoIP(countries), WithHashedVisitors())
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusCreated)
+
+	visit, err := database.Get(db.DB(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visit.Country != "GB" {
+		t.Errorf("expected the visit to come from GB, got: %q", visit.Country)
+	}
+	if visit.IP != "" {
+		t.Errorf("expected no ip to be stored, got: %q", visit.IP)
+	}
+
+	entries, err := db.Breakdown(analytics.Filter{}, analytics.DimensionCountry, analytics.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []analytics.BreakdownEntry{{Value: "GB", Views: 1, Visitors: 1}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("expected entries %+v, got: %+v", expected, entries)
+	}
+}
+
+func TestPingSuccess_FlagsBots(t *testing.T) {
+	withTestDB(t, nil)
+
+	request, err := http.NewRequest("GET", "/ping", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Referer", "http://example.org/root")
+	request.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)")
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "")
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusCreated)
+
+	visit, err := database.Get(db.DB(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !visit.IsBot {
+		t.Errorf("expected visit to be flagged as a bot, got: %s", &visit)
+	}
+
+	for query, expected := range map[string]int{
+		"":              0,
+		"&bots=only":    1,
+		"&bots=include": 1,
+	} {
+		request, err := http.NewRequest("GET", "/counts?host=example.org&path=/root"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		assertStatusCode(t, recorder, http.StatusOK)
+
+		var body map[string]int
+		json.NewDecoder(recorder.Body).Decode(&body)
+
+		if body["views"] != expected {
+			t.Errorf("%q: expected %d views, got: %v", query, expected, body)
+		}
 	}
 }
 
-func verifyCorsHeaders(t *testing.T, recorder *httptest.ResponseRecorder, origin string) {
-	actual := recorder.Header().Get(cors.CorsAccessControlAllowOriginHeaderName)
-	if actual != origin {
-		t.Errorf("expected %s: %v, got: %v", cors.CorsAccessControlAllowOriginHeaderName, origin, actual)
+func TestPingSuccess_DropsBots(t *testing.T) {
+	withTestDB(t, nil)
+
+	request, err := http.NewRequest("GET", "/ping", nil)
+	if err != nil {
+		t.Fatal(err)
 	}
+	request.Header.Set("Referer", "http://example.org/root")
+	request.Header.Set("User-Agent", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)")
 
-	expectedAllowedMethods := "GET, POST"
-	actual = recorder.Header().Get(cors.CorsAccessControlAllowMethodsHeaderName)
-	if actual != expectedAllowedMethods {
-		t.Errorf("expected %s: %v, got: %v", cors.CorsAccessControlAllowMethodsHeaderName, expectedAllowedMethods, actual)
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "", WithDroppedBots())
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusNoContent)
+
+	views, err := db.Views(analytics.Filter{Bots: analytics.BotsIncluded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if views != 0 {
+		t.Errorf("expected the bot's visit to be dropped, got %d views", views)
 	}
 }
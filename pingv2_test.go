@@ -3,13 +3,15 @@ package ping
 import (
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 
-	"github.com/parkr/ping/analytics"
+	"github.com/parkr/ping/clientip"
 	"github.com/parkr/ping/database"
 	"github.com/parkr/ping/dnt"
 	"github.com/parkr/ping/secgpc"
+	"github.com/parkr/ping/store"
 )
 
 func TestPingV2_EmptyReferrer(t *testing.T) {
@@ -115,12 +117,12 @@ func TestPingV2_RequestGlobalSecurityControl(t *testing.T) {
 // likely return true because `checkIfSchemaExists` query doesn't include DB
 func TestPingV2_Success(t *testing.T) {
 	var err error
-	db, err = database.InitializeForTest()
+	db, err = store.InitializeForTest()
 	if err != nil {
 		t.Fatalf("unexpected error initializing database: %+v", err)
 	}
 
-	visitCountStart, _ := analytics.ViewsForHostPath(db, "example.org", "/root")
+	visitCountStart, _ := db.ViewsForHostPath("example.org", "/root")
 
 	request, err := http.NewRequest("GET", "/ping?v=2", nil)
 	if err != nil {
@@ -142,7 +144,7 @@ func TestPingV2_Success(t *testing.T) {
 			expected, recorder.Body.String())
 	}
 
-	visitCountEnd, _ := analytics.ViewsForHostPath(db, "example.org", "/root")
+	visitCountEnd, _ := db.ViewsForHostPath("example.org", "/root")
 
 	if visitCountEnd != visitCountStart {
 		t.Errorf("visit was saved but shouldn't have been, got %v want %v",
@@ -150,6 +152,30 @@ func TestPingV2_Success(t *testing.T) {
 	}
 }
 
+func TestPingV2_SubmitsToPingBaseURL(t *testing.T) {
+	pingBaseURL := "https://ping.mywebsite.com"
+
+	request, err := http.NewRequest("GET", "/ping.js?v=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request.Header.Set("Referer", "http://example.org/root")
+	request.Header.Set("User-Agent", "go test client")
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, pingBaseURL)
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusOK)
+
+	expected := "new URL('https://ping.mywebsite.com/submit.js')"
+	if !strings.Contains(recorder.Body.String(), expected) {
+		t.Errorf("pingv2 body does not contain expected string %q, got: %v",
+			expected, recorder.Body.String())
+	}
+}
+
 func TestSubmitV2_MissingHost(t *testing.T) {
 	request, err := http.NewRequest("POST", "/submit.js", strings.NewReader("host=&path=/root"))
 	if err != nil {
@@ -285,12 +311,12 @@ func TestSubmitV2_MissingUserAgent(t *testing.T) {
 
 func TestSubmitV2_Success(t *testing.T) {
 	var err error
-	db, err = database.InitializeForTest()
+	db, err = store.InitializeForTest()
 	if err != nil {
 		t.Fatalf("unexpected error initializing database: %+v", err)
 	}
 
-	visitCountStart, _ := analytics.ViewsForHostPath(db, "example.org", "/TestSubmitV2_Success")
+	visitCountStart, _ := db.ViewsForHostPath("example.org", "/TestSubmitV2_Success")
 
 	request, err := http.NewRequest("POST", "/submit.js", strings.NewReader("host=example.org&path=/TestSubmitV2_Success"))
 	if err != nil {
@@ -318,14 +344,14 @@ func TestSubmitV2_Success(t *testing.T) {
 
 	verifyCorsHeaders(t, recorder, "https://example.org")
 
-	visitCountEnd, _ := analytics.ViewsForHostPath(db, "example.org", "/TestSubmitV2_Success")
+	visitCountEnd, _ := db.ViewsForHostPath("example.org", "/TestSubmitV2_Success")
 
 	if visitCountEnd != visitCountStart+1 {
 		t.Errorf("visit wasn't saved, got %v want %v",
 			visitCountEnd, visitCountStart+1)
 	}
 
-	visit, err := database.Get(db, 1)
+	visit, err := database.Get(db.DB(), 1)
 	if err != nil {
 		t.Errorf("expected no error getting visit from db, got: %v", err)
 	}
@@ -341,9 +367,9 @@ func TestSubmitV2_Success(t *testing.T) {
 	}
 }
 
-func TestSubmitV2_Success_PreservesXForwardedForOverRemoteAddr(t *testing.T) {
+func TestSubmitV2_Success_PrefersXForwardedForFromTrustedProxy(t *testing.T) {
 	var err error
-	db, err = database.InitializeForTest()
+	db, err = store.InitializeForTest()
 	if err != nil {
 		t.Fatalf("unexpected error initializing database: %+v", err)
 	}
@@ -355,11 +381,11 @@ func TestSubmitV2_Success_PreservesXForwardedForOverRemoteAddr(t *testing.T) {
 	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	request.Header.Set("User-Agent", "go test client")
 	request.Header.Set("Referer", "https://example.org/")
-	request.Header.Set(xForwardedForHeaderName, "100.0.12.0")
+	request.Header.Set(clientip.XForwardedForHeaderName, "100.0.12.0")
 	request.RemoteAddr = "127.0.0.1:12324"
 
 	recorder := httptest.NewRecorder()
-	handler := NewHandler([]string{"example.org"}, "")
+	handler := NewHandler([]string{"example.org"}, "", WithTrustedProxies(clientip.PrivateNetworks))
 	handler.ServeHTTP(recorder, request)
 
 	assertStatusCode(t, recorder, http.StatusCreated)
@@ -372,7 +398,7 @@ func TestSubmitV2_Success_PreservesXForwardedForOverRemoteAddr(t *testing.T) {
 
 	verifyCorsHeaders(t, recorder, "https://example.org")
 
-	visit, err := database.Get(db, 1)
+	visit, err := database.Get(db.DB(), 1)
 	if err != nil {
 		t.Errorf("expected no error getting visit from db, got: %v", err)
 	}
@@ -382,3 +408,117 @@ func TestSubmitV2_Success_PreservesXForwardedForOverRemoteAddr(t *testing.T) {
 		t.Errorf("expected visit ip %q, got: %v", expectedIP, visit.IP)
 	}
 }
+
+func TestSubmitV2_Success_IgnoresXForwardedForFromClient(t *testing.T) {
+	withTestDB(t, nil)
+
+	request, err := http.NewRequest("POST", "/submit.js", strings.NewReader("host=example.org&path=/TestSubmitV2_Success"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("User-Agent", "go test client")
+	request.Header.Set("Referer", "https://example.org/")
+	request.Header.Set(clientip.XForwardedForHeaderName, "100.0.12.0, 10.0.0.1")
+	request.RemoteAddr = "100.0.0.1:12324"
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "", WithTrustedProxies(clientip.PrivateNetworks))
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusCreated)
+
+	visit, err := database.Get(db.DB(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedIP := "100.0.0.1"
+	if visit.IP != expectedIP {
+		t.Errorf("expected visit ip %q, got: %v", expectedIP, visit.IP)
+	}
+}
+
+func TestSubmitV2_Success_SavesExternalReferrer(t *testing.T) {
+	for _, testCase := range []struct {
+		referrer string
+		expected string
+	}{
+		{"", ""},
+		{"https://www.google.com/search?q=secret", "https://www.google.com/search"},
+		{"https://example.org/previous-page", ""},
+		{"android-app://com.example", ""},
+	} {
+		var err error
+		db, err = store.InitializeForTest()
+		if err != nil {
+			t.Fatalf("unexpected error initializing database: %+v", err)
+		}
+
+		form := url.Values{"host": {"example.org"}, "path": {"/root"}, "referrer": {testCase.referrer}}
+		request, err := http.NewRequest("POST", "/submit.js", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("User-Agent", "go test client")
+		request.Header.Set("Referer", "https://example.org/root")
+
+		recorder := httptest.NewRecorder()
+		handler := NewHandler([]string{"example.org"}, "")
+		handler.ServeHTTP(recorder, request)
+
+		assertStatusCode(t, recorder, http.StatusCreated)
+
+		visit, err := database.Get(db.DB(), 1)
+		if err != nil {
+			t.Errorf("expected no error getting visit from db, got: %v", err)
+		}
+
+		if visit.Referrer != testCase.expected {
+			t.Errorf("referrer %q: expected visit referrer %q, got: %q", testCase.referrer, testCase.expected, visit.Referrer)
+		}
+	}
+}
+
+func TestSubmitV2_Success_SavesUTMParams(t *testing.T) {
+	var err error
+	db, err = store.InitializeForTest()
+	if err != nil {
+		t.Fatalf("unexpected error initializing database: %+v", err)
+	}
+
+	form := url.Values{
+		"host":         {"example.org"},
+		"path":         {"/root"},
+		"utm_source":   {"newsletter"},
+		"utm_campaign": {"launch"},
+		"email":        {"someone@example.com"},
+	}
+	request, err := http.NewRequest("POST", "/submit.js", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("User-Agent", "go test client")
+	request.Header.Set("Referer", "https://example.org/root")
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "")
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusCreated)
+
+	visit, err := database.Get(db.DB(), 1)
+	if err != nil {
+		t.Fatalf("expected no error getting visit from db, got: %v", err)
+	}
+
+	expected := database.Campaign{Source: "newsletter", Name: "launch"}
+	if visit.Campaign != expected {
+		t.Errorf("expected visit campaign %+v, got: %+v", expected, visit.Campaign)
+	}
+	if visit.Path != "/root" {
+		t.Errorf("expected visit path /root, got: %q", visit.Path)
+	}
+}
@@ -0,0 +1,33 @@
+package ping
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// externalReferrer cleans up the referrer of a visit to a page on host. Only
+// the scheme, host and path of http(s) referrers are kept, so query strings
+// with tokens or search terms are never stored. Referrers from host itself
+// are internal navigation rather than a traffic source, so are dropped.
+func externalReferrer(referrer, host string) string {
+	if referrer == "" {
+		return ""
+	}
+	parsed, err := url.Parse(referrer)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return ""
+	}
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if strings.EqualFold(parsed.Hostname(), hostname) {
+		return ""
+	}
+	cleaned := url.URL{Scheme: parsed.Scheme, Host: strings.ToLower(parsed.Host), Path: parsed.Path}
+	return cleaned.String()
+}
@@ -0,0 +1,18 @@
+// Package reports lists the reports served by ping, so the server and its
+// configuration agree on which paths are reports.
+package reports
+
+// Paths are the paths of the reports, which need an API token unless they're
+// made public.
+var Paths = []string{
+	"/counts",
+	"/all",
+	"/top",
+	"/referrers",
+	"/campaigns",
+	"/engagement",
+	"/sessions",
+	"/breakdown",
+	"/events",
+	"/stats.js",
+}
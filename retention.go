@@ -0,0 +1,90 @@
+package ping
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	// pruneBatchSize is the most visits deleted by a single statement.
+	pruneBatchSize = 1000
+	// pruneBatchPause is the time between batches, during which the database
+	// is free to record new visits.
+	pruneBatchPause = 100 * time.Millisecond
+)
+
+// PruneVisits rolls up and deletes the visits from before the last retention
+// period, in batches, and returns how many were deleted. The sessions which
+// ended before it are deleted afterwards. Only whole days are pruned.
+func PruneVisits(retention time.Duration) (int, error) {
+	return pruneVisits(retention, nil)
+}
+
+// pruneVisits is PruneVisits, stopping between batches once done is closed.
+func pruneVisits(retention time.Duration, done <-chan struct{}) (int, error) {
+	before := time.Now().UTC().Add(-retention)
+	total, err := pruneInBatches(done, func() (int, error) {
+		return db.PruneVisits(before, pruneBatchSize)
+	})
+	if err != nil {
+		return total, err
+	}
+	_, err = pruneInBatches(done, func() (int, error) {
+		return db.PruneSessions(before, pruneBatchSize)
+	})
+	return total, err
+}
+
+// pruneInBatches calls prune until it deletes nothing or done is closed,
+// pausing between batches, and returns the total deleted.
+func pruneInBatches(done <-chan struct{}, prune func() (int, error)) (int, error) {
+	total := 0
+	for {
+		select {
+		case <-done:
+			return total, nil
+		default:
+		}
+
+		deleted, err := prune()
+		total += deleted
+		if err != nil || deleted == 0 {
+			return total, err
+		}
+
+		select {
+		case <-done:
+			return total, nil
+		case <-time.After(pruneBatchPause):
+		}
+	}
+}
+
+// StartPruning runs PruneVisits in the background every interval, until stop
+// is called. stop waits for the batch in progress, if any, to finish.
+func StartPruning(retention, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if deleted, err := pruneVisits(retention, done); err != nil {
+				log.Printf("error pruning visits: %v", err)
+			} else if deleted > 0 {
+				log.Printf("pruned %d visits older than %s", deleted, retention)
+			}
+
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
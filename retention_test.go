@@ -0,0 +1,82 @@
+package ping
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/parkr/ping/database"
+)
+
+func TestPruneVisits(t *testing.T) {
+	recent := time.Now().UTC().Format(database.SQLDateTimeFormat)
+	withTestDB(t, []*database.Visit{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/post", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00"},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/post", UserAgent: "go test client", CreatedAt: "2024-01-01 10:00:00"},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/post", UserAgent: "go test client", CreatedAt: recent},
+	})
+
+	deleted, err := PruneVisits(30 * 24 * time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Errorf("expected 2 visits to be pruned, got: %d", deleted)
+	}
+
+	var sessions int
+	if err := db.DB().Get(&sessions, "SELECT COUNT(*) FROM sessions"); err != nil {
+		t.Fatal(err)
+	}
+	if sessions != 1 {
+		t.Errorf("expected only the recent session to remain, got: %d", sessions)
+	}
+
+	request, err := http.NewRequest("GET", "/counts?host=example.org&path=/post", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler := NewHandler([]string{"example.org"}, "")
+	handler.ServeHTTP(recorder, request)
+
+	assertStatusCode(t, recorder, http.StatusOK)
+
+	var body map[string]int
+	json.NewDecoder(recorder.Body).Decode(&body)
+
+	if body["views"] != 3 {
+		t.Errorf("expected 3 views after pruning, got: %v", body)
+	}
+	if body["visitors"] != 2 {
+		t.Errorf("expected 2 visitors after pruning, each counted once, got: %v", body)
+	}
+}
+
+func TestStartPruning(t *testing.T) {
+	withTestDB(t, []*database.Visit{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/post", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00"},
+	})
+
+	stop := StartPruning(30*24*time.Hour, time.Hour)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var remaining int
+		if err := db.DB().Get(&remaining, "SELECT COUNT(*) FROM visits"); err != nil {
+			t.Fatal(err)
+		}
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for visits to be pruned")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// stop returns once the pruning goroutine has finished, so the database
+	// can safely be closed afterwards.
+	stop()
+}
@@ -0,0 +1,262 @@
+package ping
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/parkr/ping/database"
+	"github.com/parkr/ping/jsv1"
+	"github.com/parkr/ping/sites"
+)
+
+const (
+	siteParam      = "site"
+	timestampParam = "timestamp"
+	signatureParam = "signature"
+	nonceParam     = "nonce"
+	ipParam        = "ip"
+
+	// maxSignatureAge is how far the timestamp of a signed submission may be
+	// from the server's clock, either way.
+	maxSignatureAge = 5 * time.Minute
+	// nonceLifetime is how long the nonce of a signed submission is kept.
+	// A submission can be accepted from maxSignatureAge before its timestamp
+	// until maxSignatureAge after it, so its nonce must be kept for both.
+	nonceLifetime = 2 * maxSignatureAge
+)
+
+// These are the reasons a submission from a site is rejected. Their messages
+// are sent to the client, so they never include its input.
+var (
+	errMissingSiteID      = errors.New("missing site")
+	errUnknownSite        = errors.New("unknown site")
+	errSiteHostMismatch   = errors.New("host does not belong to site")
+	errSiteHasNoSecret    = errors.New("site has no secret")
+	errMissingTimestamp   = errors.New("missing or invalid timestamp")
+	errExpiredTimestamp   = errors.New("timestamp too far from server time")
+	errInvalidSignature   = errors.New("invalid signature")
+	errMissingNonce       = errors.New("missing or invalid nonce")
+	errReplayedSubmission = errors.New("nonce already used")
+	errInvalidSubmitterIP = errors.New("invalid ip")
+)
+
+// SignSubmission returns the signature of a server-side submission to
+// /submit with the given params, which must include the site, host, path, a
+// Unix timestamp and a nonce, which is never reused. It is the hex-encoded
+// HMAC-SHA256, keyed with the site's secret, of the params without the
+// signature, form-encoded and sorted by key.
+func SignSubmission(secret string, params url.Values) string {
+	unsigned := url.Values{}
+	for key, values := range params {
+		if key != signatureParam {
+			unsigned[key] = values
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// siteAuthMiddleware authorizes submissions by their site or API token.
+// Submissions signed with the site's secret, or with a token which can write
+// to the host, come from the site's servers, and are passed to signed without
+// checking the Referer. Others come from the tracking script, and are passed
+// to unsigned once the site in the site param is known to own the host param,
+// which the visit is recorded for. The site param may only be left out for
+// hosts which don't belong to a site with a site ID.
+type siteAuthMiddleware struct {
+	signed   http.Handler
+	unsigned http.Handler
+}
+
+func (m siteAuthMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if token, ok := bearerToken(r); ok {
+		if err := authorizeTokenSubmission(r, token); err != nil {
+			log.Printf("rejected submission with API token: %v", err)
+			rejectSubmission(w, err)
+			return
+		}
+		m.signed.ServeHTTP(w, r)
+		return
+	}
+
+	siteID := r.FormValue(siteParam)
+	if r.FormValue(signatureParam) != "" {
+		if err := verifySignedSubmission(r, siteID, time.Now()); err != nil {
+			log.Printf("rejected signed submission for site %q: %v", sanitizeUserInput(siteID), err)
+			rejectSubmission(w, err)
+			return
+		}
+		m.signed.ServeHTTP(w, r)
+		return
+	}
+
+	if err := verifySiteID(siteID, r.FormValue("host")); err != nil {
+		log.Printf("rejected submission for site %q: %v", sanitizeUserInput(siteID), err)
+		rejectSubmission(w, err)
+		return
+	}
+	m.unsigned.ServeHTTP(w, r)
+}
+
+// refererSiteMiddleware does for requests from the tracking script which are
+// recorded for the host in the Referer, like /ping and /event, what
+// siteAuthMiddleware does for unsigned submissions: once the host belongs to
+// a site, the site param must name it.
+type refererSiteMiddleware struct {
+	next http.Handler
+}
+
+func (m refererSiteMiddleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parsedReferer, err := parseReferer(r.Referer())
+	if err != nil {
+		log.Printf("referer invalid (%q): %v", sanitizeUserInput(r.Referer()), err)
+		jsv1.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	siteID := r.FormValue(siteParam)
+	if err := verifySiteID(siteID, parsedReferer.Host); err != nil {
+		log.Printf("rejected %s for site %q: %v", r.URL.Path, sanitizeUserInput(siteID), err)
+		rejectSubmission(w, err)
+		return
+	}
+	m.next.ServeHTTP(w, r)
+}
+
+// rejectSubmission responds with the reason a submission wasn't authorized,
+// unless it couldn't be checked at all.
+func rejectSubmission(w http.ResponseWriter, err error) {
+	switch err {
+	case errMissingSiteID, errUnknownSite, errSiteHostMismatch, errSiteHasNoSecret,
+		errMissingTimestamp, errExpiredTimestamp, errInvalidSignature, errMissingNonce,
+		errReplayedSubmission, errInvalidSubmitterIP,
+		errInvalidToken, errTokenScope, errTokenHostMissing, errTokenHost:
+		jsv1.Error(w, http.StatusUnauthorized, err.Error())
+	default:
+		jsv1.Error(w, http.StatusInternalServerError, "unable to authorize submission")
+	}
+}
+
+// verifySiteID checks that the site with siteID owns host. A host which
+// belongs to a site with a site ID needs it: without one, a visit could be
+// recorded for the host with nothing but a forged Referer.
+func verifySiteID(siteID, host string) error {
+	if siteID == "" {
+		site, err := siteForHost(host)
+		if err != nil {
+			return err
+		}
+		if site != nil {
+			return errMissingSiteID
+		}
+		return nil
+	}
+	site, err := db.GetSite(siteID)
+	if err != nil {
+		return err
+	}
+	if site == nil {
+		return errUnknownSite
+	}
+	if !sites.Match(site.Host, host) {
+		return errSiteHostMismatch
+	}
+	return nil
+}
+
+// siteForHost returns the site with a site ID which host belongs to, or nil
+// if it doesn't belong to one.
+func siteForHost(host string) (*database.Site, error) {
+	all, err := db.GetSites()
+	if err != nil {
+		return nil, err
+	}
+	for i, site := range all {
+		if site.SiteID != "" && sites.Match(site.Host, host) {
+			return &all[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// verifySignedSubmission checks that r is signed with the secret of the site
+// with siteID, at a time close to now, for one of the site's hosts, and
+// hasn't been received before. The IP of the visitor, if the site's server
+// gave it in the ip param, replaces the IP the request came from.
+func verifySignedSubmission(r *http.Request, siteID string, now time.Time) error {
+	site, err := db.GetSite(siteID)
+	if err != nil {
+		return err
+	}
+	if site == nil {
+		return errUnknownSite
+	}
+	if site.Secret == "" {
+		return errSiteHasNoSecret
+	}
+
+	timestamp, err := strconv.ParseInt(r.FormValue(timestampParam), 10, 64)
+	if err != nil {
+		return errMissingTimestamp
+	}
+	if age := now.Sub(time.Unix(timestamp, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return errExpiredTimestamp
+	}
+
+	signature, err := hex.DecodeString(r.FormValue(signatureParam))
+	expected, _ := hex.DecodeString(SignSubmission(site.Secret, r.Form))
+	if err != nil || !hmac.Equal(signature, expected) {
+		return errInvalidSignature
+	}
+
+	if !sites.Match(site.Host, r.FormValue("host")) {
+		return errSiteHostMismatch
+	}
+
+	// Nonces have the same form as page view IDs. Each may only be used once,
+	// so a submission can't be replayed while its timestamp is still valid.
+	nonce := r.FormValue(nonceParam)
+	if !validPageviewID(nonce) {
+		return errMissingNonce
+	}
+	fresh, err := db.UseNonce(site.SiteID, nonce, now, now.Add(-nonceLifetime))
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return errReplayedSubmission
+	}
+	return useSubmittedIP(r)
+}
+
+// authorizeTokenSubmission checks that token can submit visits to the host
+// param of r. Like a signed submission, the visitor's IP may be given in the
+// ip param.
+func authorizeTokenSubmission(r *http.Request, token string) error {
+	if err := authorizeToken(token, database.ScopeWrite, r.FormValue("host")); err != nil {
+		return err
+	}
+	return useSubmittedIP(r)
+}
+
+// useSubmittedIP makes the ip param of an authorized submission the IP the
+// request came from.
+func useSubmittedIP(r *http.Request) error {
+	if ip := r.FormValue(ipParam); ip != "" {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return errInvalidSubmitterIP
+		}
+		r.RemoteAddr = addr.String()
+	}
+	return nil
+}
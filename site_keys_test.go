@@ -0,0 +1,236 @@
+package ping
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parkr/ping/analytics"
+	"github.com/parkr/ping/database"
+)
+
+func addTestSite(t *testing.T, host string, withSecret bool) *database.Site {
+	t.Helper()
+	site, err := database.AddSite(db.DB(), host, withSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return site
+}
+
+func signedSubmission(t *testing.T, params url.Values, secret string) *http.Request {
+	t.Helper()
+	params.Set(signatureParam, SignSubmission(secret, params))
+	request, err := http.NewRequest("POST", "/submit?"+params.Encode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("User-Agent", "go test client")
+	return request
+}
+
+func TestSubmit_SignedSubmission(t *testing.T) {
+	handler := newTestHandler(t, []string{"example.org"}, nil)
+	site := addTestSite(t, "example.org", true)
+
+	params := url.Values{
+		siteParam:      {site.SiteID},
+		timestampParam: {strconv.FormatInt(time.Now().Unix(), 10)},
+		"host":         {"example.org"},
+		"path":         {"/server-rendered"},
+		nonceParam:     {"c0ffee"},
+		ipParam:        {"203.0.113.7"},
+	}
+	testCases := []struct {
+		name         string
+		expectedCode int
+		expectedBody string
+	}{
+		{"first submission", http.StatusCreated, "(function(){})();"},
+		// The same submission is refused while its timestamp is still valid.
+		{"replayed submission", http.StatusUnauthorized, `(function(){console.error("nonce already used")})();`},
+	}
+	for _, testCase := range testCases {
+		recorder := serve(handler, signedSubmission(t, params, site.Secret))
+		if recorder.Code != testCase.expectedCode {
+			t.Errorf("%s: expected status code %d, got: %d %s", testCase.name, testCase.expectedCode, recorder.Code, recorder.Body)
+		}
+		if recorder.Body.String() != testCase.expectedBody {
+			t.Errorf("%s: expected body %s, got: %s", testCase.name, testCase.expectedBody, recorder.Body)
+		}
+	}
+
+	visitors, err := db.Visitors(analytics.Filter{Host: "example.org", Path: "/server-rendered"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visitors != 1 {
+		t.Errorf("expected the signed visit to be saved, got %d visitors", visitors)
+	}
+	var ip string
+	if err := db.DB().Get(&ip, "SELECT ip FROM visits"); err != nil {
+		t.Fatal(err)
+	}
+	if ip != "203.0.113.7" {
+		t.Errorf("expected the visitor's IP from the ip param, got: %q", ip)
+	}
+}
+
+func TestSubmit_SignedSubmissionRejected(t *testing.T) {
+	handler := newTestHandler(t, []string{"example.org", "example.com", "example.net"}, nil)
+	signed := addTestSite(t, "example.org", true)
+	unsigned := addTestSite(t, "example.com", false)
+
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	params := func(siteID, host, timestamp string) url.Values {
+		return url.Values{
+			siteParam:      {siteID},
+			timestampParam: {timestamp},
+			nonceParam:     {"c0ffee"},
+			"host":         {host},
+			"path":         {"/"},
+		}
+	}
+	withoutNonce := params(signed.SiteID, "example.org", now)
+	withoutNonce.Del(nonceParam)
+	testCases := []struct {
+		name     string
+		request  *http.Request
+		expected string
+	}{
+		{"unknown site", signedSubmission(t, params("unknown", "example.org", now), signed.Secret), `(function(){console.error("unknown site")})();`},
+		{"no secret", signedSubmission(t, params(unsigned.SiteID, "example.com", now), ""), `(function(){console.error("site has no secret")})();`},
+		{"wrong secret", signedSubmission(t, params(signed.SiteID, "example.org", now), "not the secret"), `(function(){console.error("invalid signature")})();`},
+		{"stale timestamp", signedSubmission(t, params(signed.SiteID, "example.org", strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)), signed.Secret), `(function(){console.error("timestamp too far from server time")})();`},
+		{"missing timestamp", signedSubmission(t, params(signed.SiteID, "example.org", ""), signed.Secret), `(function(){console.error("missing or invalid timestamp")})();`},
+		{"other host", signedSubmission(t, params(signed.SiteID, "example.net", now), signed.Secret), `(function(){console.error("host does not belong to site")})();`},
+		{"missing nonce", signedSubmission(t, withoutNonce, signed.Secret), `(function(){console.error("missing or invalid nonce")})();`},
+	}
+
+	// Changing a param after signing invalidates the signature.
+	tampered := signedSubmission(t, params(signed.SiteID, "example.org", now), signed.Secret)
+	query := tampered.URL.Query()
+	query.Set("path", "/tampered")
+	tampered.URL.RawQuery = query.Encode()
+	testCases = append(testCases, struct {
+		name     string
+		request  *http.Request
+		expected string
+	}{"tampered", tampered, `(function(){console.error("invalid signature")})();`})
+
+	for _, testCase := range testCases {
+		recorder := serve(handler, testCase.request)
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected status code %d, got: %d", testCase.name, http.StatusUnauthorized, recorder.Code)
+		}
+		if recorder.Body.String() != testCase.expected {
+			t.Errorf("%s: expected body %s, got: %s", testCase.name, testCase.expected, recorder.Body.String())
+		}
+	}
+
+	views, err := db.Views(analytics.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if views != 0 {
+		t.Errorf("expected no visits to be saved, got %d", views)
+	}
+}
+
+func TestSubmit_SiteID(t *testing.T) {
+	handler := newTestHandler(t, []string{"*.example.org", "example.com"}, nil)
+	site := addTestSite(t, "*.example.org", false)
+
+	testCases := []struct {
+		name         string
+		siteID       string
+		host         string
+		referrer     string
+		expectedCode int
+		expectedBody string
+	}{
+		{"own host", site.SiteID, "www.example.org", "https://www.example.org/post", http.StatusCreated, ""},
+		{"unknown site", "unknown", "www.example.org", "https://www.example.org/post", http.StatusUnauthorized, `(function(){console.error("unknown site")})();`},
+		{"other host", site.SiteID, "example.com", "https://example.com/post", http.StatusUnauthorized, `(function(){console.error("host does not belong to site")})();`},
+		// The visit is recorded for the host param, so it's what the site
+		// must own, even when the page is on one of the site's hosts.
+		{"other host from own page", site.SiteID, "example.com", "https://www.example.org/post", http.StatusUnauthorized, `(function(){console.error("host does not belong to site")})();`},
+		{"missing site ID", "", "www.example.org", "https://www.example.org/post", http.StatusUnauthorized, `(function(){console.error("missing site")})();`},
+		{"host without a site", "", "example.com", "https://example.com/post", http.StatusCreated, ""},
+		// Without a Referer, a site ID alone doesn't authorize a submission.
+		{"no referrer", site.SiteID, "www.example.org", "", http.StatusBadRequest, ""},
+	}
+	for _, testCase := range testCases {
+		params := url.Values{siteParam: {testCase.siteID}, "host": {testCase.host}, "path": {"/post"}}
+		request, err := http.NewRequest("POST", "/submit?"+params.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Referer", testCase.referrer)
+		request.Header.Set("User-Agent", "go test client")
+		recorder := serve(handler, request)
+
+		if recorder.Code != testCase.expectedCode {
+			t.Errorf("%s: expected status code %d, got: %d %s", testCase.name, testCase.expectedCode, recorder.Code, recorder.Body)
+		}
+		if testCase.expectedBody != "" && recorder.Body.String() != testCase.expectedBody {
+			t.Errorf("%s: expected body %s, got: %s", testCase.name, testCase.expectedBody, recorder.Body.String())
+		}
+	}
+}
+
+func TestRefererSiteID(t *testing.T) {
+	handler := newTestHandler(t, []string{"example.org", "example.com", "example.net"}, []*database.Visit{
+		{IP: "127.0.0.1", PageviewID: "abc", Host: "example.org", Path: "/post", UserAgent: "go test client", CreatedAt: "2024-01-01 09:00:00"},
+	})
+	site := addTestSite(t, "example.org", false)
+	other := addTestSite(t, "example.com", false)
+
+	event := func(siteID string) url.Values {
+		return url.Values{siteParam: {siteID}, "host": {"example.org"}, "path": {"/post"}, "name": {"signup"}}
+	}
+	testCases := []struct {
+		name         string
+		method       string
+		target       string
+		form         url.Values
+		referrer     string
+		expectedCode int
+		expectedBody string
+	}{
+		// Anyone can send a Referer, so it isn't enough to record data for a
+		// host which belongs to a site.
+		{"forged ping", "GET", "/ping", nil, "https://example.org/post", http.StatusUnauthorized, `(function(){console.error("missing site")})();`},
+		{"forged ping.js", "GET", "/ping.js", nil, "https://example.org/post", http.StatusUnauthorized, `(function(){console.error("missing site")})();`},
+		{"ping", "GET", "/ping.js?site=" + site.SiteID, nil, "https://example.org/post", http.StatusCreated, ""},
+		{"ping naming another site", "GET", "/ping.js?site=" + other.SiteID, nil, "https://example.org/post", http.StatusUnauthorized, `(function(){console.error("host does not belong to site")})();`},
+		{"ping for host without a site", "GET", "/ping.js", nil, "https://example.net/post", http.StatusCreated, ""},
+		{"v2 script", "GET", "/ping.js?v=2", nil, "https://example.org/post", http.StatusOK, ""},
+		{"forged event", "POST", "/event", event(""), "https://example.org/post", http.StatusUnauthorized, `(function(){console.error("missing site")})();`},
+		{"event", "POST", "/event", event(site.SiteID), "https://example.org/post", http.StatusCreated, ""},
+		{"forged engagement", "POST", "/engage?id=abc&seconds=10", nil, "https://example.org/post", http.StatusUnauthorized, `(function(){console.error("missing site")})();`},
+		{"engagement", "POST", "/engage?id=abc&seconds=10&site=" + site.SiteID, nil, "https://example.org/post", http.StatusNoContent, ""},
+	}
+	for _, testCase := range testCases {
+		request, err := http.NewRequest(testCase.method, testCase.target, strings.NewReader(testCase.form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if testCase.form != nil {
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		request.Header.Set("Referer", testCase.referrer)
+		request.Header.Set("User-Agent", "go test client")
+		recorder := serve(handler, request)
+
+		if recorder.Code != testCase.expectedCode {
+			t.Errorf("%s: expected status code %d, got: %d %s", testCase.name, testCase.expectedCode, recorder.Code, recorder.Body)
+		}
+		if testCase.expectedBody != "" && recorder.Body.String() != testCase.expectedBody {
+			t.Errorf("%s: expected body %s, got: %s", testCase.name, testCase.expectedBody, recorder.Body)
+		}
+	}
+}
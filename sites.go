@@ -0,0 +1,15 @@
+package ping
+
+import "github.com/parkr/ping/sites"
+
+// ReloadSites makes the allowlist in registry the configured hosts plus those
+// in the sites table. If the sites table can't be read, the allowlist is left
+// as it was.
+func ReloadSites(registry *sites.Registry, configured []string) error {
+	stored, err := db.ListSites()
+	if err != nil {
+		return err
+	}
+	registry.Replace(append(append([]string{}, configured...), stored...))
+	return nil
+}
@@ -0,0 +1,122 @@
+package sites
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// wildcardPrefix starts an entry which allows every subdomain of a host, at
+// any depth, but not the host itself.
+const wildcardPrefix = "*."
+
+// Normalize returns the canonical form of an allowlist entry: a hostname or
+// IP, optionally with a port and, for hostnames, optionally starting with
+// "*." to match every subdomain. Hostnames are lowercased, converted to
+// punycode and lose any trailing dot, so "Bücher.Example." becomes
+// "xn--bcher-kva.example". An entry without a port matches any port.
+//
+// A wildcard must be under a registrable domain, so "*.com", "*.co.uk" and
+// "*.github.io", which would allow anyone's sites, are refused.
+func Normalize(entry string) (string, error) {
+	entry = strings.TrimSpace(entry)
+	wildcard := strings.HasPrefix(entry, wildcardPrefix)
+	host, port, err := normalizeHost(strings.TrimPrefix(entry, wildcardPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid host %q: %w", entry, err)
+	}
+	if wildcard {
+		if _, err := netip.ParseAddr(host); err == nil {
+			return "", fmt.Errorf("invalid host %q: an IP can't have subdomains", entry)
+		}
+		if _, err := publicsuffix.EffectiveTLDPlusOne(host); !strings.Contains(host, ".") || err != nil {
+			return "", fmt.Errorf("invalid host %q: a wildcard must be under a registrable domain, not a public suffix", entry)
+		}
+		host = wildcardPrefix + host
+	}
+	return joinHostPort(host, port), nil
+}
+
+// normalizeHost splits the port off host, if there is one, and returns the
+// canonical form of each.
+func normalizeHost(host string) (string, string, error) {
+	var port string
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		if n, err := strconv.Atoi(p); err != nil || n < 1 || n > 65535 {
+			return "", "", fmt.Errorf("invalid port %q", p)
+		}
+		host, port = h, p
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	if host == "" {
+		return "", "", fmt.Errorf("empty hostname")
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.WithZone("").String(), port, nil
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", "", err
+	}
+	return ascii, port, nil
+}
+
+// IsWildcard returns whether the allowlist entry allows the subdomains of a
+// host, rather than a single host.
+func IsWildcard(entry string) bool {
+	return strings.HasPrefix(entry, wildcardPrefix)
+}
+
+func joinHostPort(host, port string) string {
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port == "" {
+		return host
+	}
+	return host + ":" + port
+}
+
+// Match returns whether host, which may include a port, is allowed by the
+// allowlist entry pattern.
+func Match(pattern, host string) bool {
+	entry, err := Normalize(pattern)
+	if err != nil {
+		return false
+	}
+	for _, candidate := range candidates(host) {
+		if candidate == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// candidates returns the allowlist entries which would allow host, which may
+// include a port, from the most to the least specific.
+func candidates(host string) []string {
+	name, port, err := normalizeHost(host)
+	if err != nil {
+		return nil
+	}
+	names := []string{joinHostPort(name, "")}
+	if _, err := netip.ParseAddr(name); err != nil {
+		for parent := name; strings.Contains(parent, "."); {
+			_, parent, _ = strings.Cut(parent, ".")
+			names = append(names, wildcardPrefix+parent)
+		}
+	}
+	var entries []string
+	for _, n := range names {
+		if port != "" {
+			entries = append(entries, n+":"+port)
+		}
+		entries = append(entries, n)
+	}
+	return entries
+}
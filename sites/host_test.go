@@ -0,0 +1,96 @@
+package sites
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	testCases := []struct {
+		entry    string
+		expected string
+	}{
+		{"example.org", "example.org"},
+		{" Example.ORG ", "example.org"},
+		{"example.org.", "example.org"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example"},
+		{"*.Preview.Example.com", "*.preview.example.com"},
+		{"*.example.com", "*.example.com"},
+		{"*.example.co.uk", "*.example.co.uk"},
+		{"*.parkr.github.io", "*.parkr.github.io"},
+		{"localhost:4000", "localhost:4000"},
+		{"example.org.:8080", "example.org:8080"},
+		{"127.0.0.1", "127.0.0.1"},
+		{"::1", "[::1]"},
+		{"[::1]:8080", "[::1]:8080"},
+	}
+	for _, testCase := range testCases {
+		actual, err := Normalize(testCase.entry)
+		if err != nil {
+			t.Errorf("Normalize(%q): unexpected error: %v", testCase.entry, err)
+			continue
+		}
+		if actual != testCase.expected {
+			t.Errorf("Normalize(%q): expected %q, got: %q", testCase.entry, testCase.expected, actual)
+		}
+	}
+
+	for _, entry := range []string{"", ".", "*.", "*.127.0.0.1", "example.org:0", "example.org:99999", "exa mple.org", "exam_ple.org", "*", "*.localhost", "*.com", "*.co.uk", "*.github.io"} {
+		if actual, err := Normalize(entry); err == nil {
+			t.Errorf("Normalize(%q): expected an error, got: %q", entry, actual)
+		}
+	}
+}
+
+func TestRegistry_Allowed(t *testing.T) {
+	registry := NewRegistry([]string{
+		"example.org",
+		"*.preview.example.com",
+		"localhost:4000",
+		"bücher.example",
+		"::1",
+	})
+	testCases := []struct {
+		host    string
+		allowed bool
+	}{
+		{"example.org", true},
+		{"EXAMPLE.org.", true},
+		{"example.org:8080", true},
+		{"www.example.org", false},
+		{"evil-example.org", false},
+		{"example.org.evil.com", false},
+		{"pr-1.preview.example.com", true},
+		{"PR-1.preview.example.com:443", true},
+		{"a.b.preview.example.com", true},
+		{"preview.example.com", false},
+		{"pr-1.preview.example.com.evil.com", false},
+		{"localhost:4000", true},
+		{"localhost:4001", false},
+		{"localhost", false},
+		{"xn--bcher-kva.example", true},
+		{"BÜCHER.example", true},
+		{"[::1]", true},
+		{"[::1]:9000", true},
+		{"127.0.0.1", false},
+		{"", false},
+	}
+	for _, testCase := range testCases {
+		if actual := registry.Allowed(testCase.host); actual != testCase.allowed {
+			t.Errorf("Allowed(%q): expected %v, got: %v", testCase.host, testCase.allowed, actual)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	if !Match("*.Example.com", "www.example.com:443") {
+		t.Error("expected *.Example.com to match www.example.com:443")
+	}
+	if Match("example.com", "www.example.com") {
+		t.Error("expected example.com not to match www.example.com")
+	}
+	if Match("exa mple.com", "exa mple.com") {
+		t.Error("expected an invalid pattern not to match anything")
+	}
+	if !IsWildcard("*.example.com") || IsWildcard("example.com") {
+		t.Error("expected only *.example.com to be a wildcard")
+	}
+}
@@ -0,0 +1,97 @@
+// Package sites keeps the allowlist of hosts which may record visits and read
+// reports. The allowlist can be replaced while the server is running, and
+// every middleware which consults it sees the change at once.
+package sites
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry is a concurrency-safe set of allowed hosts.
+type Registry struct {
+	mu    sync.RWMutex
+	hosts map[string]bool
+}
+
+// NewRegistry returns a Registry allowing the given hosts.
+func NewRegistry(hosts []string) *Registry {
+	return &Registry{hosts: toSet(hosts)}
+}
+
+// Allowed returns whether host, which may include a port, is in the
+// allowlist, either exactly or through a wildcard entry.
+func (r *Registry) Allowed(host string) bool {
+	entries := candidates(host)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, entry := range entries {
+		if r.hosts[entry] {
+			return true
+		}
+	}
+	return false
+}
+
+// Hosts returns the allowlist entries, normalized and sorted.
+func (r *Registry) Hosts() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return sortedKeys(r.hosts)
+}
+
+// Replace makes hosts the allowlist, logging and returning the entries which
+// were added and removed. Invalid entries are logged and left out.
+func (r *Registry) Replace(hosts []string) (added, removed []string) {
+	next := toSet(hosts)
+
+	r.mu.Lock()
+	previous := r.hosts
+	r.hosts = next
+	r.mu.Unlock()
+
+	for _, host := range sortedKeys(next) {
+		if !previous[host] {
+			added = append(added, host)
+		}
+	}
+	for _, host := range sortedKeys(previous) {
+		if !next[host] {
+			removed = append(removed, host)
+		}
+	}
+	if len(added) > 0 {
+		log.Printf("sites: now allowing %v", added)
+	}
+	if len(removed) > 0 {
+		log.Printf("sites: no longer allowing %v", removed)
+	}
+	return added, removed
+}
+
+func toSet(hosts []string) map[string]bool {
+	set := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		if strings.TrimSpace(host) == "" {
+			continue
+		}
+		entry, err := Normalize(host)
+		if err != nil {
+			log.Printf("sites: ignoring %v", err)
+			continue
+		}
+		set[entry] = true
+	}
+	return set
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
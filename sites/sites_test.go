@@ -0,0 +1,55 @@
+package sites
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry([]string{"example.org", " example.com ", ""})
+	if !registry.Allowed("example.org") || !registry.Allowed("example.com") {
+		t.Errorf("expected both hosts to be allowed, got: %v", registry.Hosts())
+	}
+	if registry.Allowed("") {
+		t.Error("expected an empty host not to be allowed")
+	}
+
+	added, removed := registry.Replace([]string{"example.org", "example.net"})
+	if strings.Join(added, ",") != "example.net" {
+		t.Errorf("expected example.net to be added, got: %v", added)
+	}
+	if strings.Join(removed, ",") != "example.com" {
+		t.Errorf("expected example.com to be removed, got: %v", removed)
+	}
+	if registry.Allowed("example.com") {
+		t.Error("expected example.com to no longer be allowed")
+	}
+	if hosts := strings.Join(registry.Hosts(), ","); hosts != "example.net,example.org" {
+		t.Errorf("expected the sorted hosts, got: %s", hosts)
+	}
+
+	added, removed = registry.Replace([]string{"example.net", "example.org"})
+	if len(added) != 0 || len(removed) != 0 {
+		t.Errorf("expected no changes, got: +%v -%v", added, removed)
+	}
+}
+
+func TestRegistry_Concurrent(t *testing.T) {
+	registry := NewRegistry([]string{"example.org"})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			registry.Replace([]string{"example.org", "example.com"})
+		}()
+		go func() {
+			defer wg.Done()
+			if !registry.Allowed("example.org") {
+				t.Error("expected example.org to stay allowed")
+			}
+		}()
+	}
+	wg.Wait()
+}
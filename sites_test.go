@@ -0,0 +1,40 @@
+package ping
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/parkr/ping/sites"
+)
+
+func TestReloadSites(t *testing.T) {
+	withTestDB(t, nil)
+	registry := sites.NewRegistry([]string{"example.org"})
+	handler := NewHandler(nil, "", WithSites(registry))
+
+	ping := func(referrer string) *httptest.ResponseRecorder {
+		request, err := http.NewRequest("GET", "/ping", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Referer", referrer)
+		request.Header.Set("User-Agent", "go test client")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	assertStatusCode(t, ping("http://example.com/post"), http.StatusUnauthorized)
+
+	if _, err := db.DB().Exec("INSERT INTO sites (host) VALUES ('example.com')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReloadSites(registry, []string{"example.net"}); err != nil {
+		t.Fatal(err)
+	}
+
+	assertStatusCode(t, ping("http://example.com/post"), http.StatusCreated)
+	assertStatusCode(t, ping("http://example.net/post"), http.StatusCreated)
+	assertStatusCode(t, ping("http://example.org/post"), http.StatusUnauthorized)
+}
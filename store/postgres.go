@@ -0,0 +1,22 @@
+package store
+
+import (
+	"github.com/parkr/ping/database"
+)
+
+// Postgres is a Store backed by a PostgreSQL database, for sites busy enough
+// that SQLite's single writer becomes a bottleneck.
+type Postgres struct {
+	sqlStore
+}
+
+// OpenPostgres connects to the PostgreSQL database at the given
+// postgres:// URL or key=value connection string, creating the schema if
+// necessary.
+func OpenPostgres(dataSourceName string) (Store, error) {
+	db, err := database.Connect(database.DriverPostgres, dataSourceName)
+	if db == nil {
+		return nil, err
+	}
+	return Postgres{sqlStore{db}}, err
+}
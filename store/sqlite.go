@@ -0,0 +1,30 @@
+package store
+
+import (
+	"github.com/parkr/ping/database"
+)
+
+// SQLite is the default Store, backed by a SQLite database file.
+type SQLite struct {
+	sqlStore
+}
+
+// OpenSQLite opens the SQLite database at path, creating it and its schema
+// if necessary.
+func OpenSQLite(path string) (Store, error) {
+	db, err := database.Connect(database.DriverSQLite, path)
+	if db == nil {
+		return nil, err
+	}
+	return SQLite{sqlStore{db}}, err
+}
+
+// InitializeForTest creates a Store backed by an in-memory SQLite database
+// for tests only.
+func InitializeForTest() (Store, error) {
+	db, err := database.InitializeForTest()
+	if db == nil {
+		return nil, err
+	}
+	return SQLite{sqlStore{db}}, err
+}
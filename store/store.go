@@ -0,0 +1,263 @@
+// Package store provides the storage backends used by the ping server.
+//
+// The backend is chosen from the scheme of the PING_DB connection string:
+// postgres:// and postgresql:// connect to PostgreSQL and anything else is
+// treated as a path to a SQLite database.
+package store
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/parkr/ping/analytics"
+	"github.com/parkr/ping/database"
+)
+
+// Store is a storage backend for visits.
+type Store interface {
+	// SaveVisit records a single visit and adds it to its visitor's session.
+	SaveVisit(visit *database.Visit) error
+	// SaveVisits records a batch of visits, like SaveVisit, in a single
+	// transaction.
+	SaveVisits(visits []*database.Visit) error
+
+	// ViewsForHostPath counts the visits to the given host & path.
+	ViewsForHostPath(host, path string) (int, error)
+	// VisitorsForHostPath counts the unique visitors to the given host & path.
+	VisitorsForHostPath(host, path string) (int, error)
+	// RecordEngagement sets the seconds a page view on host was engaged with,
+	// returning false if there is no such page view.
+	RecordEngagement(host, pageviewID string, seconds int) (bool, error)
+	// SaveEvent records a single custom event.
+	SaveEvent(event *database.Event) error
+	// PruneVisits rolls up and deletes a batch of the visits before the given
+	// day, returning how many were deleted.
+	PruneVisits(before time.Time, batchSize int) (int, error)
+	// PruneSessions deletes a batch of the sessions which ended before the
+	// given day, returning how many were deleted.
+	PruneSessions(before time.Time, batchSize int) (int, error)
+	// DailySalt returns the salt used to hash visitor IDs on the given day,
+	// deleting the salts of earlier days.
+	DailySalt(day string) (string, error)
+
+	// Views counts the visits matching the filter.
+	Views(filter analytics.Filter) (int, error)
+	// Visitors counts the unique visitors matching the filter.
+	Visitors(filter analytics.Filter) (int, error)
+	// Series buckets the views and visitors matching the filter by interval.
+	Series(filter analytics.Filter, interval analytics.Interval) ([]analytics.Bucket, error)
+	// TopPaths ranks the paths matching the filter by views or visitors.
+	TopPaths(filter analytics.Filter, page analytics.Page) ([]analytics.Entry, error)
+	// TopHosts ranks the hosts matching the filter by views or visitors.
+	TopHosts(filter analytics.Filter, page analytics.Page) ([]analytics.Entry, error)
+	// Referrers ranks the traffic sources of the visits matching the filter,
+	// optionally grouped into categories.
+	Referrers(filter analytics.Filter, page analytics.Page, byCategory bool) ([]analytics.ReferrerEntry, error)
+	// Campaigns ranks the UTM campaigns of the visits matching the filter.
+	Campaigns(filter analytics.Filter, page analytics.Page) ([]analytics.CampaignEntry, error)
+	// Sessions summarizes the sessions matching the filter.
+	Sessions(filter analytics.Filter) (analytics.SessionStats, error)
+	// TopEntryPages ranks the pages sessions matching the filter started on.
+	TopEntryPages(filter analytics.Filter, page analytics.Page) ([]analytics.Entry, error)
+	// TopExitPages ranks the pages sessions matching the filter ended on.
+	TopExitPages(filter analytics.Filter, page analytics.Page) ([]analytics.Entry, error)
+	// Engagement ranks the paths matching the filter, with the average and
+	// median time they were engaged with.
+	Engagement(filter analytics.Filter, page analytics.Page) ([]analytics.EngagementEntry, error)
+	// Breakdown ranks the values of a user agent dimension, like the browser,
+	// of the visits matching the filter.
+	Breakdown(filter analytics.Filter, dimension analytics.Dimension, page analytics.Page) ([]analytics.BreakdownEntry, error)
+	// Events counts the custom events matching the filter, optionally only
+	// those with the given name, and broken down by the values of property.
+	Events(filter analytics.Filter, name, property string, page analytics.Page) ([]analytics.EventEntry, error)
+	// ListSites lists the hosts in the sites table.
+	ListSites() ([]string, error)
+	// GetSites fetches every site in the sites table.
+	GetSites() ([]database.Site, error)
+	// GetSite fetches the site with the given site ID, or nil if there is no
+	// such site.
+	GetSite(siteID string) (*database.Site, error)
+	// UseNonce records that a site signed a submission with nonce at now,
+	// returning false if it already had. Nonces used before expiredBefore are
+	// forgotten.
+	UseNonce(siteID, nonce string, now, expiredBefore time.Time) (bool, error)
+	// GetAPIToken fetches the record of an API token, or nil if there is no
+	// such token.
+	GetAPIToken(token string) (*database.APIToken, error)
+	// CreateDashboardSession starts a dashboard session for the API token
+	// with tokenID, lasting until expires, and returns its ID.
+	CreateDashboardSession(tokenID int, now, expires time.Time) (string, error)
+	// GetDashboardSession fetches the record of the API token a dashboard
+	// session was started with, or nil if it has ended.
+	GetDashboardSession(id string, now time.Time) (*database.APIToken, error)
+	// DeleteDashboardSession ends a dashboard session.
+	DeleteDashboardSession(id string) error
+	// ListDistinctColumn lists the distinct values of the "host" or "path"
+	// column.
+	ListDistinctColumn(col string) ([]string, error)
+
+	// Ping verifies the connection to the backend is still alive.
+	Ping() error
+	// Close closes the connection to the backend.
+	Close() error
+
+	// DB returns the underlying database handle.
+	DB() *sqlx.DB
+}
+
+// Open connects to the backend described by connection, creating the schema
+// if necessary. If the connection succeeds but the schema could not be
+// verified, the Store is returned alongside the error so its health can still
+// be reported.
+func Open(connection string) (Store, error) {
+	driverName, dataSourceName := database.ParseConnection(connection)
+	switch driverName {
+	case database.DriverPostgres:
+		return OpenPostgres(dataSourceName)
+	default:
+		return OpenSQLite(dataSourceName)
+	}
+}
+
+// sqlStore implements Store on top of a sqlx database handle. The queries it
+// runs are rebound for the handle's driver, so each backend only needs to
+// provide the connection.
+type sqlStore struct {
+	db *sqlx.DB
+}
+
+func (s sqlStore) SaveVisit(visit *database.Visit) error {
+	return database.SaveVisits(s.db, []*database.Visit{visit})
+}
+
+func (s sqlStore) SaveVisits(visits []*database.Visit) error {
+	return database.SaveVisits(s.db, visits)
+}
+
+func (s sqlStore) RecordEngagement(host, pageviewID string, seconds int) (bool, error) {
+	return database.RecordEngagement(s.db, host, pageviewID, seconds)
+}
+
+func (s sqlStore) SaveEvent(event *database.Event) error {
+	return event.Save(s.db)
+}
+
+func (s sqlStore) PruneVisits(before time.Time, batchSize int) (int, error) {
+	return database.PruneVisits(s.db, before, batchSize)
+}
+
+func (s sqlStore) PruneSessions(before time.Time, batchSize int) (int, error) {
+	return database.PruneSessions(s.db, before, batchSize)
+}
+
+func (s sqlStore) DailySalt(day string) (string, error) {
+	return database.DailySalt(s.db, day)
+}
+
+func (s sqlStore) ViewsForHostPath(host, path string) (int, error) {
+	return analytics.ViewsForHostPath(s.db, host, path)
+}
+
+func (s sqlStore) VisitorsForHostPath(host, path string) (int, error) {
+	return analytics.VisitorsForHostPath(s.db, host, path)
+}
+
+func (s sqlStore) Views(filter analytics.Filter) (int, error) {
+	return analytics.Views(s.db, filter)
+}
+
+func (s sqlStore) Visitors(filter analytics.Filter) (int, error) {
+	return analytics.Visitors(s.db, filter)
+}
+
+func (s sqlStore) Series(filter analytics.Filter, interval analytics.Interval) ([]analytics.Bucket, error) {
+	return analytics.Series(s.db, filter, interval)
+}
+
+func (s sqlStore) TopPaths(filter analytics.Filter, page analytics.Page) ([]analytics.Entry, error) {
+	return analytics.TopPaths(s.db, filter, page)
+}
+
+func (s sqlStore) TopHosts(filter analytics.Filter, page analytics.Page) ([]analytics.Entry, error) {
+	return analytics.TopHosts(s.db, filter, page)
+}
+
+func (s sqlStore) Referrers(filter analytics.Filter, page analytics.Page, byCategory bool) ([]analytics.ReferrerEntry, error) {
+	return analytics.Referrers(s.db, filter, page, byCategory)
+}
+
+func (s sqlStore) Campaigns(filter analytics.Filter, page analytics.Page) ([]analytics.CampaignEntry, error) {
+	return analytics.Campaigns(s.db, filter, page)
+}
+
+func (s sqlStore) Sessions(filter analytics.Filter) (analytics.SessionStats, error) {
+	return analytics.Sessions(s.db, filter)
+}
+
+func (s sqlStore) TopEntryPages(filter analytics.Filter, page analytics.Page) ([]analytics.Entry, error) {
+	return analytics.TopEntryPages(s.db, filter, page)
+}
+
+func (s sqlStore) TopExitPages(filter analytics.Filter, page analytics.Page) ([]analytics.Entry, error) {
+	return analytics.TopExitPages(s.db, filter, page)
+}
+
+func (s sqlStore) Engagement(filter analytics.Filter, page analytics.Page) ([]analytics.EngagementEntry, error) {
+	return analytics.Engagement(s.db, filter, page)
+}
+
+func (s sqlStore) Breakdown(filter analytics.Filter, dimension analytics.Dimension, page analytics.Page) ([]analytics.BreakdownEntry, error) {
+	return analytics.Breakdown(s.db, filter, dimension, page)
+}
+
+func (s sqlStore) Events(filter analytics.Filter, name, property string, page analytics.Page) ([]analytics.EventEntry, error) {
+	return analytics.Events(s.db, filter, name, property, page)
+}
+
+func (s sqlStore) ListSites() ([]string, error) {
+	return database.ListSites(s.db)
+}
+
+func (s sqlStore) GetSites() ([]database.Site, error) {
+	return database.GetSites(s.db)
+}
+
+func (s sqlStore) GetSite(siteID string) (*database.Site, error) {
+	return database.GetSite(s.db, siteID)
+}
+
+func (s sqlStore) UseNonce(siteID, nonce string, now, expiredBefore time.Time) (bool, error) {
+	return database.UseNonce(s.db, siteID, nonce, now, expiredBefore)
+}
+
+func (s sqlStore) GetAPIToken(token string) (*database.APIToken, error) {
+	return database.GetAPIToken(s.db, token)
+}
+
+func (s sqlStore) CreateDashboardSession(tokenID int, now, expires time.Time) (string, error) {
+	return database.CreateDashboardSession(s.db, tokenID, now, expires)
+}
+
+func (s sqlStore) GetDashboardSession(id string, now time.Time) (*database.APIToken, error) {
+	return database.GetDashboardSession(s.db, id, now)
+}
+
+func (s sqlStore) DeleteDashboardSession(id string) error {
+	return database.DeleteDashboardSession(s.db, id)
+}
+
+func (s sqlStore) ListDistinctColumn(col string) ([]string, error) {
+	return analytics.ListDistinctColumn(s.db, col)
+}
+
+func (s sqlStore) Ping() error {
+	return s.db.Ping()
+}
+
+func (s sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func (s sqlStore) DB() *sqlx.DB {
+	return s.db
+}
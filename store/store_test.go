@@ -0,0 +1,355 @@
+package store
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/parkr/ping/analytics"
+	"github.com/parkr/ping/database"
+)
+
+// postgresTestURLEnvVar names the environment variable holding the URL of a
+// throwaway PostgreSQL database for tests. The Postgres tests are skipped
+// when it is unset.
+const postgresTestURLEnvVar = "PING_TEST_POSTGRES_URL"
+
+func openPostgresForTest(t *testing.T) Store {
+	t.Helper()
+	connection := os.Getenv(postgresTestURLEnvVar)
+	if connection == "" {
+		t.Skipf("%s is not set", postgresTestURLEnvVar)
+	}
+	store, err := Open(connection)
+	if err != nil {
+		t.Fatalf("unable to open postgres store: %v", err)
+	}
+	if _, ok := store.(Postgres); !ok {
+		t.Fatalf("expected %q to open a Postgres store, got %T", connection, store)
+	}
+	if _, err := store.DB().Exec("TRUNCATE visits, visit_rollups, sessions, events, sites, submission_nonces, api_tokens, dashboard_sessions CASCADE"); err != nil {
+		t.Fatalf("unable to truncate tables: %v", err)
+	}
+	return store
+}
+
+func TestSQLite(t *testing.T) {
+	store, err := InitializeForTest()
+	if err != nil {
+		t.Fatalf("unable to initialize store: %v", err)
+	}
+	defer store.Close()
+
+	testStore(t, store)
+}
+
+func TestPostgres(t *testing.T) {
+	store := openPostgresForTest(t)
+	defer store.Close()
+
+	testStore(t, store)
+}
+
+func TestOpen_SQLiteByDefault(t *testing.T) {
+	store, err := Open("file:TestOpen_SQLiteByDefault?mode=memory")
+	if err != nil {
+		t.Fatalf("unable to open store: %v", err)
+	}
+	defer store.Close()
+
+	if _, ok := store.(SQLite); !ok {
+		t.Errorf("expected a SQLite store, got %T", store)
+	}
+}
+
+func testStore(t *testing.T, store Store) {
+	if err := store.Ping(); err != nil {
+		t.Fatalf("expected store to be healthy, got: %v", err)
+	}
+
+	createdAt := time.Now().UTC().Format(database.SQLDateTimeFormat)
+	for _, visit := range []*database.Visit{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/root", UserAgent: "go test client", CreatedAt: createdAt, PageviewID: "first"},
+		{IP: "127.0.0.1", Host: "example.org", Path: "/root", UserAgent: "go test client", CreatedAt: createdAt, PageviewID: "second"},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/root", UserAgent: "go test client", CreatedAt: createdAt,
+			Campaign: database.Campaign{Name: "launch", Source: "newsletter", Medium: "email"}},
+		{IP: "127.0.0.1", Host: "example.org", Path: "/foo", UserAgent: "go test client", Referrer: "https://www.google.com/", CreatedAt: createdAt},
+	} {
+		if err := store.SaveVisit(visit); err != nil {
+			t.Fatalf("unable to save visit %s: %v", visit, err)
+		}
+	}
+
+	views, err := store.ViewsForHostPath("example.org", "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if views != 3 {
+		t.Errorf("expected 3 views, got: %d", views)
+	}
+
+	visitors, err := store.VisitorsForHostPath("example.org", "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visitors != 2 {
+		t.Errorf("expected 2 visitors, got: %d", visitors)
+	}
+
+	hosts, err := store.ListDistinctColumn("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1 || hosts[0] != "example.org" {
+		t.Errorf("expected hosts [example.org], got: %v", hosts)
+	}
+
+	paths, err := store.ListDistinctColumn("path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 {
+		t.Errorf("expected 2 paths, got: %v", paths)
+	}
+
+	if _, err := store.ListDistinctColumn("ip"); err == nil {
+		t.Error("expected an error listing an unsupported column")
+	}
+
+	filter := analytics.Filter{Host: "example.org", From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)}
+	views, err = store.Views(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if views != 4 {
+		t.Errorf("expected 4 views in the last hour, got: %d", views)
+	}
+
+	visitors, err = store.Visitors(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visitors != 2 {
+		t.Errorf("expected 2 visitors in the last hour, got: %d", visitors)
+	}
+
+	series, err := store.Series(filter, analytics.IntervalHour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, bucket := range series {
+		total += bucket.Views
+	}
+	if total != 4 {
+		t.Errorf("expected 4 views across the series, got: %+v", series)
+	}
+
+	entries, err := store.TopPaths(analytics.Filter{Host: "example.org"}, analytics.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Path != "/root" || entries[0].Views != 3 {
+		t.Errorf("expected /root to be the top path, got: %+v", entries)
+	}
+
+	entries, err = store.TopHosts(analytics.Filter{}, analytics.Page{SortBy: "visitors"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Host != "example.org" || entries[0].Visitors != 2 {
+		t.Errorf("expected example.org to be the top host, got: %+v", entries)
+	}
+
+	referrers, err := store.Referrers(analytics.Filter{Host: "example.org"}, analytics.Page{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(referrers) != 2 || referrers[0].Category != analytics.CategoryDirect || referrers[1].Source != "Google" {
+		t.Errorf("expected direct and Google referrers, got: %+v", referrers)
+	}
+
+	campaigns, err := store.Campaigns(analytics.Filter{Host: "example.org"}, analytics.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(campaigns) != 1 || campaigns[0].Campaign != "launch" || campaigns[0].Views != 1 {
+		t.Errorf("expected the launch campaign, got: %+v", campaigns)
+	}
+
+	for pageviewID, seconds := range map[string]int{"first": 10, "second": 30} {
+		found, err := store.RecordEngagement("example.org", pageviewID, seconds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found {
+			t.Errorf("expected page view %q to be found", pageviewID)
+		}
+	}
+	engagement, err := store.Engagement(analytics.Filter{Host: "example.org"}, analytics.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(engagement) != 1 || engagement[0].Views != 2 || engagement[0].AverageSeconds != 20 || engagement[0].MedianSeconds != 20 {
+		t.Errorf("expected 20 seconds spent on /root, got: %+v", engagement)
+	}
+
+	sessions, err := store.Sessions(analytics.Filter{Host: "example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessions.Sessions != 2 || sessions.BounceRate != 0.5 || sessions.PageviewsPerSession != 2 {
+		t.Errorf("expected 2 sessions, one a bounce, got: %+v", sessions)
+	}
+
+	entries, err = store.TopEntryPages(analytics.Filter{Host: "example.org"}, analytics.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != "/root" || entries[0].Views != 2 {
+		t.Errorf("expected every session to start on /root, got: %+v", entries)
+	}
+
+	entries, err = store.TopExitPages(analytics.Filter{Host: "example.org"}, analytics.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Path != "/foo" || entries[1].Path != "/root" {
+		t.Errorf("expected sessions to end on /foo and /root, got: %+v", entries)
+	}
+
+	for _, event := range []*database.Event{
+		{IP: "127.0.0.1", Host: "example.org", Path: "/root", Name: "signup", CreatedAt: createdAt, Properties: map[string]string{"plan": "pro"}},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/root", Name: "signup", CreatedAt: createdAt, Properties: map[string]string{"plan": "free"}},
+		{IP: "127.0.0.2", Host: "example.org", Path: "/root", Name: "download", CreatedAt: createdAt},
+	} {
+		if err := store.SaveEvent(event); err != nil {
+			t.Fatalf("unable to save event %s: %v", event, err)
+		}
+	}
+
+	events, err := store.Events(analytics.Filter{Host: "example.org"}, "", "", analytics.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Name != "signup" || events[0].Count != 2 || events[0].Visitors != 2 {
+		t.Errorf("expected signup to be the top event, got: %+v", events)
+	}
+
+	events, err = store.Events(analytics.Filter{Host: "example.org"}, "signup", "plan", analytics.Page{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Count != 1 || events[1].Count != 1 {
+		t.Errorf("expected one signup for each plan, got: %+v", events)
+	}
+
+	day := time.Now().UTC().Format(database.SaltDayFormat)
+	salt, err := store.DailySalt(day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := store.DailySalt(day)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if salt == "" || again != salt {
+		t.Errorf("expected the same salt for the same day, got %q and %q", salt, again)
+	}
+
+	if _, err := store.DB().Exec("INSERT INTO sites (host) VALUES ('example.org')"); err != nil {
+		t.Fatal(err)
+	}
+	siteHosts, err := store.ListSites()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(siteHosts) != 1 || siteHosts[0] != "example.org" {
+		t.Errorf("expected example.org to be listed as a site, got: %v", siteHosts)
+	}
+	added, err := database.AddSite(store.DB(), "example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	site, err := store.GetSite(added.SiteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if site == nil || site.Host != "example.com" || site.Secret != added.Secret {
+		t.Errorf("expected example.com with its secret, got: %+v", site)
+	}
+	allSites, err := store.GetSites()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allSites) != 2 || allSites[0].Host != "example.com" || allSites[0].SiteID != added.SiteID {
+		t.Errorf("expected example.com and example.org, got: %+v", allSites)
+	}
+	for i, expected := range []bool{true, false} {
+		fresh, err := store.UseNonce(added.SiteID, "abc", time.Now(), time.Now().Add(-time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fresh != expected {
+			t.Errorf("use %d: expected the nonce to be fresh: %v, got: %v", i+1, expected, fresh)
+		}
+	}
+	token, _, err := database.CreateAPIToken(store.DB(), "test", "example.com", database.ScopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, err := store.GetAPIToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record == nil || record.Host != "example.com" || record.Scope != database.ScopeRead {
+		t.Errorf("expected a read token for example.com, got: %+v", record)
+	}
+	session, err := store.CreateDashboardSession(record.ID, time.Now(), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if viewer, err := store.GetDashboardSession(session, time.Now()); err != nil || viewer == nil || viewer.ID != record.ID {
+		t.Errorf("expected the session to be for token %d, got: %+v, %v", record.ID, viewer, err)
+	}
+	if err := store.DeleteDashboardSession(session); err != nil {
+		t.Fatal(err)
+	}
+	if viewer, err := store.GetDashboardSession(session, time.Now()); err != nil || viewer != nil {
+		t.Errorf("expected the session to have ended, got: %+v, %v", viewer, err)
+	}
+
+	// Pruning every visit leaves the counts as they were.
+	for {
+		deleted, err := store.PruneVisits(time.Now().Add(48*time.Hour), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted == 0 {
+			break
+		}
+	}
+	for {
+		deleted, err := store.PruneSessions(time.Now().Add(48*time.Hour), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted == 0 {
+			break
+		}
+	}
+	views, err = store.Views(analytics.Filter{Host: "example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if views != 4 {
+		t.Errorf("expected 4 views after pruning, got: %d", views)
+	}
+	sessions, err = store.Sessions(analytics.Filter{Host: "example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sessions.Sessions != 0 {
+		t.Errorf("expected sessions to be pruned with their visits, got: %+v", sessions)
+	}
+}
@@ -0,0 +1,133 @@
+// Package useragent parses User-Agent headers into the browser, operating
+// system and class of device a visitor used.
+package useragent
+
+import (
+	"strings"
+)
+
+// Device classes.
+const (
+	Desktop = "desktop"
+	Mobile  = "mobile"
+	Tablet  = "tablet"
+)
+
+// Other is the browser or OS of a User-Agent which isn't recognized.
+const Other = "Other"
+
+// UserAgent is what could be learned from a User-Agent header.
+type UserAgent struct {
+	// Browser is the browser family, like "Chrome" or "Safari".
+	Browser string
+	// BrowserVersion is the major version of the browser, like "120".
+	BrowserVersion string
+	// OS is the operating system family, like "Windows" or "iOS".
+	OS string
+	// Device is Desktop, Mobile or Tablet.
+	Device string
+}
+
+// browsers are checked in order, as most browsers include the tokens of the
+// ones they are based on: Edge and Opera claim to be Chrome, which in turn
+// claims to be Safari. The version follows the first token found, and a
+// browser with markers is only matched if one of them is present too.
+var browsers = []struct {
+	name    string
+	tokens  []string
+	markers []string
+}{
+	{"Edge", []string{"Edg/", "EdgA/", "EdgiOS/", "Edge/"}, nil},
+	{"Opera", []string{"OPR/", "OPiOS/", "Opera/"}, nil},
+	{"Samsung Internet", []string{"SamsungBrowser/"}, nil},
+	{"Firefox", []string{"Firefox/", "FxiOS/"}, nil},
+	{"Chromium", []string{"Chromium/"}, nil},
+	{"Chrome", []string{"Chrome/", "CriOS/"}, nil},
+	{"Safari", []string{"Version/"}, []string{"Safari/"}},
+	{"Internet Explorer", []string{"MSIE ", "rv:"}, []string{"MSIE ", "Trident/"}},
+}
+
+// operatingSystems are checked in order, as Android claims to be Linux and
+// iOS claims to be Mac OS X.
+var operatingSystems = []struct {
+	name   string
+	tokens []string
+}{
+	{"Windows Phone", []string{"Windows Phone"}},
+	{"Windows", []string{"Windows"}},
+	{"iOS", []string{"iPhone", "iPad", "iPod"}},
+	{"Android", []string{"Android"}},
+	{"Chrome OS", []string{"CrOS"}},
+	{"macOS", []string{"Macintosh", "Mac OS X"}},
+	{"Linux", []string{"Linux"}},
+}
+
+// Parse parses a User-Agent header. Unrecognized browsers and operating
+// systems are Other, and unrecognized devices are Desktop.
+func Parse(userAgent string) UserAgent {
+	parsed := UserAgent{Browser: Other, OS: Other, Device: device(userAgent)}
+
+	for _, browser := range browsers {
+		if browser.markers != nil && !containsAny(userAgent, browser.markers) {
+			continue
+		}
+		if version, ok := versionAfter(userAgent, browser.tokens); ok {
+			parsed.Browser, parsed.BrowserVersion = browser.name, version
+			break
+		}
+	}
+
+	for _, os := range operatingSystems {
+		if containsAny(userAgent, os.tokens) {
+			parsed.OS = os.name
+			break
+		}
+	}
+	// iPads on iPadOS 13 and later claim to be Macs.
+	if parsed.OS == "macOS" && parsed.Device == Tablet {
+		parsed.OS = "iOS"
+	}
+
+	return parsed
+}
+
+// device classifies the device from the User-Agent, defaulting to Desktop.
+func device(userAgent string) string {
+	switch {
+	case containsAny(userAgent, []string{"iPad", "Tablet", "Kindle", "Silk/"}):
+		return Tablet
+	case strings.Contains(userAgent, "Android") && !strings.Contains(userAgent, "Mobile"):
+		return Tablet
+	case containsAny(userAgent, []string{"Mobi", "iPhone", "iPod", "Android", "Windows Phone"}):
+		return Mobile
+	default:
+		return Desktop
+	}
+}
+
+// versionAfter returns the major version following the first of the tokens
+// found in userAgent.
+func versionAfter(userAgent string, tokens []string) (string, bool) {
+	for _, token := range tokens {
+		i := strings.Index(userAgent, token)
+		if i < 0 {
+			continue
+		}
+		version := userAgent[i+len(token):]
+		end := 0
+		for end < len(version) && version[end] >= '0' && version[end] <= '9' {
+			end++
+		}
+		return version[:end], true
+	}
+	return "", false
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	for userAgent, expected := range map[string]UserAgent{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36":                                 {"Chrome", "120", "Windows", Desktop},
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.61":               {"Edge", "120", "Windows", Desktop},
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 OPR/105.0.0.0":             {"Opera", "105", "macOS", Desktop},
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15":                           {"Safari", "17", "macOS", Desktop},
+		"Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0":                                                                          {"Firefox", "120", "Linux", Desktop},
+		"Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36":                                  {"Chrome", "120", "Chrome OS", Desktop},
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1":         {"Safari", "17", "iOS", Mobile},
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1": {"Chrome", "120", "iOS", Mobile},
+		"Mozilla/5.0 (iPad; CPU OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1":                  {"Safari", "17", "iOS", Tablet},
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.144 Mobile Safari/537.36":                      {"Chrome", "120", "Android", Mobile},
+		"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Safari/537.36":              {"Samsung Internet", "23", "Android", Tablet},
+		"Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko":                                                                            {"Internet Explorer", "11", "Windows", Desktop},
+		"go test client": {Other, "", Other, Desktop},
+		"":               {Other, "", Other, Desktop},
+	} {
+		if actual := Parse(userAgent); actual != expected {
+			t.Errorf("expected Parse(%q) to be %+v, got %+v", userAgent, expected, actual)
+		}
+	}
+}
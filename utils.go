@@ -2,10 +2,18 @@ package ping
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/parkr/ping/analytics"
+	"github.com/parkr/ping/database"
 )
 
+const dateFormat = "2006-01-02"
+
 func writeJsonResponse(w http.ResponseWriter, input interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	data, err := json.Marshal(input)
@@ -28,3 +36,74 @@ func sanitizeUserInput(input string) string {
 	escapedInput = strings.ReplaceAll(escapedInput, "\r", "")
 	return escapedInput
 }
+
+// parseTimeParam parses a time from user input, given as a date, a SQL
+// datetime or an RFC 3339 timestamp. Times without a zone are in UTC.
+func parseTimeParam(value string) (t time.Time, dateOnly bool, err error) {
+	if t, err := time.Parse(dateFormat, value); err == nil {
+		return t, true, nil
+	}
+	if t, err := time.Parse(database.SQLDateTimeFormat, value); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	return time.Time{}, false, fmt.Errorf("unable to parse %q as a date or time", value)
+}
+
+// filterFromRequest builds an analytics filter from the host, path, from, to
+// and bots params in the form. A "to" given as a date includes that whole day.
+func filterFromRequest(r *http.Request) (analytics.Filter, error) {
+	filter := analytics.Filter{
+		Host: r.FormValue("host"),
+		Path: r.FormValue("path"),
+	}
+	if from := r.FormValue("from"); from != "" {
+		t, _, err := parseTimeParam(from)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from: %w", err)
+		}
+		filter.From = t
+	}
+	if to := r.FormValue("to"); to != "" {
+		t, dateOnly, err := parseTimeParam(to)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to: %w", err)
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		filter.To = t
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, fmt.Errorf("invalid range: from must be before to")
+	}
+	bots, err := analytics.ParseBots(r.FormValue("bots"))
+	if err != nil {
+		return filter, err
+	}
+	filter.Bots = bots
+	return filter, nil
+}
+
+// pageFromRequest builds an analytics page from the sort, limit and offset
+// params in the form.
+func pageFromRequest(r *http.Request) (analytics.Page, error) {
+	page := analytics.Page{SortBy: r.FormValue("sort")}
+	if limit := r.FormValue("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return page, fmt.Errorf("invalid limit: %q is not a positive integer", limit)
+		}
+		page.Limit = n
+	}
+	if offset := r.FormValue("offset"); offset != "" {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return page, fmt.Errorf("invalid offset: %q is not a non-negative integer", offset)
+		}
+		page.Offset = n
+	}
+	return page, nil
+}
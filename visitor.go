@@ -0,0 +1,57 @@
+package ping
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/parkr/ping/database"
+)
+
+// visitorHasher identifies visitors by a hash of the host, IP and user agent,
+// keyed with a salt which rotates daily, so unique visitors can be counted
+// without storing IPs. Once a day's salt is deleted, that day's hashes can no
+// longer be linked to an IP, nor to the same visitor on another day.
+type visitorHasher struct {
+	mu   sync.Mutex
+	day  string
+	salt string
+}
+
+// identify returns the IP and visitor ID to store for a visitor. Without a
+// hasher, the visitor is identified by their IP. With one, only the hash is
+// kept and the IP is dropped.
+func (h *visitorHasher) identify(host, ip, userAgent string, now time.Time) (storedIP, visitorID string, err error) {
+	if h == nil {
+		return ip, ip, nil
+	}
+
+	salt, err := h.dailySalt(now)
+	if err != nil {
+		return "", "", err
+	}
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(host + "\x00" + ip + "\x00" + userAgent))
+	return "", hex.EncodeToString(mac.Sum(nil)[:16]), nil
+}
+
+// dailySalt returns the salt for the UTC day of now, fetching it from the
+// database when the day changes.
+func (h *visitorHasher) dailySalt(now time.Time) (string, error) {
+	day := now.UTC().Format(database.SaltDayFormat)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.day == day {
+		return h.salt, nil
+	}
+
+	salt, err := db.DailySalt(day)
+	if err != nil {
+		return "", err
+	}
+	h.day, h.salt = day, salt
+	return salt, nil
+}
@@ -0,0 +1,36 @@
+package ping
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/parkr/ping/batch"
+	"github.com/parkr/ping/database"
+)
+
+// maxEnqueueWait is the longest a visit waits for room in a full queue
+// before the request is turned away.
+const maxEnqueueWait = 100 * time.Millisecond
+
+// maxFlushWait is the longest an engagement report waits for the queued
+// visits to be saved, in case its page view is among them.
+const maxFlushWait = time.Second
+
+// NewBatchWriter starts a batch.Writer which saves visits to the database
+// opened by Initialize. Pass it to WithBatchedWrites, and Close it on
+// shutdown to save the visits still queued.
+func NewBatchWriter(config batch.Config) *batch.Writer {
+	return batch.NewWriter(batch.SaverFunc(func(visits []*database.Visit) error {
+		return db.SaveVisits(visits)
+	}), config)
+}
+
+type metricsHandler struct {
+	writer *batch.Writer
+}
+
+// metrics responds with the queue depth, flush latency and counts of the
+// batch writer.
+func (m metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	writeJsonResponse(w, map[string]batch.Stats{"batch_writer": m.writer.Stats()})
+}
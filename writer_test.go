@@ -0,0 +1,133 @@
+package ping
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/parkr/ping/batch"
+	"github.com/parkr/ping/database"
+)
+
+func TestPingSuccess_BatchedWrites(t *testing.T) {
+	writer := NewBatchWriter(batch.Config{FlushInterval: 10 * time.Millisecond})
+	handler := newTestHandler(t, []string{"example.org"}, nil, WithBatchedWrites(writer), WithAPITokens())
+
+	testCases := []struct {
+		name         string
+		closed       bool
+		expectedCode int
+	}{
+		{"first visit", false, http.StatusAccepted},
+		{"second visit", false, http.StatusAccepted},
+		{"third visit", false, http.StatusAccepted},
+		// Once closed, visits are turned away.
+		{"after closing", true, http.StatusServiceUnavailable},
+	}
+	for _, testCase := range testCases {
+		if testCase.closed {
+			if err := writer.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		request, err := http.NewRequest("GET", "/ping", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request.Header.Set("Referer", "http://example.org/root")
+		request.Header.Set("User-Agent", "go test client")
+		request.RemoteAddr = "100.0.0.0"
+
+		recorder := serve(handler, request)
+		if recorder.Code != testCase.expectedCode {
+			t.Errorf("%s: expected status code %d, got: %d %s", testCase.name, testCase.expectedCode, recorder.Code, recorder.Body)
+		}
+	}
+
+	views, err := db.ViewsForHostPath("example.org", "/root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if views != 3 {
+		t.Errorf("expected 3 views once the queue was drained, got: %d", views)
+	}
+	if _, err := database.GetSession(db.DB(), 1); err != nil {
+		t.Errorf("expected the visits to be grouped into a session, got: %v", err)
+	}
+
+	allSites := createTestToken(t, "", database.ScopeRead)
+	oneSite := createTestToken(t, "example.org", database.ScopeRead)
+	metricsCases := []struct {
+		name         string
+		token        string
+		expectedCode int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"one site", oneSite, http.StatusForbidden},
+		{"all sites", allSites, http.StatusOK},
+	}
+	for _, testCase := range metricsCases {
+		request, err := http.NewRequest("GET", "/_metrics", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if testCase.token != "" {
+			request.Header.Set("Authorization", "Bearer "+testCase.token)
+		}
+		recorder := serve(handler, request)
+		if recorder.Code != testCase.expectedCode {
+			t.Errorf("%s: expected status code %d, got: %d %s", testCase.name, testCase.expectedCode, recorder.Code, recorder.Body)
+		}
+		if recorder.Code != http.StatusOK {
+			continue
+		}
+
+		var body map[string]batch.Stats
+		if err := json.NewDecoder(recorder.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if stats := body["batch_writer"]; stats.Queued != 3 || stats.Rejected != 1 || stats.Saved != 3 || stats.Flushes < 1 {
+			t.Errorf("expected 3 visits to be queued and saved, and 1 rejected, got: %+v", stats)
+		}
+	}
+}
+
+func TestEngage_BatchedWrites(t *testing.T) {
+	// The page view would otherwise wait an hour to be saved.
+	writer := NewBatchWriter(batch.Config{FlushInterval: time.Hour})
+	defer writer.Close(context.Background())
+	handler := newTestHandler(t, []string{"example.org"}, nil, WithBatchedWrites(writer))
+
+	recorder := serve(handler, newSubmitRequest(t, url.Values{
+		"host":     {"example.org"},
+		"path":     {"/long-read"},
+		"pageview": {"lq2x7k-4fzyo82mvyr"},
+	}))
+	assertStatusCode(t, recorder, http.StatusAccepted)
+
+	testCases := []struct {
+		name         string
+		id           string
+		expectedCode int
+	}{
+		{"queued page view", "lq2x7k-4fzyo82mvyr", http.StatusNoContent},
+		{"unknown page view", "0f8fad5b-d9cb-469f-a165-70867728950e", http.StatusNotFound},
+	}
+	for _, testCase := range testCases {
+		recorder := serve(handler, newEngageRequest(t, url.Values{"id": {testCase.id}, "seconds": {"42"}}))
+		if recorder.Code != testCase.expectedCode {
+			t.Errorf("%s: expected status code %d, got: %d %s", testCase.name, testCase.expectedCode, recorder.Code, recorder.Body)
+		}
+	}
+
+	visit, err := database.Get(db.DB(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visit.EngagedSeconds != 42 {
+		t.Errorf("expected the engaged time to be recorded, got: %d", visit.EngagedSeconds)
+	}
+}